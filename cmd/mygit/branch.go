@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/wildmatch"
+	"github.com/codecrafters-io/git-starter-go/pkg/config"
+	"github.com/codecrafters-io/git-starter-go/pkg/mygit"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// commitFlag is the value of --merged[=<commit>] and --no-merged[=<commit>];
+// without a value it is HEAD.
+type commitFlag string
+
+func (c *commitFlag) String() string { return string(*c) }
+
+func (c *commitFlag) Set(s string) error {
+	if s == "true" {
+		s = "HEAD"
+	}
+	*c = commitFlag(s)
+	return nil
+}
+
+func (c *commitFlag) IsBoolFlag() bool { return true }
+
+// lastArgDefault gives a bare -name or --name the argument that follows it,
+// as git does: the HEAD default applies only when the option is last on the
+// command line. argv is the command line and args what is left of it after
+// parsing; the remaining arguments are returned.
+func lastArgDefault(argv, args []string, name string, value *commitFlag) []string {
+	if len(args) == 0 || len(argv) <= len(args) {
+		return args
+	}
+	if last := argv[len(argv)-len(args)-1]; last != "-"+name && last != "--"+name {
+		return args
+	}
+	*value = commitFlag(args[0])
+	return args[1:]
+}
+
+type branchOptions struct {
+	// verbose is 1 for -v and 2 for -vv.
+	verbose  int
+	all      bool
+	remotes  bool
+	contains string
+	merged   string
+	noMerged string
+}
+
+// branchEntry is a line of the branch listing.
+type branchEntry struct {
+	ref mygit.Ref
+	// name is the displayed name: the short name of a branch, or the
+	// description of a detached HEAD.
+	name    string
+	current bool
+	local   bool
+}
+
+// listBranches prints the local branches, or the remote-tracking ones, or
+// both, whose short names match one of the patterns.
+func listBranches(patterns []string, opts branchOptions) {
+	var prefixes []string
+	if !opts.remotes || opts.all {
+		prefixes = append(prefixes, "refs/heads/")
+	}
+	if opts.remotes || opts.all {
+		prefixes = append(prefixes, "refs/remotes/")
+	}
+	filter := branchFilter(opts)
+	head, err := repo.ReadSymbolicRef("HEAD")
+	if err != nil {
+		fatal(err)
+	}
+	var entries []branchEntry
+	if id, err := repo.ReadRef("HEAD"); err == nil && head == "" && !opts.remotes && len(patterns) == 0 && filter(id) {
+		entries = append(entries, branchEntry{ref: mygit.Ref{Name: "HEAD", ID: id}, name: detachedName(), current: true})
+	}
+	for _, prefix := range prefixes {
+		refs, err := repo.ListRefs(prefix)
+		if err != nil {
+			fatal(err)
+		}
+		for _, ref := range refs {
+			short := strings.TrimPrefix(ref.Name, prefix)
+			if len(patterns) > 0 && !matchBranchPattern(short, patterns) || !filter(ref.ID) {
+				continue
+			}
+			e := branchEntry{ref: ref, name: short, current: ref.Name == head, local: prefix == "refs/heads/"}
+			if opts.all && !e.local {
+				e.name = "remotes/" + short
+			}
+			entries = append(entries, e)
+		}
+	}
+	width := 0
+	for _, e := range entries {
+		width = max(width, len(e.name))
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for _, e := range entries {
+		marker := ' '
+		if e.current {
+			marker = '*'
+		}
+		line := fmt.Sprintf("%c %s", marker, e.name)
+		switch {
+		case e.ref.Symbolic():
+			if opts.verbose > 0 {
+				line = fmt.Sprintf("%c %-*s", marker, width, e.name)
+			}
+			line += " -> " + repo.ShortRefName(e.ref.Target)
+		case opts.verbose > 0:
+			line = fmt.Sprintf("%c %-*s %s ", marker, width, e.name, repo.Abbreviate(e.ref.ID, 7))
+			if e.local {
+				if track := trackingInfo(e.name, e.ref.ID, opts.verbose > 1); track != "" {
+					line += track + " "
+				}
+			}
+			if c, err := repo.ReadCommit(e.ref.ID); err == nil {
+				line += c.Subject()
+			}
+		}
+		fmt.Fprintln(out, line)
+	}
+}
+
+// branchFilter returns a function reporting whether a branch tip passes
+// --contains, --merged and --no-merged.
+func branchFilter(opts branchOptions) func(odb.ID) bool {
+	var contains, merged, noMerged odb.ID
+	if opts.contains != "" {
+		contains = resolveAs(opts.contains, odb.Commit)
+	}
+	if opts.merged != "" {
+		merged = resolveAs(opts.merged, odb.Commit)
+	}
+	if opts.noMerged != "" {
+		noMerged = resolveAs(opts.noMerged, odb.Commit)
+	}
+	return func(id odb.ID) bool {
+		if !contains.IsZero() {
+			if ok, err := repo.IsAncestor(contains, id); err != nil || !ok {
+				return false
+			}
+		}
+		if !merged.IsZero() {
+			if ok, err := repo.IsAncestor(id, merged); err != nil || !ok {
+				return false
+			}
+		}
+		if !noMerged.IsZero() {
+			if ok, err := repo.IsAncestor(id, noMerged); err != nil || ok {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// matchBranchPattern reports whether a short branch name matches one of
+// the --list patterns.
+func matchBranchPattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if re, err := wildmatch.Compile(pattern, false); err == nil && re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// detachedName describes a detached HEAD in the branch listing.
+func detachedName() string {
+	name, at, err := repo.DetachedFrom()
+	switch {
+	case err != nil || name == "":
+		return "(no branch)"
+	case at:
+		return "(HEAD detached at " + name + ")"
+	}
+	return "(HEAD detached from " + name + ")"
+}
+
+// trackingInfo describes how a branch compares with its upstream, as
+// "[ahead 1, behind 2]", or "[origin/main: ahead 1]" with the upstream
+// name. It is empty for a branch without upstream, and for one that is up
+// to date unless the name is shown.
+func trackingInfo(branch string, id odb.ID, showName bool) string {
+	upstream, err := repo.Upstream(branch)
+	if err != nil {
+		return ""
+	}
+	var counts []string
+	if tip, err := repo.ReadRef(upstream); err != nil {
+		counts = append(counts, "gone")
+	} else if ahead, behind, err := repo.AheadBehind(id, tip); err == nil {
+		if ahead > 0 {
+			counts = append(counts, fmt.Sprintf("ahead %d", ahead))
+		}
+		if behind > 0 {
+			counts = append(counts, fmt.Sprintf("behind %d", behind))
+		}
+	}
+	info := strings.Join(counts, ", ")
+	if showName {
+		name := repo.ShortRefName(upstream)
+		if info == "" {
+			return "[" + name + "]"
+		}
+		return "[" + name + ": " + info + "]"
+	}
+	if info == "" {
+		return ""
+	}
+	return "[" + info + "]"
+}
+
+// createBranch creates a branch at a start point, HEAD by default, and sets
+// up tracking as setupTracking does.
+func createBranch(name, startPoint string, force bool, track, noTrack bool) {
+	if err := mygit.CheckBranchName(name); err != nil {
+		fatal(fmt.Errorf("'%s' is not a valid branch name", name))
+	}
+	if startPoint == "" {
+		startPoint = "HEAD"
+	}
+	_, err := repo.CreateBranch(name, startPoint, force)
+	if errors.Is(err, mygit.ErrBranchExists) {
+		fatal(fmt.Errorf("a branch named '%s' already exists", name))
+	} else if err != nil {
+		fatal(err)
+	}
+	setupTracking(name, startPoint, track, noTrack)
+}
+
+// setupTracking makes a new branch track its start point if it is a
+// remote-tracking branch, unless noTrack is set or branch.autoSetupMerge
+// is false; with track set, a local start branch is tracked too.
+func setupTracking(name, startPoint string, track, noTrack bool) {
+	if noTrack {
+		return
+	}
+	upstream, err := repo.ExpandRefName(startPoint)
+	if err != nil {
+		return
+	}
+	autoSetup := true
+	if cfg, err := repo.Config(); err == nil {
+		if value, ok := cfg.Get("branch.autosetupmerge"); ok {
+			if value == "always" {
+				track = true
+			} else if enabled, err := config.ParseBool(value); err == nil {
+				autoSetup = enabled
+			}
+		}
+	}
+	if strings.HasPrefix(upstream, "refs/remotes/") && (autoSetup || track) ||
+		strings.HasPrefix(upstream, "refs/heads/") && track {
+		setUpstream(name, upstream)
+	}
+}
+
+// setUpstream records that a branch tracks a full ref name.
+func setUpstream(branch, upstream string) {
+	if err := repo.SetUpstream(branch, upstream); err != nil {
+		fatal(err)
+	}
+	fmt.Printf("branch '%s' set up to track '%s'.\n", branch, repo.ShortRefName(upstream))
+}
+
+// setUpstreamTo makes a branch, the current one by default, track an
+// existing branch.
+func setUpstreamTo(upstream, branch string) {
+	branch = branchArg(branch)
+	upstreamRef, err := repo.ExpandRefName(upstream)
+	if err != nil || !strings.HasPrefix(upstreamRef, "refs/heads/") && !strings.HasPrefix(upstreamRef, "refs/remotes/") {
+		fatal(fmt.Errorf("the requested upstream branch '%s' does not exist", upstream))
+	}
+	setUpstream(branch, upstreamRef)
+}
+
+// unsetUpstream removes the upstream of a branch, the current one by
+// default.
+func unsetUpstream(branch string) {
+	branch = branchArg(branch)
+	err := repo.UnsetUpstream(branch)
+	if errors.Is(err, mygit.ErrNoUpstream) {
+		fatal(fmt.Errorf("branch '%s' has no upstream information", branch))
+	} else if err != nil {
+		fatal(err)
+	}
+}
+
+// branchArg returns an existing branch named by an argument, or the
+// current branch if the argument is empty.
+func branchArg(branch string) string {
+	if branch == "" {
+		current, err := repo.CurrentBranch()
+		if err != nil {
+			fatal(err)
+		}
+		if current == "" {
+			fatal(errors.New("HEAD does not point to a branch"))
+		}
+		return current
+	}
+	if _, err := repo.ReadRef("refs/heads/" + branch); err != nil {
+		fatal(fmt.Errorf("branch '%s' does not exist", branch))
+	}
+	return branch
+}
+
+// deleteBranches deletes branches, reporting each failure and exiting with
+// status 1 after trying all of them.
+func deleteBranches(names []string, force bool) {
+	failed := false
+	for _, name := range names {
+		id, err := repo.DeleteBranch(name, force)
+		switch {
+		case errors.Is(err, mygit.ErrRefNotFound):
+			err = fmt.Errorf("branch '%s' not found", name)
+		case errors.Is(err, mygit.ErrBranchCheckedOut):
+			err = fmt.Errorf("cannot delete branch '%s' checked out at '%s'", name, repo.WorkDir)
+		case errors.Is(err, mygit.ErrNotMerged):
+			err = fmt.Errorf("the branch '%s' is not fully merged.\n"+
+				"If you are sure you want to delete it, run 'mygit branch -D %s'", name, name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			failed = true
+			continue
+		}
+		fmt.Printf("Deleted branch %s (was %s).\n", name, repo.Abbreviate(id, 7))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// renameBranch renames a branch, or the current branch if args holds only
+// the new name.
+func renameBranch(args []string, force bool) {
+	oldName, newName := "", args[len(args)-1]
+	if len(args) == 2 {
+		oldName = args[0]
+	} else {
+		current, err := repo.CurrentBranch()
+		if err != nil {
+			fatal(err)
+		}
+		if current == "" {
+			fatal(errors.New("cannot rename the current branch while not on any"))
+		}
+		oldName = current
+	}
+	if err := mygit.CheckBranchName(newName); err != nil {
+		fatal(fmt.Errorf("'%s' is not a valid branch name", newName))
+	}
+	err := repo.RenameBranch(oldName, newName, force)
+	switch {
+	case errors.Is(err, mygit.ErrRefNotFound):
+		fatal(fmt.Errorf("no branch named '%s'", oldName))
+	case errors.Is(err, mygit.ErrBranchExists):
+		fatal(fmt.Errorf("a branch named '%s' already exists", newName))
+	case err != nil:
+		fatal(err)
+	}
+}
+
+// showCurrentBranch prints the name of the current branch, or nothing if
+// HEAD is detached.
+func showCurrentBranch() {
+	current, err := repo.CurrentBranch()
+	if err != nil {
+		fatal(err)
+	}
+	if current != "" {
+		fmt.Println(current)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/mygit"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+type switchOptions struct {
+	// create names a branch to create at the target; forceCreate resets
+	// it if it exists.
+	create      string
+	forceCreate bool
+	detach      bool
+	force       bool
+	// allowCommit lets a target that is not a branch detach HEAD, as
+	// checkout does.
+	allowCommit bool
+}
+
+// switchTo checks out a branch or, with opts.detach or opts.allowCommit, a
+// commit. A name that is not a local branch but matches a branch of
+// exactly one remote creates a local branch tracking it.
+func switchTo(target string, opts switchOptions) {
+	if opts.create != "" {
+		if target == "" {
+			target = "HEAD"
+		}
+		if err := mygit.CheckBranchName(opts.create); err != nil {
+			fatal(fmt.Errorf("'%s' is not a valid branch name", opts.create))
+		}
+		_, err := repo.ReadRef("refs/heads/" + opts.create)
+		existed := err == nil
+		err = repo.SwitchNewBranch(opts.create, target, opts.forceCreate, opts.force)
+		if errors.Is(err, mygit.ErrBranchExists) {
+			fatal(fmt.Errorf("a branch named '%s' already exists", opts.create))
+		} else if err != nil {
+			checkoutFailed(err)
+		}
+		setupTracking(opts.create, target, false, false)
+		showLocalChanges()
+		if existed {
+			fmt.Fprintf(os.Stderr, "Switched to and reset branch '%s'\n", opts.create)
+		} else {
+			fmt.Fprintf(os.Stderr, "Switched to a new branch '%s'\n", opts.create)
+		}
+		return
+	}
+	if target == "" && opts.detach {
+		target = "HEAD"
+	}
+	if target == "" || target == "HEAD" && !opts.detach {
+		// Checking out HEAD only reports the local changes.
+		showLocalChanges()
+		return
+	}
+	_, err := repo.ReadRef("refs/heads/" + target)
+	isBranch := err == nil && mygit.CheckBranchName(target) == nil
+	switch {
+	case opts.detach:
+		detachHead(target, opts.force)
+	case isBranch:
+		if current, _ := repo.CurrentBranch(); current == target {
+			showLocalChanges()
+			fmt.Fprintf(os.Stderr, "Already on '%s'\n", target)
+			return
+		}
+		switchBranch(target, opts.force)
+		fmt.Fprintf(os.Stderr, "Switched to branch '%s'\n", target)
+	default:
+		if remote := guessRemoteBranch(target); remote != "" {
+			// The branch is only created, and set up to track the
+			// remote one, once the checkout succeeded.
+			startPoint := repo.ShortRefName(remote)
+			if err := repo.SwitchNewBranch(target, startPoint, false, opts.force); err != nil {
+				checkoutFailed(err)
+			}
+			setupTracking(target, startPoint, true, false)
+			showLocalChanges()
+			fmt.Fprintf(os.Stderr, "Switched to a new branch '%s'\n", target)
+			return
+		}
+		if _, err := repo.ResolveRevision(target); err != nil {
+			fatal(fmt.Errorf("invalid reference: %s", target))
+		}
+		if !opts.allowCommit {
+			fatal(fmt.Errorf("a branch is expected, got '%s'; use --detach to check out a commit", target))
+		}
+		detachHead(target, opts.force)
+	}
+}
+
+// guessRemoteBranch returns the remote-tracking branch named like a
+// branch on exactly one remote, or the empty string.
+func guessRemoteBranch(name string) string {
+	refs, err := repo.ListRefs("refs/remotes/")
+	if err != nil {
+		fatal(err)
+	}
+	found := ""
+	for _, ref := range refs {
+		if ref.Symbolic() || !strings.HasSuffix(ref.Name, "/"+name) || strings.Count(strings.TrimPrefix(ref.Name, "refs/remotes/"), "/") != strings.Count(name, "/")+1 {
+			continue
+		}
+		if found != "" {
+			return ""
+		}
+		found = ref.Name
+	}
+	return found
+}
+
+// switchBranch checks out an existing branch and lists the local changes
+// carried over.
+func switchBranch(name string, force bool) {
+	if err := repo.SwitchBranch(name, force); err != nil {
+		checkoutFailed(err)
+	}
+	showLocalChanges()
+}
+
+// detachHead checks out a commit on a detached HEAD, reporting the
+// previous commit if HEAD was detached already.
+func detachHead(rev string, force bool) {
+	previous := odb.ID{}
+	if current, err := repo.CurrentBranch(); err == nil && current == "" {
+		previous, _ = repo.ReadRef("HEAD")
+	}
+	if err := repo.DetachHead(rev, force); err != nil {
+		checkoutFailed(err)
+	}
+	head, err := repo.ReadRef("HEAD")
+	if err != nil {
+		fatal(err)
+	}
+	showLocalChanges()
+	if !previous.IsZero() && previous != head {
+		fmt.Fprintf(os.Stderr, "Previous HEAD position was %s\n", commitLine(previous))
+	}
+	fmt.Fprintf(os.Stderr, "HEAD is now at %s\n", commitLine(head))
+}
+
+// commitLine describes a commit by its abbreviated name and subject.
+func commitLine(id odb.ID) string {
+	c, err := repo.ReadCommit(id)
+	if err != nil {
+		fatal(err)
+	}
+	return repo.Abbreviate(id, 7) + " " + c.Subject()
+}
+
+// checkoutFailed reports a checkout that would lose local changes or
+// untracked files, or another error.
+func checkoutFailed(err error) {
+	switch {
+	case errors.Is(err, mygit.ErrLocalChanges):
+		fatal(fmt.Errorf("%w\nPlease commit your changes or stash them before you switch branches", err))
+	case errors.Is(err, mygit.ErrUntrackedFiles):
+		fatal(fmt.Errorf("%w\nPlease move or remove them before you switch branches", err))
+	}
+	fatal(err)
+}
+
+// showLocalChanges lists the paths whose index or working tree content
+// differs from HEAD after a checkout.
+func showLocalChanges() {
+	st, err := repo.Status(mygit.StatusOptions{Untracked: mygit.UntrackedNo})
+	if err != nil {
+		fatal(err)
+	}
+	for _, f := range st.Files {
+		code := f.Staged
+		if code == mygit.StatusUnmodified {
+			code = f.Unstaged
+		}
+		fmt.Printf("%c\t%s\n", code, displayPath(f.Path))
+	}
+}
+
+// checkoutPaths restores paths in the working tree from the index or, if
+// rev is set, in the index and the working tree from a commit. Files
+// missing from the commit are kept.
+func checkoutPaths(rev string, paths []string) {
+	opts := mygit.RestoreOptions{Worktree: true}
+	if rev != "" {
+		opts = mygit.RestoreOptions{Source: rev, Staged: true, Worktree: true, Overlay: true}
+	}
+	if err := repo.Restore(pathspecs(paths), opts); err != nil {
+		fatal(err)
+	}
+}
+
+// checkout runs checkout with the arguments before and after "--". Without
+// "--", the first argument is a branch or commit if it resolves to one
+// and paths otherwise.
+func checkout(args, paths []string, dashdash bool, opts switchOptions) {
+	if !dashdash && len(args) > 0 {
+		if _, err := repo.ResolveRevision(args[0]); err != nil && guessRemoteBranch(args[0]) == "" {
+			args, paths = nil, args
+		} else {
+			args, paths = args[:1], args[1:]
+		}
+	}
+	if len(args) > 1 {
+		fatal(fmt.Errorf("only one reference expected, %d given", len(args)))
+	}
+	rev := ""
+	if len(args) == 1 {
+		rev = args[0]
+	}
+	if len(paths) > 0 || dashdash && opts.create == "" && !opts.detach && rev == "" {
+		if opts.create != "" || opts.detach {
+			fatal(errors.New("cannot update paths and switch to a branch at the same time"))
+		}
+		if len(paths) == 0 {
+			fatal(errors.New("you must specify path(s) to restore"))
+		}
+		checkoutPaths(rev, paths)
+		return
+	}
+	opts.allowCommit = true
+	switchTo(rev, opts)
+}
+
+func restore(paths []string, opts mygit.RestoreOptions) {
+	if len(paths) == 0 {
+		fatal(errors.New("you must specify path(s) to restore"))
+	}
+	if err := repo.Restore(pathspecs(paths), opts); err != nil {
+		fatal(err)
+	}
+}
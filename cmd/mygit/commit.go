@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/diff"
+	"github.com/codecrafters-io/git-starter-go/pkg/mygit"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// stringsFlag collects the values of a flag that may be repeated.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string { return strings.Join(*s, ", ") }
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func commit(messages []string, file string, amend, allowEmpty bool) {
+	// Each -m is a separate paragraph.
+	message := strings.Join(messages, "\n\n")
+	if file != "" {
+		var data []byte
+		var err error
+		if file == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(file)
+		}
+		if err != nil {
+			fatal(err)
+		}
+		message = string(data)
+	}
+	if mygit.CleanupMessage(message) == "" && !amend {
+		fmt.Fprintln(os.Stderr, "Aborting commit due to empty commit message.")
+		os.Exit(1)
+	}
+	id, err := repo.Commit(message, mygit.CommitOptions{Amend: amend, AllowEmpty: allowEmpty})
+	if errors.Is(err, mygit.ErrNothingToCommit) {
+		status(nil, statusOptions{})
+		os.Exit(1)
+	} else if err != nil {
+		fatal(err)
+	}
+	c, err := repo.ReadCommit(id)
+	if err != nil {
+		fatal(err)
+	}
+	branch, err := repo.ReadSymbolicRef("HEAD")
+	if err != nil {
+		fatal(err)
+	}
+	where := strings.TrimPrefix(branch, "refs/heads/")
+	if branch == "" {
+		where = "detached HEAD"
+	}
+	if len(c.Parents) == 0 {
+		where += " (root-commit)"
+	}
+	fmt.Printf("[%s %s] %s\n", where, repo.Abbreviate(id, 7), c.Subject())
+	var parentTree odb.ID
+	if len(c.Parents) > 0 {
+		parentTree = resolveAs(c.Parents[0].String(), odb.Tree)
+	}
+	printDiffSummary(parentTree, c.Tree)
+}
+
+// printDiffSummary prints the changed file and line counts between two
+// trees and the files created, deleted or changing mode, as git prints them
+// after a commit.
+func printDiffSummary(from, to odb.ID) {
+	changes, err := repo.DiffTrees(from, to)
+	if err != nil {
+		fatal(err)
+	}
+	if len(changes) == 0 {
+		return
+	}
+	insertions, deletions := 0, 0
+	for _, change := range changes {
+		a, b := blobLines(change.Old), blobLines(change.New)
+		if a == nil && change.Old.Mode != 0 || b == nil && change.New.Mode != 0 {
+			continue
+		}
+		for _, line := range diff.Diff(a, b) {
+			switch line.Op {
+			case diff.Insert:
+				insertions++
+			case diff.Delete:
+				deletions++
+			}
+		}
+	}
+	summary := fmt.Sprintf(" %d %s changed", len(changes), plural(len(changes), "file", "files"))
+	if insertions > 0 || deletions == 0 {
+		summary += fmt.Sprintf(", %d %s(+)", insertions, plural(insertions, "insertion", "insertions"))
+	}
+	if deletions > 0 || insertions == 0 {
+		summary += fmt.Sprintf(", %d %s(-)", deletions, plural(deletions, "deletion", "deletions"))
+	}
+	fmt.Println(summary)
+	for _, change := range changes {
+		switch {
+		case change.Old.Mode == 0:
+			fmt.Printf(" create mode %06o %s\n", uint32(change.New.Mode), change.Path)
+		case change.New.Mode == 0:
+			fmt.Printf(" delete mode %06o %s\n", uint32(change.Old.Mode), change.Path)
+		case change.Old.Mode != change.New.Mode:
+			fmt.Printf(" mode change %06o => %06o %s\n", uint32(change.Old.Mode), uint32(change.New.Mode), change.Path)
+		}
+	}
+}
+
+// blobLines returns the lines of a text blob, an empty slice if the entry
+// does not exist, and nil for binary blobs and submodules.
+func blobLines(entry mygit.TreeEntry) []string {
+	if entry.Mode == 0 {
+		return []string{}
+	}
+	if entry.Mode == mygit.ModeGitlink {
+		return nil
+	}
+	_, data, err := repo.ReadObject(entry.ID)
+	if err != nil {
+		fatal(err)
+	}
+	// Like git, treat content with a NUL byte in its first 8000 bytes as
+	// binary.
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return nil
+	}
+	return diff.Lines(data)
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
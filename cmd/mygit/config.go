@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/config"
+	"github.com/codecrafters-io/git-starter-go/pkg/mygit"
+)
+
+type configOptions struct {
+	// scope selects a single file to read or write; zero reads all
+	// scopes and writes the repository's file.
+	scope      config.Scope
+	file       string
+	showOrigin bool
+	showScope  bool
+}
+
+// configure runs a config action: get, get-all, get-regexp, list, set, add,
+// replace-all, unset or unset-all.
+func configure(action string, args []string, opts configOptions) {
+	if r, err := mygit.Discover("."); err == nil {
+		repo = r
+		defer repo.Close()
+	}
+	switch action {
+	case "get", "get-all":
+		configGet(args[0], action == "get-all", opts)
+	case "get-regexp":
+		re, err := regexp.Compile(args[0])
+		if err != nil {
+			fatal(err)
+		}
+		found := false
+		for _, e := range configEntries(opts) {
+			if re.MatchString(e.Key) {
+				found = true
+				printConfigEntry(e, " ", opts)
+			}
+		}
+		if !found {
+			os.Exit(1)
+		}
+	case "list":
+		for _, e := range configEntries(opts) {
+			printConfigEntry(e, "=", opts)
+		}
+	default:
+		configWrite(action, args, opts)
+	}
+}
+
+// configGet prints the last value of a key, or all values, and exits with
+// status 1 if the key is not set.
+func configGet(key string, all bool, opts configOptions) {
+	canonical, err := config.CanonicalKey(key)
+	if err != nil {
+		fatal(err)
+	}
+	var values []string
+	for _, e := range configEntries(opts) {
+		if e.Key == canonical {
+			values = append(values, e.Value)
+		}
+	}
+	if len(values) == 0 {
+		os.Exit(1)
+	}
+	if !all {
+		values = values[len(values)-1:]
+	}
+	for _, value := range values {
+		fmt.Println(value)
+	}
+}
+
+// configWrite modifies a single configuration file. Like git, it exits with
+// status 5 if the key to unset or replace does not have exactly one value.
+func configWrite(action string, args []string, opts configOptions) {
+	f, err := config.ReadFile(configPath(opts))
+	if err != nil {
+		fatal(err)
+	}
+	switch action {
+	case "set":
+		err = f.Set(args[0], args[1])
+	case "add":
+		err = f.Add(args[0], args[1])
+	case "replace-all":
+		err = f.ReplaceAll(args[0], args[1])
+	case "unset":
+		err = f.Unset(args[0])
+	case "unset-all":
+		err = f.UnsetAll(args[0])
+	}
+	if errors.Is(err, config.ErrNotSet) || errors.Is(err, config.ErrMultipleValues) {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(5)
+	} else if err != nil {
+		fatal(err)
+	}
+	if err := f.Write(); err != nil {
+		fatal(err)
+	}
+}
+
+// configPath returns the file selected by --file or a scope option,
+// defaulting to the repository's config file.
+func configPath(opts configOptions) string {
+	if opts.file != "" {
+		return opts.file
+	}
+	switch opts.scope {
+	case config.ScopeSystem:
+		return config.SystemPath()
+	case config.ScopeGlobal:
+		return config.GlobalPath()
+	}
+	if repo == nil {
+		fatal(mygit.ErrNotARepository)
+	}
+	return repo.ConfigPath(config.ScopeLocal)
+}
+
+// configEntries returns the entries of the selected file, or of all scopes
+// if none is selected.
+func configEntries(opts configOptions) []config.Entry {
+	if opts.file == "" && opts.scope == 0 {
+		var c *config.Config
+		var err error
+		if repo != nil {
+			c, err = repo.Config()
+		} else {
+			c, err = config.Load(config.Context{})
+		}
+		if err != nil {
+			fatal(err)
+		}
+		return c.Entries()
+	}
+	f, err := config.ReadFile(configPath(opts))
+	if err != nil {
+		fatal(err)
+	}
+	entries := f.Entries()
+	for i := range entries {
+		entries[i].Scope = opts.scope
+		if opts.file != "" {
+			entries[i].Scope = config.ScopeCommand
+		}
+	}
+	return entries
+}
+
+// printConfigEntry prints an entry as key, separator and value, or just the
+// key for an implicit boolean.
+func printConfigEntry(e config.Entry, sep string, opts configOptions) {
+	if opts.showScope {
+		fmt.Printf("%s\t", e.Scope)
+	}
+	if opts.showOrigin {
+		origin := e.Origin
+		if cwd, err := os.Getwd(); err == nil && e.Scope == config.ScopeLocal {
+			if rel, err := filepath.Rel(cwd, origin); err == nil {
+				origin = rel
+			}
+		}
+		fmt.Printf("file:%s\t", origin)
+	}
+	if e.Implicit {
+		fmt.Println(e.Key)
+		return
+	}
+	fmt.Printf("%s%s%s\n", e.Key, sep, e.Value)
+}
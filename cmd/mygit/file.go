@@ -1,65 +1,176 @@
 package main
 
 import (
-	"bytes"
-	"compress/zlib"
-	"crypto/sha256"
-	"os"
+	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/mygit"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
 )
 
-func catFile(hash string) {
-	path := fmt.Sprintf(".git/objects/%s/%s", hash[:2], hash[2:])
-	file, err := os.Open(path)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading file: %s\n", err)
-		os.Exit(1)
+// catFile prints information about an object. mode is one of "t" (type),
+// "s" (size), "e" (exit status only), "p" (pretty-print) or an object type
+// name, in which case the raw content is printed if the object has that
+// type.
+func catFile(mode, rev string) {
+	id := resolve(rev)
+	if mode == "e" {
+		if !repo.Objects.Has(id) {
+			os.Exit(1)
+		}
+		if _, _, err := repo.ReadObject(id); err != nil {
+			fatal(err)
+		}
+		return
 	}
-	defer file.Close()
-	r, err := zlib.NewReader(file)
+	t, data, err := repo.ReadObject(id)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating zlib reader: %s\n", err)
-		os.Exit(1)
+		fatal(err)
 	}
-	defer r.Close()
-	data, err := io.ReadAll(r)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading data: %s\n", err)
-		os.Exit(1)
+	switch mode {
+	case "t":
+		fmt.Println(t)
+	case "s":
+		fmt.Println(len(data))
+	case "p":
+		if t == odb.Tree {
+			entries, err := mygit.ParseTree(data, repo.Hash)
+			if err != nil {
+				fatal(err)
+			}
+			for _, entry := range entries {
+				printTreeEntry(entry)
+			}
+			return
+		}
+		// Blobs are written unmodified so that binary content, including
+		// NUL bytes, survives; commits and tags are already text.
+		os.Stdout.Write(data)
+	default:
+		if t.String() != mode {
+			fatal(fmt.Errorf("%s: expected %s, found %s", id, mode, t))
+		}
+		os.Stdout.Write(data)
 	}
-	fmt.Print(string(bytes.Split(data, []byte{0})[1]))
 }
 
-func hashObject(filename string) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading data: %s\n", err)
-		os.Exit(1)
+// catFileBatch reads object names from r, one per line, and prints
+// "<oid> <type> <size>" for each, followed by the content and a newline
+// when withContent is set. Unknown names are reported as "<name> missing".
+func catFileBatch(r io.Reader, withContent bool) {
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		id, err := repo.ResolveRevision(name)
+		if errors.Is(err, mygit.ErrAmbiguousObject) {
+			fmt.Fprintf(out, "%s ambiguous\n", name)
+			out.Flush()
+			continue
+		} else if err != nil {
+			fmt.Fprintf(out, "%s missing\n", name)
+			out.Flush()
+			continue
+		}
+		catFileRecord(out, id, name, withContent)
+		// Flush per record so that callers can interleave requests and
+		// responses over a pipe.
+		out.Flush()
 	}
-	input := []byte(fmt.Sprintf("blob %d\x00", len(data)))
-	input = append(input, data...)
-	hash := fmt.Sprintf("%x", sha256.Sum256(data))
-	folder := fmt.Sprintf(".git/objects/%s", hash[:2])
-	path := fmt.Sprintf("%s/%s", folder, hash[2:])
-	err = os.Mkdir(folder, 0750)
-	if err != nil && !os.IsExist(err) {
-		fmt.Fprintf(os.Stderr, "Error creating directory: %s\n", err)
-		os.Exit(1)
+	if err := scanner.Err(); err != nil {
+		out.Flush()
+		fatal(err)
 	}
-	file, err := os.Create(path)
+}
+
+// catFileAll prints a batch record for every object in the repository.
+func catFileAll(withContent bool) {
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	err := repo.Objects.Iterate(func(id odb.ID) error {
+		catFileRecord(out, id, id.String(), withContent)
+		return nil
+	})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating file: %s\n", err)
-		os.Exit(1)
+		out.Flush()
+		fatal(err)
 	}
-	defer file.Close()
-	w := zlib.NewWriter(file)
-	_, err = w.Write(input)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error compressing data: %s\n", err)
-		os.Exit(1)
+}
+
+func catFileRecord(out *bufio.Writer, id odb.ID, name string, withContent bool) {
+	t, data, err := repo.ReadObject(id)
+	if errors.Is(err, mygit.ErrObjectNotFound) {
+		fmt.Fprintf(out, "%s missing\n", name)
+		return
+	} else if err != nil {
+		out.Flush()
+		fatal(err)
+	}
+	fmt.Fprintf(out, "%s %s %d\n", id, t, len(data))
+	if withContent {
+		out.Write(data)
+		out.WriteByte('\n')
 	}
-	w.Close()
-	fmt.Println(hash)
 }
 
+// hashObject prints the names of objects of the given type built from the
+// named files, from stdin with useStdin, or from files whose paths are read
+// from stdin with stdinPaths. Objects are stored only if write is set.
+// Content is validated against the type unless literally is set, which
+// also allows any type name.
+func hashObject(paths []string, typeName string, write, useStdin, stdinPaths, literally bool) {
+	t, err := odb.ParseType(typeName)
+	if err != nil && !literally {
+		fatal(err)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	hash := func(data []byte) {
+		var id odb.ID
+		var err error
+		if literally {
+			id, err = repo.HashObjectLiterally(typeName, data, write)
+		} else {
+			id, err = repo.HashObject(t, data, write)
+		}
+		if err != nil {
+			out.Flush()
+			fatal(err)
+		}
+		fmt.Fprintln(out, id)
+	}
+	hashFile := func(path string) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			out.Flush()
+			fatal(err)
+		}
+		hash(data)
+	}
+
+	if useStdin {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fatal(err)
+		}
+		hash(data)
+	}
+	for _, path := range paths {
+		hashFile(path)
+	}
+	if stdinPaths {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			hashFile(scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			out.Flush()
+			fatal(err)
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/internal/wildmatch"
+	"github.com/codecrafters-io/git-starter-go/pkg/mygit"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// defaultRefFormat is the for-each-ref output without --format.
+const defaultRefFormat = "%(objectname) %(objecttype)\t%(refname)"
+
+type forEachRefOptions struct {
+	format string
+	// sort holds the sort keys; the last one is the primary key.
+	sort     []string
+	count    int
+	pointsAt string
+}
+
+// forEachRef prints the refs matching patterns. A pattern matches a ref
+// if it is a glob matching the whole name, or the name itself or one of
+// its leading directories. Refs pointing to missing objects are skipped
+// with a warning.
+func forEachRef(patterns []string, opts forEachRefOptions) {
+	all, err := repo.ListRefs("refs/")
+	if err != nil {
+		fatal(err)
+	}
+	var pointsAt odb.ID
+	if opts.pointsAt != "" {
+		pointsAt = resolve(opts.pointsAt)
+	}
+	f := &refFormatter{objects: make(map[odb.ID]*refObject)}
+	f.head, _ = repo.ReadSymbolicRef("HEAD")
+	var refs []mygit.Ref
+	for _, ref := range all {
+		if len(patterns) > 0 && !matchRefPattern(ref.Name, patterns) {
+			continue
+		}
+		if !repo.Objects.Has(ref.ID) {
+			fmt.Fprintf(os.Stderr, "warning: ignoring broken ref %s\n", ref.Name)
+			continue
+		}
+		if !pointsAt.IsZero() {
+			if peeled, _ := repo.PeelRef(ref); ref.ID != pointsAt && peeled != pointsAt {
+				continue
+			}
+		}
+		refs = append(refs, ref)
+	}
+	keys := opts.sort
+	if len(keys) == 0 {
+		keys = []string{"refname"}
+	}
+	for _, key := range keys {
+		reverse := strings.HasPrefix(key, "-")
+		atom := strings.TrimPrefix(key, "-")
+		values := make(map[string]string, len(refs))
+		for _, ref := range refs {
+			if values[ref.Name], err = f.sortValue(ref, atom); err != nil {
+				fatal(err)
+			}
+		}
+		sort.SliceStable(refs, func(i, j int) bool {
+			a, b := values[refs[i].Name], values[refs[j].Name]
+			if reverse {
+				return b < a
+			}
+			return a < b
+		})
+	}
+	if opts.count > 0 && len(refs) > opts.count {
+		refs = refs[:opts.count]
+	}
+	format := opts.format
+	if format == "" {
+		format = defaultRefFormat
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for _, ref := range refs {
+		line, err := f.format(format, ref)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Fprintln(out, line)
+	}
+}
+
+// matchRefPattern reports whether a ref name matches one of the
+// for-each-ref patterns.
+func matchRefPattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		dir := strings.TrimSuffix(pattern, "/")
+		if name == pattern || strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+		if re, err := wildmatch.Compile(pattern, false); err == nil && re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// refObject is a decoded object that format atoms refer to.
+type refObject struct {
+	t      odb.Type
+	size   int
+	commit *mygit.Commit
+	tag    *mygit.Tag
+}
+
+// refFormatter expands the %(atom) placeholders of a for-each-ref format,
+// reading each object at most once.
+type refFormatter struct {
+	// head is the ref HEAD points to.
+	head    string
+	objects map[odb.ID]*refObject
+}
+
+// ifBlock is a %(if)...%(then)...%(else)...%(end) being expanded. text
+// collects the condition, then the part after %(then) and then the part
+// after %(else).
+type ifBlock struct {
+	// arg is the argument of %(if), such as "equals=<string>".
+	arg       string
+	text      strings.Builder
+	condition string
+	then      string
+	seenThen  bool
+	seenElse  bool
+}
+
+// value returns the part of a complete block chosen by its condition: a
+// condition that is not blank, or with equals= or notequals= one that is
+// or is not the given string, chooses the part after %(then).
+func (b *ifBlock) value() string {
+	then, otherwise := b.then, b.text.String()
+	if !b.seenElse {
+		then, otherwise = b.text.String(), ""
+	}
+	chosen := strings.TrimSpace(b.condition) != ""
+	if s, ok := strings.CutPrefix(b.arg, "equals="); ok {
+		chosen = b.condition == s
+	} else if s, ok := strings.CutPrefix(b.arg, "notequals="); ok {
+		chosen = b.condition != s
+	}
+	if chosen {
+		return then
+	}
+	return otherwise
+}
+
+// format expands a format string for a ref. Besides atoms it accepts %%,
+// %xx, a byte in hex, and %(if)...%(then)...%(else)...%(end) blocks, which
+// may be nested and whose %(else) part is optional.
+func (f *refFormatter) format(format string, ref mygit.Ref) (string, error) {
+	// The innermost block collects the output; the outermost one is the
+	// whole format.
+	blocks := []*ifBlock{{}}
+	for i := 0; i < len(format); i++ {
+		block := blocks[len(blocks)-1]
+		sb := &block.text
+		c := format[i]
+		if c != '%' || i+1 == len(format) {
+			sb.WriteByte(c)
+			continue
+		}
+		switch rest := format[i+1:]; {
+		case rest[0] == '%':
+			sb.WriteByte('%')
+			i++
+		case rest[0] == '(':
+			closing := strings.IndexByte(rest, ')')
+			if closing < 0 {
+				return "", fmt.Errorf("malformed format string %s", format)
+			}
+			atom := rest[1:closing]
+			i += closing + 1
+			inBlock := len(blocks) > 1
+			switch name, arg, _ := strings.Cut(atom, ":"); name {
+			case "if":
+				if arg != "" && !strings.HasPrefix(arg, "equals=") && !strings.HasPrefix(arg, "notequals=") {
+					return "", fmt.Errorf("unrecognized %%(if) argument: %s", arg)
+				}
+				blocks = append(blocks, &ifBlock{arg: arg})
+			case "then":
+				switch {
+				case !inBlock:
+					return "", fmt.Errorf("format: %%(then) atom used without a %%(if) atom")
+				case block.seenThen:
+					return "", fmt.Errorf("format: %%(then) atom used more than once")
+				}
+				block.condition, block.seenThen = sb.String(), true
+				sb.Reset()
+			case "else":
+				switch {
+				case !inBlock:
+					return "", fmt.Errorf("format: %%(else) atom used without a %%(if) atom")
+				case !block.seenThen:
+					return "", fmt.Errorf("format: %%(else) atom used without a %%(then) atom")
+				case block.seenElse:
+					return "", fmt.Errorf("format: %%(else) atom used more than once")
+				}
+				block.then, block.seenElse = sb.String(), true
+				sb.Reset()
+			case "end":
+				switch {
+				case !inBlock:
+					return "", fmt.Errorf("format: %%(end) atom used without corresponding atom")
+				case !block.seenThen:
+					return "", fmt.Errorf("format: %%(if) atom used without a %%(then) atom")
+				}
+				blocks = blocks[:len(blocks)-1]
+				blocks[len(blocks)-1].text.WriteString(block.value())
+			default:
+				value, err := f.atom(ref, atom)
+				if err != nil {
+					return "", err
+				}
+				sb.WriteString(value)
+			}
+		case len(rest) >= 2:
+			b, err := strconv.ParseUint(rest[:2], 16, 8)
+			if err != nil {
+				sb.WriteByte(c)
+				continue
+			}
+			sb.WriteByte(byte(b))
+			i += 2
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	if len(blocks) > 1 {
+		return "", fmt.Errorf("format: %%(end) atom missing")
+	}
+	return blocks[0].text.String(), nil
+}
+
+// sortValue returns a string that orders refs by an atom. Dates and sizes
+// are padded so that they sort numerically.
+func (f *refFormatter) sortValue(ref mygit.Ref, atom string) (string, error) {
+	name := strings.TrimPrefix(atom, "*")
+	if strings.HasSuffix(name, "date") || name == "objectsize" {
+		if !strings.Contains(atom, ":") && name != "objectsize" {
+			atom += ":unix"
+		}
+		value, err := f.atom(ref, atom)
+		if err != nil || value == "" {
+			return value, err
+		}
+		n, _ := strconv.ParseInt(value, 10, 64)
+		return fmt.Sprintf("%020d", n), nil
+	}
+	return f.atom(ref, atom)
+}
+
+// object reads and caches an object.
+func (f *refFormatter) object(id odb.ID) (*refObject, error) {
+	if obj, ok := f.objects[id]; ok {
+		return obj, nil
+	}
+	t, data, err := repo.ReadObject(id)
+	if err != nil {
+		return nil, err
+	}
+	obj := &refObject{t: t, size: len(data)}
+	switch t {
+	case odb.Commit:
+		obj.commit, err = mygit.ParseCommit(data, repo.Hash)
+	case odb.Tag:
+		obj.tag, err = mygit.ParseTag(data, repo.Hash)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", id, err)
+	}
+	f.objects[id] = obj
+	return obj, nil
+}
+
+// atom returns the value of one %(atom) for a ref. A leading * refers to
+// the object an annotated tag points to instead of the tag.
+func (f *refFormatter) atom(ref mygit.Ref, atom string) (string, error) {
+	name, arg, _ := strings.Cut(atom, ":")
+	switch name {
+	case "refname":
+		return formatRefName(ref.Name, arg)
+	case "symref":
+		if !ref.Symbolic() {
+			return "", nil
+		}
+		return formatRefName(ref.Target, arg)
+	case "HEAD":
+		if ref.Name == f.head {
+			return "*", nil
+		}
+		return " ", nil
+	case "upstream":
+		branch, ok := strings.CutPrefix(ref.Name, "refs/heads/")
+		if !ok {
+			return "", nil
+		}
+		upstream, err := repo.Upstream(branch)
+		if errors.Is(err, mygit.ErrNoUpstream) {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+		return formatRefName(upstream, arg)
+	}
+	id := ref.ID
+	if deref, ok := strings.CutPrefix(name, "*"); ok {
+		obj, err := f.object(id)
+		if err != nil {
+			return "", err
+		}
+		if obj.t != odb.Tag {
+			return "", nil
+		}
+		if id, err = repo.PeelRef(ref); err != nil {
+			return "", err
+		}
+		name = deref
+	}
+	obj, err := f.object(id)
+	if err != nil {
+		return "", err
+	}
+	switch name {
+	case "objectname":
+		switch {
+		case arg == "":
+			return id.String(), nil
+		case arg == "short":
+			return repo.Abbreviate(id, 7), nil
+		case strings.HasPrefix(arg, "short="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "short="))
+			if err != nil {
+				return "", fmt.Errorf("unrecognized %%(objectname) argument: %s", arg)
+			}
+			return repo.Abbreviate(id, n), nil
+		}
+		return "", fmt.Errorf("unrecognized %%(objectname) argument: %s", arg)
+	case "objecttype":
+		return obj.t.String(), nil
+	case "objectsize":
+		return strconv.Itoa(obj.size), nil
+	case "tree":
+		if obj.commit != nil {
+			return obj.commit.Tree.String(), nil
+		}
+		return "", nil
+	case "parent":
+		if obj.commit == nil {
+			return "", nil
+		}
+		parents := make([]string, len(obj.commit.Parents))
+		for i, p := range obj.commit.Parents {
+			parents[i] = p.String()
+		}
+		return strings.Join(parents, " "), nil
+	case "object", "type", "tag":
+		if obj.tag == nil {
+			return "", nil
+		}
+		return map[string]string{"object": obj.tag.Object.String(), "type": obj.tag.Type.String(), "tag": obj.tag.Name}[name], nil
+	case "subject", "body", "contents":
+		message := ""
+		if obj.commit != nil {
+			message = obj.commit.Message
+		} else if obj.tag != nil {
+			message = obj.tag.Message
+		}
+		if name == "contents" && arg != "" {
+			name, arg = arg, ""
+		}
+		return formatMessage(message, name)
+	}
+	for _, role := range []string{"author", "committer", "tagger", "creator"} {
+		field, ok := strings.CutPrefix(name, role)
+		if !ok {
+			continue
+		}
+		sig, ok := f.signature(obj, role)
+		if !ok {
+			return "", nil
+		}
+		switch field {
+		case "":
+			if role == "creator" {
+				break
+			}
+			return fmt.Sprintf("%s <%s> %d %s", sig.Name, sig.Email, sig.When.Unix(), sig.When.Format("-0700")), nil
+		case "name":
+			return sig.Name, nil
+		case "email":
+			switch arg {
+			case "":
+				return "<" + sig.Email + ">", nil
+			case "trim":
+				return sig.Email, nil
+			case "localpart":
+				local, _, _ := strings.Cut(sig.Email, "@")
+				return local, nil
+			}
+			return "", fmt.Errorf("unrecognized email option: %s", arg)
+		case "date":
+			return formatDate(sig.When, arg)
+		}
+	}
+	return "", fmt.Errorf("unknown field name: %s", atom)
+}
+
+// signature returns the signature of a role in an object. The creator is
+// the tagger of a tag and the committer of a commit.
+func (f *refFormatter) signature(obj *refObject, role string) (mygit.Signature, bool) {
+	switch {
+	case obj.commit != nil && role == "author":
+		return obj.commit.Author, true
+	case obj.commit != nil && (role == "committer" || role == "creator"):
+		return obj.commit.Committer, true
+	case obj.tag != nil && (role == "tagger" || role == "creator"):
+		sig, err := mygit.ParseSignature(obj.tag.Tagger)
+		return sig, err == nil
+	}
+	return mygit.Signature{}, false
+}
+
+// formatRefName applies the :short, :lstrip=<n> and :rstrip=<n> options
+// of %(refname). A negative count keeps that many components instead.
+func formatRefName(name, arg string) (string, error) {
+	switch {
+	case arg == "":
+		return name, nil
+	case arg == "short":
+		return repo.ShortRefName(name), nil
+	}
+	option, value, _ := strings.Cut(arg, "=")
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return "", fmt.Errorf("unrecognized %%(refname) argument: %s", arg)
+	}
+	components := strings.Split(name, "/")
+	if n < 0 {
+		n += len(components)
+		if n < 0 {
+			n = 0
+		}
+	}
+	if n > len(components) {
+		n = len(components)
+	}
+	switch option {
+	case "lstrip", "strip":
+		return strings.Join(components[n:], "/"), nil
+	case "rstrip":
+		return strings.Join(components[:len(components)-n], "/"), nil
+	}
+	return "", fmt.Errorf("unrecognized %%(refname) argument: %s", arg)
+}
+
+// formatMessage returns the subject, body or whole contents of a commit or
+// tag message.
+func formatMessage(message, part string) (string, error) {
+	switch part {
+	case "subject":
+		return (&mygit.Commit{Message: message}).Subject(), nil
+	case "body":
+		_, body, _ := strings.Cut(strings.TrimLeft(message, "\n"), "\n\n")
+		return strings.TrimLeft(body, "\n"), nil
+	case "contents":
+		return message, nil
+	}
+	return "", fmt.Errorf("unrecognized %%(contents) argument: %s", part)
+}
+
+// dateFormats maps the date formats of %(...date:<format>) to layouts.
+var dateFormats = map[string]string{
+	"":           "Mon Jan 2 15:04:05 2006 -0700",
+	"default":    "Mon Jan 2 15:04:05 2006 -0700",
+	"iso":        "2006-01-02 15:04:05 -0700",
+	"iso8601":    "2006-01-02 15:04:05 -0700",
+	"iso-strict": time.RFC3339,
+	"rfc":        "Mon, 2 Jan 2006 15:04:05 -0700",
+	"rfc2822":    "Mon, 2 Jan 2006 15:04:05 -0700",
+	"short":      "2006-01-02",
+}
+
+// formatDate formats a date in one of git's date formats.
+func formatDate(when time.Time, format string) (string, error) {
+	switch format {
+	case "unix":
+		return strconv.FormatInt(when.Unix(), 10), nil
+	case "raw":
+		return fmt.Sprintf("%d %s", when.Unix(), when.Format("-0700")), nil
+	}
+	layout, ok := dateFormats[format]
+	if !ok {
+		return "", fmt.Errorf("unknown date format %s", format)
+	}
+	return when.Format(layout), nil
+}
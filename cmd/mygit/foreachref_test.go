@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/mygit"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// initRefs makes repo a new repository with the branches main, tracking
+// origin/main, topic, tracking main, and plain, without an upstream, and
+// the remote-tracking branch origin/main.
+func initRefs(t *testing.T) []mygit.Ref {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "A U Thor")
+	t.Setenv("GIT_AUTHOR_EMAIL", "author@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "C O Mitter")
+	t.Setenv("GIT_COMMITTER_EMAIL", "committer@example.com")
+	var err error
+	if repo, err = mygit.Init(t.TempDir(), mygit.InitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	tree, err := repo.WriteObject(odb.Tree, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitTree(tree, nil, "initial\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"main", "topic", "plain"} {
+		if _, err := repo.CreateBranch(name, commit.String(), true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tx := repo.NewRefTransaction()
+	if err := tx.Update(mygit.RefUpdate{Name: "refs/remotes/origin/main", New: commit}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range map[string]string{
+		"remote.origin.url":   "https://example.com/repo.git",
+		"remote.origin.fetch": "+refs/heads/*:refs/remotes/origin/*",
+	} {
+		if err := repo.SetConfig(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.SetUpstream("main", "refs/remotes/origin/main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetUpstream("topic", "refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	refs, err := repo.ListRefs("refs/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return refs
+}
+
+func TestRefFormat(t *testing.T) {
+	refs := initRefs(t)
+	tests := []struct {
+		format string
+		// want holds the output for refs/heads/main, refs/heads/plain,
+		// refs/heads/topic and refs/remotes/origin/main.
+		want [4]string
+	}{
+		{"%(upstream)", [4]string{"refs/remotes/origin/main", "", "refs/heads/main", ""}},
+		{"%(upstream:short)", [4]string{"origin/main", "", "main", ""}},
+		{"%(upstream:lstrip=-1)", [4]string{"main", "", "main", ""}},
+		{
+			"%(refname:short)%(if)%(upstream)%(then) -> %(upstream:short)%(end)",
+			[4]string{"main -> origin/main", "plain", "topic -> main", "origin/main"},
+		},
+		{
+			"%(if)%(upstream)%(then)tracking%(else)none%(end)",
+			[4]string{"tracking", "none", "tracking", "none"},
+		},
+		{"%(if) %(then)blank%(else)empty%(end)", [4]string{"empty", "empty", "empty", "empty"}},
+		{
+			"%(if:equals=main)%(refname:short)%(then)=%(else)!%(end)",
+			[4]string{"=", "!", "!", "!"},
+		},
+		{
+			"%(if:notequals=main)%(refname:short)%(then)!%(end)",
+			[4]string{"", "!", "!", "!"},
+		},
+		{
+			"%(if)%(upstream)%(then)%(if:equals=main)%(upstream:short)%(then)local%(else)remote%(end)%(else)-%(end)",
+			[4]string{"remote", "-", "local", "-"},
+		},
+		{"100%% %(if)%(upstream)%(then)%41%(end)", [4]string{"100% A", "100% ", "100% A", "100% "}},
+	}
+	for _, tt := range tests {
+		f := &refFormatter{objects: make(map[odb.ID]*refObject)}
+		for i, ref := range refs {
+			got, err := f.format(tt.format, ref)
+			if err != nil || got != tt.want[i] {
+				t.Errorf("format(%q, %s) = %q, %v, want %q", tt.format, ref.Name, got, err, tt.want[i])
+			}
+		}
+	}
+
+	for _, format := range []string{
+		"%(then)",
+		"%(else)",
+		"%(end)",
+		"%(if)x",
+		"%(if)x%(end)",
+		"%(if)x%(else)y%(end)",
+		"%(if)x%(then)y%(then)%(end)",
+		"%(if)x%(then)y%(else)%(else)%(end)",
+		"%(if:contains=x)x%(then)y%(end)",
+		"%(upstream:bogus)",
+	} {
+		f := &refFormatter{objects: make(map[odb.ID]*refObject)}
+		if got, err := f.format(format, refs[0]); err == nil {
+			t.Errorf("format(%q) = %q, want an error", format, got)
+		}
+	}
+}
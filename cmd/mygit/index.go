@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/diff"
+	"github.com/codecrafters-io/git-starter-go/pkg/mygit"
+)
+
+// pathspecs converts paths relative to the current directory to
+// repository-relative paths.
+func pathspecs(paths []string) []string {
+	specs := make([]string, 0, len(paths))
+	for _, p := range paths {
+		spec, err := mygit.Pathspec(prefix, p)
+		if err != nil {
+			fatal(err)
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+func add(paths []string, all, update, force bool) {
+	if len(paths) == 0 && !all && !update {
+		fmt.Fprintln(os.Stderr, "Nothing specified, nothing added.")
+		return
+	}
+	// As in git 2.x, -A and -u without paths apply to the whole tree.
+	err := repo.Add(pathspecs(paths), mygit.AddOptions{Update: update, Force: force})
+	if errors.Is(err, mygit.ErrPathIgnored) {
+		fmt.Fprintf(os.Stderr, "%s\nUse -f if you really want to add them.\n", err)
+		os.Exit(1)
+	} else if err != nil {
+		fatal(err)
+	}
+}
+
+// addPatch interactively stages hunks of the changes to tracked files.
+func addPatch(paths []string) {
+	idx, err := repo.ReadIndex()
+	if err != nil {
+		fatal(err)
+	}
+	modified, err := repo.ModifiedFiles(pathspecs(paths))
+	if err != nil {
+		fatal(err)
+	}
+	if len(modified) == 0 {
+		fmt.Println("No changes.")
+		return
+	}
+	input := bufio.NewReader(os.Stdin)
+	for _, name := range modified {
+		entry := idx.Entry(name)
+		_, old, err := repo.ReadObject(entry.ID)
+		if err != nil {
+			fatal(err)
+		}
+		mode, data, err := repo.ReadWorktreeFile(name)
+		if os.IsNotExist(err) {
+			fmt.Printf("diff --git a/%s b/%s\ndeleted file mode %06o\n", name, name, entry.Mode)
+			switch promptHunk(input, "Stage deletion") {
+			case 'y', 'a':
+				if _, err := repo.Remove([]string{name}, mygit.RemoveOptions{Cached: true, Force: true}); err != nil {
+					fatal(err)
+				}
+			case 'q':
+				return
+			}
+			continue
+		} else if err != nil {
+			fatal(err)
+		}
+		if mode == mygit.ModeGitlink || uint32(mode) != entry.Mode {
+			continue
+		}
+		a := diff.Lines(old)
+		hunks := diff.Hunks(a, diff.Lines(data), 3)
+		fmt.Printf("diff --git a/%s b/%s\n--- a/%s\n+++ b/%s\n", name, name, name, name)
+		selected := make([]diff.Hunk, 0, len(hunks))
+		quit := false
+	hunkLoop:
+		for i, h := range hunks {
+			fmt.Print(h)
+			switch promptHunk(input, fmt.Sprintf("(%d/%d) Stage this hunk", i+1, len(hunks))) {
+			case 'y':
+				selected = append(selected, h)
+			case 'a':
+				selected = append(selected, hunks[i:]...)
+				break hunkLoop
+			case 'd':
+				break hunkLoop
+			case 'q':
+				quit = true
+				break hunkLoop
+			}
+		}
+		if len(selected) > 0 {
+			if err := repo.Stage(name, mode, diff.Apply(a, selected)); err != nil {
+				fatal(err)
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+// promptHunk asks whether to stage a change and returns the answer: y, n,
+// q (quit), a (this and the rest of the file) or d (none of the rest of
+// the file). End of input quits.
+func promptHunk(input *bufio.Reader, question string) byte {
+	for {
+		fmt.Printf("%s [y,n,q,a,d,?]? ", question)
+		line, err := input.ReadString('\n')
+		answer := strings.TrimSpace(line)
+		if answer == "" && err != nil {
+			fmt.Println()
+			return 'q'
+		}
+		if len(answer) == 1 && strings.Contains("ynqad", answer) {
+			return answer[0]
+		}
+		fmt.Print("y - stage this hunk\n" +
+			"n - do not stage this hunk\n" +
+			"q - quit; do not stage this hunk or any of the remaining ones\n" +
+			"a - stage this hunk and all later hunks in the file\n" +
+			"d - do not stage this hunk or any of the later hunks in the file\n")
+	}
+}
+
+func rm(paths []string, cached, recursive, force bool) {
+	removed, err := repo.Remove(pathspecs(paths), mygit.RemoveOptions{
+		Cached:    cached,
+		Recursive: recursive,
+		Force:     force,
+	})
+	for _, name := range removed {
+		fmt.Printf("rm '%s'\n", name)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func mv(sources []string, dest string, force bool) {
+	dst := pathspecs([]string{dest})[0]
+	if info, err := os.Stat(dest); len(sources) > 1 && (err != nil || !info.IsDir()) {
+		fatal(fmt.Errorf("destination '%s' is not a directory", dest))
+	}
+	for _, src := range pathspecs(sources) {
+		if err := repo.Move(src, dst, force); err != nil {
+			fatal(err)
+		}
+	}
+}
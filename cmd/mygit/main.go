@@ -4,30 +4,34 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/config"
+	"github.com/codecrafters-io/git-starter-go/pkg/mygit"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
 )
 
-func initf() {
-	for _, dir := range []string{".git", ".git/objects", ".git/refs"} {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating directory: %s\n", err)
-		}
-	}
+// repo is the repository containing the current directory. It is opened
+// before running any command that operates on an existing repository.
+var repo *mygit.Repository
 
-	headFileContents := []byte("ref: refs/heads/main\n")
-	if err := os.WriteFile(".git/HEAD", headFileContents, 0644); err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing file: %s\n", err)
-	}
+// prefix is the current directory relative to the top of the working tree,
+// with a trailing slash, or empty at the top.
+var prefix string
 
-	fmt.Println("Initialized git directory")
+// fatal reports an error and exits.
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	os.Exit(1)
 }
 
-func config(name, email string) {
-	data := fmt.Sprintf("name=%s\nemail=%s\n", name, email)
-	err := os.WriteFile(".git/config", []byte(data), 0666)
+func initf(format *odb.Algorithm, branch string) {
+	r, err := mygit.Init(".", mygit.InitOptions{ObjectFormat: format, InitialBranch: branch})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing configuration: %s\n", err)
-		os.Exit(1)
+		fatal(err)
 	}
+	r.Close()
+	fmt.Println("Initialized git directory")
 }
 
 // Usage: your_git.sh <command> <arg1> <arg2> ...
@@ -39,107 +43,673 @@ func main() {
 		os.Exit(1)
 	}
 
+	initCmd := flag.NewFlagSet("init", flag.ExitOnError)
+	formatArg := initCmd.String("object-format", "", "hash algorithm (sha1 or sha256)")
+	initialBranchArg := initCmd.String("b", "", "name of the initial branch")
+	initCmd.StringVar(initialBranchArg, "initial-branch", "", "name of the initial branch")
+
 	catFileCmd := flag.NewFlagSet("cat-file", flag.ExitOnError)
-	pArg := catFileCmd.String("p", "", "file hash")
+	pArg := catFileCmd.Bool("p", false, "pretty-print object content")
+	tArg := catFileCmd.Bool("t", false, "show object type")
+	sArg := catFileCmd.Bool("s", false, "show object size")
+	eArg := catFileCmd.Bool("e", false, "exit with zero status if object exists")
+	batchArg := catFileCmd.Bool("batch", false, "print objects named on stdin")
+	batchCheckArg := catFileCmd.Bool("batch-check", false, "print type and size of objects named on stdin")
+	batchAllArg := catFileCmd.Bool("batch-all-objects", false, "with --batch or --batch-check, print all objects")
 
 	hashObjectCmd := flag.NewFlagSet("hash-object", flag.ExitOnError)
-	wArg := hashObjectCmd.String("w", "", "file name")
+	wArg := hashObjectCmd.Bool("w", false, "write the object into the object database")
+	typeArg := hashObjectCmd.String("t", "blob", "object type")
+	stdinArg := hashObjectCmd.Bool("stdin", false, "read the object from stdin")
+	stdinPathsArg := hashObjectCmd.Bool("stdin-paths", false, "read file names from stdin")
+	literallyArg := hashObjectCmd.Bool("literally", false, "skip validation of the object type and content")
 
 	lsTreeCmd := flag.NewFlagSet("ls-tree", flag.ExitOnError)
-	nameBoolArg := lsTreeCmd.Bool("names-only", false, "read only names")
+	nameOnlyArg := lsTreeCmd.Bool("name-only", false, "list only names")
+	namesOnlyArg := lsTreeCmd.Bool("names-only", false, "same as --name-only")
+	recurseArg := lsTreeCmd.Bool("r", false, "recurse into subtrees")
+	showTreesArg := lsTreeCmd.Bool("t", false, "show tree entries even when recursing")
+	onlyTreesArg := lsTreeCmd.Bool("d", false, "show only tree entries")
+	longArg := lsTreeCmd.Bool("l", false, "show object sizes of blobs")
+	fullTreeArg := lsTreeCmd.Bool("full-tree", false, "list the full tree regardless of the current directory")
+	lsTreeZArg := lsTreeCmd.Bool("z", false, "terminate entries with NUL")
 
-	_ = flag.NewFlagSet("write-tree", flag.ExitOnError)
+	writeTreeCmd := flag.NewFlagSet("write-tree", flag.ExitOnError)
+	prefixArg := writeTreeCmd.String("prefix", "", "write the tree for a subdirectory")
 
 	commitTreeCmd := flag.NewFlagSet("commit-tree", flag.ExitOnError)
-	msgArg := commitTreeCmd.String("m", "", "commit message")
-	parArg := commitTreeCmd.String("p", "", "parrent commit hash")
+	var msgArg, parArg stringsFlag
+	commitTreeCmd.Var(&msgArg, "m", "commit message; repeated -m options are separate paragraphs")
+	commitTreeCmd.Var(&parArg, "p", "parent commit; may be repeated")
+
+	addCmd := flag.NewFlagSet("add", flag.ExitOnError)
+	addAllArg := addCmd.Bool("A", false, "stage all changes, including removals")
+	addUpdateArg := addCmd.Bool("u", false, "stage changes to tracked files only")
+	addPatchArg := addCmd.Bool("p", false, "interactively choose hunks to stage")
+	addForceArg := addCmd.Bool("f", false, "allow adding ignored files")
+
+	rmCmd := flag.NewFlagSet("rm", flag.ExitOnError)
+	cachedArg := rmCmd.Bool("cached", false, "only remove from the index")
+	rmRecursiveArg := rmCmd.Bool("r", false, "allow recursive removal")
+	rmForceArg := rmCmd.Bool("f", false, "override the up-to-date check")
+
+	mvCmd := flag.NewFlagSet("mv", flag.ExitOnError)
+	mvForceArg := mvCmd.Bool("f", false, "overwrite existing destination files")
+
+	statusCmd := flag.NewFlagSet("status", flag.ExitOnError)
+	var porcelainArg porcelainFlag
+	statusCmd.Var(&porcelainArg, "porcelain", "machine-readable output: v1 or v2")
+	statusShortArg := statusCmd.Bool("s", false, "short format")
+	statusCmd.BoolVar(statusShortArg, "short", false, "short format")
+	statusBranchArg := statusCmd.Bool("b", false, "show branch information")
+	statusCmd.BoolVar(statusBranchArg, "branch", false, "show branch information")
+	statusZArg := statusCmd.Bool("z", false, "terminate entries with NUL")
+	var untrackedArg untrackedFlag
+	statusCmd.Var(&untrackedArg, "u", "untracked files: all, normal or no")
+	statusCmd.Var(&untrackedArg, "untracked-files", "untracked files: all, normal or no")
+	ignoredArg := statusCmd.Bool("ignored", false, "show ignored files")
+
+	commitCmd := flag.NewFlagSet("commit", flag.ExitOnError)
+	var commitMsgArg stringsFlag
+	commitCmd.Var(&commitMsgArg, "m", "commit message; repeated -m options are separate paragraphs")
+	commitFileArg := commitCmd.String("F", "", "read the commit message from a file, or stdin for -")
+	amendArg := commitCmd.Bool("amend", false, "replace the tip of the current branch")
+	allowEmptyArg := commitCmd.Bool("allow-empty", false, "allow a commit with the same tree as its parent")
+
+	revParseCmd := flag.NewFlagSet("rev-parse", flag.ExitOnError)
+	shortArg := revParseCmd.Bool("short", false, "print abbreviated object names")
+	verifyArg := revParseCmd.Bool("verify", false, "require exactly one existing object")
+
+	updateRefCmd := flag.NewFlagSet("update-ref", flag.ExitOnError)
+	updateRefMsgArg := updateRefCmd.String("m", "", "reflog message")
+	updateRefDeleteArg := updateRefCmd.Bool("d", false, "delete the ref")
+	noDerefArg := updateRefCmd.Bool("no-deref", false, "update symbolic refs themselves")
+	updateRefStdinArg := updateRefCmd.Bool("stdin", false, "read a transaction from stdin")
+	updateRefZArg := updateRefCmd.Bool("z", false, "with --stdin, read NUL-terminated arguments")
+
+	symbolicRefCmd := flag.NewFlagSet("symbolic-ref", flag.ExitOnError)
+	symbolicRefMsgArg := symbolicRefCmd.String("m", "", "reflog message")
+	symbolicRefShortArg := symbolicRefCmd.Bool("short", false, "shorten the ref name")
+	symbolicRefQuietArg := symbolicRefCmd.Bool("q", false, "do not report detached HEAD")
+	symbolicRefCmd.BoolVar(symbolicRefQuietArg, "quiet", false, "do not report detached HEAD")
+	symbolicRefDeleteArg := symbolicRefCmd.Bool("d", false, "delete the symbolic ref")
+	symbolicRefCmd.BoolVar(symbolicRefDeleteArg, "delete", false, "delete the symbolic ref")
+
+	showRefCmd := flag.NewFlagSet("show-ref", flag.ExitOnError)
+	showHeadArg := showRefCmd.Bool("head", false, "show HEAD as well")
+	showHeadsArg := showRefCmd.Bool("heads", false, "show only branches")
+	showRefCmd.BoolVar(showHeadsArg, "branches", false, "show only branches")
+	showTagsArg := showRefCmd.Bool("tags", false, "show only tags")
+	derefArg := showRefCmd.Bool("d", false, "show peeled tags")
+	showRefCmd.BoolVar(derefArg, "dereference", false, "show peeled tags")
+	hashOnlyArg := showRefCmd.Bool("s", false, "show only object names")
+	showRefCmd.BoolVar(hashOnlyArg, "hash", false, "show only object names")
+	var abbrevArg abbrevFlag
+	showRefCmd.Var(&abbrevArg, "abbrev", "abbreviate object names")
+	showRefVerifyArg := showRefCmd.Bool("verify", false, "require exact ref names")
+	showRefQuietArg := showRefCmd.Bool("q", false, "only set the exit status")
+	showRefCmd.BoolVar(showRefQuietArg, "quiet", false, "only set the exit status")
+
+	forEachRefCmd := flag.NewFlagSet("for-each-ref", flag.ExitOnError)
+	refFormatArg := forEachRefCmd.String("format", "", "output format with %(atom) placeholders")
+	var sortArg stringsFlag
+	forEachRefCmd.Var(&sortArg, "sort", "sort key, - for descending; may be repeated")
+	countArg := forEachRefCmd.Int("count", 0, "stop after this many refs")
+	pointsAtArg := forEachRefCmd.String("points-at", "", "only refs pointing at the object")
+
+	packRefsCmd := flag.NewFlagSet("pack-refs", flag.ExitOnError)
+	packAllArg := packRefsCmd.Bool("all", false, "pack all refs, not only tags")
+
+	reflogShowCmd := flag.NewFlagSet("reflog show", flag.ExitOnError)
+	reflogExpireCmd := flag.NewFlagSet("reflog expire", flag.ExitOnError)
+	reflogDeleteCmd := flag.NewFlagSet("reflog delete", flag.ExitOnError)
+	reflogExistsCmd := flag.NewFlagSet("reflog exists", flag.ExitOnError)
+	expireArg := reflogExpireCmd.String("expire", "", "prune entries older than this time")
+	expireUnreachableArg := reflogExpireCmd.String("expire-unreachable", "", "prune unreachable entries older than this time")
+	reflogAllArg := reflogExpireCmd.Bool("all", false, "process the reflogs of all refs")
+	var reflogRewriteArg, reflogUpdateRefArg, reflogDryRunArg bool
+	for _, cmd := range []*flag.FlagSet{reflogExpireCmd, reflogDeleteCmd} {
+		cmd.BoolVar(&reflogRewriteArg, "rewrite", false, "adjust the old value of entries after removed ones")
+		cmd.BoolVar(&reflogUpdateRefArg, "updateref", false, "update the ref if its newest entry is removed")
+		cmd.BoolVar(&reflogDryRunArg, "dry-run", false, "do not prune anything")
+		cmd.BoolVar(&reflogDryRunArg, "n", false, "do not prune anything")
+	}
+
+	branchCmd := flag.NewFlagSet("branch", flag.ExitOnError)
+	branchDeleteArg := branchCmd.Bool("d", false, "delete merged branches")
+	branchCmd.BoolVar(branchDeleteArg, "delete", false, "delete merged branches")
+	branchForceDeleteArg := branchCmd.Bool("D", false, "delete branches even if not merged")
+	branchMoveArg := branchCmd.Bool("m", false, "rename a branch")
+	branchCmd.BoolVar(branchMoveArg, "move", false, "rename a branch")
+	branchForceMoveArg := branchCmd.Bool("M", false, "rename a branch even if the new name exists")
+	branchForceArg := branchCmd.Bool("f", false, "reset an existing branch")
+	branchCmd.BoolVar(branchForceArg, "force", false, "reset an existing branch")
+	branchVerboseArg := branchCmd.Bool("v", false, "show the commit and upstream status of each branch")
+	branchCmd.BoolVar(branchVerboseArg, "verbose", false, "show the commit and upstream status of each branch")
+	branchVeryVerboseArg := branchCmd.Bool("vv", false, "like -v, also naming the upstream branch")
+	branchAllArg := branchCmd.Bool("a", false, "list local and remote-tracking branches")
+	branchCmd.BoolVar(branchAllArg, "all", false, "list local and remote-tracking branches")
+	branchRemotesArg := branchCmd.Bool("r", false, "list remote-tracking branches")
+	branchCmd.BoolVar(branchRemotesArg, "remotes", false, "list remote-tracking branches")
+	branchListArg := branchCmd.Bool("l", false, "list branches matching the patterns")
+	branchCmd.BoolVar(branchListArg, "list", false, "list branches matching the patterns")
+	showCurrentArg := branchCmd.Bool("show-current", false, "print the name of the current branch")
+	setUpstreamArg := branchCmd.String("u", "", "set the upstream of a branch")
+	branchCmd.StringVar(setUpstreamArg, "set-upstream-to", "", "set the upstream of a branch")
+	unsetUpstreamArg := branchCmd.Bool("unset-upstream", false, "remove the upstream of a branch")
+	trackArg := branchCmd.Bool("t", false, "make a new branch track its start point")
+	branchCmd.BoolVar(trackArg, "track", false, "make a new branch track its start point")
+	noTrackArg := branchCmd.Bool("no-track", false, "do not track the start point")
+	containsArg := branchCmd.String("contains", "", "list only branches containing the commit")
+	var mergedArg, noMergedArg commitFlag
+	branchCmd.Var(&mergedArg, "merged", "list only branches merged into the commit (default HEAD)")
+	branchCmd.Var(&noMergedArg, "no-merged", "list only branches not merged into the commit (default HEAD)")
+
+	switchCmd := flag.NewFlagSet("switch", flag.ExitOnError)
+	switchCreateArg := switchCmd.String("c", "", "create a branch at the start point and switch to it")
+	switchCmd.StringVar(switchCreateArg, "create", "", "create a branch at the start point and switch to it")
+	switchForceCreateArg := switchCmd.String("C", "", "like -c, resetting the branch if it exists")
+	switchCmd.StringVar(switchForceCreateArg, "force-create", "", "like -c, resetting the branch if it exists")
+	switchDetachArg := switchCmd.Bool("d", false, "detach HEAD at the commit")
+	switchCmd.BoolVar(switchDetachArg, "detach", false, "detach HEAD at the commit")
+	switchForceArg := switchCmd.Bool("f", false, "discard local changes")
+	switchCmd.BoolVar(switchForceArg, "force", false, "discard local changes")
+	switchCmd.BoolVar(switchForceArg, "discard-changes", false, "discard local changes")
+
+	checkoutCmd := flag.NewFlagSet("checkout", flag.ExitOnError)
+	checkoutCreateArg := checkoutCmd.String("b", "", "create a branch at the start point and check it out")
+	checkoutForceCreateArg := checkoutCmd.String("B", "", "like -b, resetting the branch if it exists")
+	checkoutDetachArg := checkoutCmd.Bool("detach", false, "detach HEAD at the commit")
+	checkoutForceArg := checkoutCmd.Bool("f", false, "discard local changes")
+	checkoutCmd.BoolVar(checkoutForceArg, "force", false, "discard local changes")
+
+	restoreCmd := flag.NewFlagSet("restore", flag.ExitOnError)
+	restoreSourceArg := restoreCmd.String("s", "", "restore from this tree-ish")
+	restoreCmd.StringVar(restoreSourceArg, "source", "", "restore from this tree-ish")
+	restoreStagedArg := restoreCmd.Bool("S", false, "restore the index")
+	restoreCmd.BoolVar(restoreStagedArg, "staged", false, "restore the index")
+	restoreWorktreeArg := restoreCmd.Bool("W", false, "restore the working tree (the default)")
+	restoreCmd.BoolVar(restoreWorktreeArg, "worktree", false, "restore the working tree (the default)")
+	restoreOverlayArg := restoreCmd.Bool("overlay", false, "keep files missing from the source")
 
 	configCmd := flag.NewFlagSet("config", flag.ExitOnError)
-	nameArg := configCmd.String("name", "", "author name")
-	emailArg := configCmd.String("email", "", "author email")
+	globalArg := configCmd.Bool("global", false, "use the user's config file")
+	systemArg := configCmd.Bool("system", false, "use the system config file")
+	localArg := configCmd.Bool("local", false, "use the repository's config file")
+	configFileArg := configCmd.String("file", "", "use the given config file")
+	configCmd.StringVar(configFileArg, "f", "", "use the given config file")
+	configActions := map[string]*bool{}
+	for _, action := range []string{"get", "get-all", "get-regexp", "list", "set", "add", "replace-all", "unset", "unset-all"} {
+		configActions[action] = configCmd.Bool(action, false, action+" action")
+	}
+	configCmd.BoolVar(configActions["list"], "l", false, "list action")
+	showOriginArg := configCmd.Bool("show-origin", false, "show the file each entry was read from")
+	showScopeArg := configCmd.Bool("show-scope", false, "show the scope of each entry")
 
 	cloneCmd := flag.NewFlagSet("clone", flag.ExitOnError)
 	urlArg := cloneCmd.String("url", "", "repo url")
 	pathArg := cloneCmd.String("path", "", "repo path")
+	cloneBranchArg := cloneCmd.String("b", "", "check out this branch or tag instead of the remote's HEAD")
+	cloneCmd.StringVar(cloneBranchArg, "branch", "", "check out this branch or tag instead of the remote's HEAD")
+	cloneRevisionArg := cloneCmd.String("revision", "", "fetch and check out only this commit, on a detached HEAD")
+	cloneNoCheckoutArg := cloneCmd.Bool("n", false, "do not check out HEAD")
+	cloneCmd.BoolVar(cloneNoCheckoutArg, "no-checkout", false, "do not check out HEAD")
+	cloneBareArg := cloneCmd.Bool("bare", false, "create a bare repository")
+
+	switch os.Args[1] {
+	case "init", "clone", "config", "help":
+	default:
+		var err error
+		if repo, err = mygit.Discover("."); err != nil {
+			fatal(err)
+		}
+		defer repo.Close()
+		if cwd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(repo.WorkDir, cwd); err == nil && rel != "." {
+				prefix = filepath.ToSlash(rel) + "/"
+			}
+		}
+	}
 
 	switch command := os.Args[1]; command {
 	case "init":
-		initf()
+		initCmd.Parse(os.Args[2:])
+		var format *odb.Algorithm
+		if *formatArg != "" {
+			var err error
+			if format, err = odb.LookupAlgorithm(*formatArg); err != nil {
+				fatal(err)
+			}
+		}
+		initf(format, *initialBranchArg)
 
 	case "cat-file":
 		catFileCmd.Parse(os.Args[2:])
-		hash := *pArg
-		if hash == "" {
+		if *batchArg || *batchCheckArg {
+			if catFileCmd.NArg() > 0 || (*batchArg && *batchCheckArg) {
+				catFileCmd.Usage()
+				os.Exit(1)
+			}
+			if *batchAllArg {
+				catFileAll(*batchArg)
+			} else {
+				catFileBatch(os.Stdin, *batchArg)
+			}
+			break
+		}
+		modes := make([]string, 0)
+		for mode, set := range map[string]bool{"p": *pArg, "t": *tArg, "s": *sArg, "e": *eArg} {
+			if set {
+				modes = append(modes, mode)
+			}
+		}
+		args := catFileCmd.Args()
+		if len(modes) == 0 && len(args) == 2 {
+			modes, args = args[:1], args[1:]
+		}
+		if len(modes) != 1 || len(args) != 1 {
 			catFileCmd.Usage()
 			os.Exit(1)
 		}
-		catFile(hash)
+		catFile(modes[0], args[0])
 
 	case "hash-object":
 		hashObjectCmd.Parse(os.Args[2:])
-		filename := *wArg
-		if filename == "" {
+		paths := hashObjectCmd.Args()
+		if *stdinArg && *stdinPathsArg || *stdinPathsArg && len(paths) > 0 ||
+			!*stdinArg && !*stdinPathsArg && len(paths) == 0 {
 			hashObjectCmd.Usage()
 			os.Exit(1)
 		}
-		hashObject(filename)
+		hashObject(paths, *typeArg, *wArg, *stdinArg, *stdinPathsArg, *literallyArg)
 
 	case "ls-tree":
 		lsTreeCmd.Parse(os.Args[2:])
-		name := *nameBoolArg
-		hash := lsTreeCmd.Arg(0)
 		if lsTreeCmd.NArg() <= 0 {
 			lsTreeCmd.Usage()
 			os.Exit(1)
 		}
-		lsTree(hash, name)
+		lsTree(lsTreeCmd.Arg(0), lsTreeCmd.Args()[1:], lsTreeOptions{
+			nameOnly:  *nameOnlyArg || *namesOnlyArg,
+			recurse:   *recurseArg,
+			showTrees: *showTreesArg,
+			onlyTrees: *onlyTreesArg,
+			long:      *longArg,
+			fullTree:  *fullTreeArg,
+			nulTerm:   *lsTreeZArg,
+		})
 
 	case "write-tree":
-		writeTree(".")
+		writeTreeCmd.Parse(os.Args[2:])
+		writeTree(*prefixArg)
 
 	case "commit-tree":
 		commitTreeCmd.Parse(os.Args[2:])
-		parent := *parArg
-		msg := *msgArg
-		hash := commitTreeCmd.Arg(0)
-		if commitTreeCmd.NArg() <= 0 {
+		if commitTreeCmd.NArg() != 1 {
 			commitTreeCmd.Usage()
 			os.Exit(1)
 		}
-		commitTree(hash, parent, msg)
+		commitTree(commitTreeCmd.Arg(0), parArg, msgArg)
+
+	case "add":
+		addCmd.Parse(os.Args[2:])
+		if *addPatchArg {
+			addPatch(addCmd.Args())
+			break
+		}
+		add(addCmd.Args(), *addAllArg, *addUpdateArg, *addForceArg)
+
+	case "rm":
+		rmCmd.Parse(os.Args[2:])
+		if rmCmd.NArg() <= 0 {
+			rmCmd.Usage()
+			os.Exit(1)
+		}
+		rm(rmCmd.Args(), *cachedArg, *rmRecursiveArg, *rmForceArg)
+
+	case "mv":
+		mvCmd.Parse(os.Args[2:])
+		if mvCmd.NArg() < 2 {
+			mvCmd.Usage()
+			os.Exit(1)
+		}
+		args := mvCmd.Args()
+		mv(args[:len(args)-1], args[len(args)-1], *mvForceArg)
+
+	case "status":
+		statusCmd.Parse(os.Args[2:])
+		status(statusCmd.Args(), statusOptions{
+			porcelain: int(porcelainArg),
+			short:     *statusShortArg,
+			branch:    *statusBranchArg,
+			nulTerm:   *statusZArg,
+			untracked: int(untrackedArg),
+			ignored:   *ignoredArg,
+		})
+
+	case "commit":
+		commitCmd.Parse(os.Args[2:])
+		if commitCmd.NArg() > 0 || len(commitMsgArg) > 0 && *commitFileArg != "" ||
+			len(commitMsgArg) == 0 && *commitFileArg == "" && !*amendArg {
+			commitCmd.Usage()
+			os.Exit(1)
+		}
+		commit(commitMsgArg, *commitFileArg, *amendArg, *allowEmptyArg)
+
+	case "rev-parse":
+		revParseCmd.Parse(os.Args[2:])
+		if revParseCmd.NArg() <= 0 {
+			revParseCmd.Usage()
+			os.Exit(1)
+		}
+		revParse(revParseCmd.Args(), *shortArg, *verifyArg)
+
+	case "update-ref":
+		updateRefCmd.Parse(os.Args[2:])
+		if *updateRefStdinArg {
+			if updateRefCmd.NArg() > 0 || *updateRefDeleteArg {
+				updateRefCmd.Usage()
+				os.Exit(1)
+			}
+			updateRefStdin(*updateRefZArg, *updateRefMsgArg, *noDerefArg)
+			break
+		}
+		if n := updateRefCmd.NArg(); *updateRefZArg || *updateRefDeleteArg && (n < 1 || n > 2) || !*updateRefDeleteArg && (n < 2 || n > 3) {
+			updateRefCmd.Usage()
+			os.Exit(1)
+		}
+		updateRef(updateRefCmd.Args(), *updateRefMsgArg, *updateRefDeleteArg, *noDerefArg)
+
+	case "symbolic-ref":
+		symbolicRefCmd.Parse(os.Args[2:])
+		if n := symbolicRefCmd.NArg(); n < 1 || n > 2 || n == 2 && *symbolicRefDeleteArg {
+			symbolicRefCmd.Usage()
+			os.Exit(1)
+		}
+		symbolicRef(symbolicRefCmd.Args(), *symbolicRefMsgArg, *symbolicRefShortArg, *symbolicRefQuietArg, *symbolicRefDeleteArg)
+
+	case "show-ref":
+		showRefCmd.Parse(os.Args[2:])
+		if *showRefVerifyArg && showRefCmd.NArg() == 0 {
+			showRefCmd.Usage()
+			os.Exit(1)
+		}
+		showRef(showRefCmd.Args(), showRefOptions{
+			head:     *showHeadArg,
+			heads:    *showHeadsArg,
+			tags:     *showTagsArg,
+			deref:    *derefArg,
+			hashOnly: *hashOnlyArg,
+			abbrev:   int(abbrevArg),
+			verify:   *showRefVerifyArg,
+			quiet:    *showRefQuietArg,
+		})
+
+	case "for-each-ref":
+		forEachRefCmd.Parse(os.Args[2:])
+		forEachRef(forEachRefCmd.Args(), forEachRefOptions{
+			format:   *refFormatArg,
+			sort:     sortArg,
+			count:    *countArg,
+			pointsAt: *pointsAtArg,
+		})
+
+	case "pack-refs":
+		packRefsCmd.Parse(os.Args[2:])
+		packRefs(*packAllArg)
+
+	case "reflog":
+		args := os.Args[2:]
+		subcommand := "show"
+		if len(args) > 0 && (args[0] == "show" || args[0] == "expire" || args[0] == "delete" || args[0] == "exists") {
+			subcommand, args = args[0], args[1:]
+		}
+		switch subcommand {
+		case "show":
+			reflogShowCmd.Parse(args)
+			if reflogShowCmd.NArg() > 1 {
+				reflogShowCmd.Usage()
+				os.Exit(1)
+			}
+			reflogShow(reflogShowCmd.Arg(0))
+		case "expire":
+			reflogExpireCmd.Parse(args)
+			if !*reflogAllArg && reflogExpireCmd.NArg() == 0 {
+				reflogExpireCmd.Usage()
+				os.Exit(1)
+			}
+			reflogExpire(reflogExpireCmd.Args(), reflogOptions{
+				expire:            *expireArg,
+				expireUnreachable: *expireUnreachableArg,
+				all:               *reflogAllArg,
+				rewrite:           reflogRewriteArg,
+				updateRef:         reflogUpdateRefArg,
+				dryRun:            reflogDryRunArg,
+			})
+		case "delete":
+			reflogDeleteCmd.Parse(args)
+			if reflogDeleteCmd.NArg() == 0 {
+				reflogDeleteCmd.Usage()
+				os.Exit(1)
+			}
+			reflogDelete(reflogDeleteCmd.Args(), reflogOptions{
+				rewrite:   reflogRewriteArg,
+				updateRef: reflogUpdateRefArg,
+				dryRun:    reflogDryRunArg,
+			})
+		case "exists":
+			reflogExistsCmd.Parse(args)
+			if reflogExistsCmd.NArg() != 1 {
+				reflogExistsCmd.Usage()
+				os.Exit(1)
+			}
+			reflogExists(reflogExistsCmd.Arg(0))
+		}
+
+	case "branch":
+		branchCmd.Parse(os.Args[2:])
+		args := branchCmd.Args()
+		args = lastArgDefault(os.Args[2:], args, "merged", &mergedArg)
+		args = lastArgDefault(os.Args[2:], args, "no-merged", &noMergedArg)
+		opts := branchOptions{
+			all:      *branchAllArg,
+			remotes:  *branchRemotesArg,
+			contains: *containsArg,
+			merged:   string(mergedArg),
+			noMerged: string(noMergedArg),
+		}
+		if *branchVerboseArg {
+			opts.verbose = 1
+		}
+		if *branchVeryVerboseArg {
+			opts.verbose = 2
+		}
+		listing := *branchListArg || len(args) == 0 || opts.verbose > 0 || opts.all || opts.remotes ||
+			opts.contains != "" || opts.merged != "" || opts.noMerged != ""
+		switch {
+		case *showCurrentArg:
+			showCurrentBranch()
+		case *branchDeleteArg || *branchForceDeleteArg:
+			if len(args) == 0 {
+				branchCmd.Usage()
+				os.Exit(1)
+			}
+			deleteBranches(args, *branchForceDeleteArg || *branchForceArg)
+		case *branchMoveArg || *branchForceMoveArg:
+			if len(args) < 1 || len(args) > 2 {
+				branchCmd.Usage()
+				os.Exit(1)
+			}
+			renameBranch(args, *branchForceMoveArg || *branchForceArg)
+		case *setUpstreamArg != "" || *unsetUpstreamArg:
+			if len(args) > 1 || *setUpstreamArg != "" && *unsetUpstreamArg {
+				branchCmd.Usage()
+				os.Exit(1)
+			}
+			if *unsetUpstreamArg {
+				unsetUpstream(branchCmd.Arg(0))
+			} else {
+				setUpstreamTo(*setUpstreamArg, branchCmd.Arg(0))
+			}
+		case listing:
+			listBranches(args, opts)
+		default:
+			if len(args) > 2 || *trackArg && *noTrackArg {
+				branchCmd.Usage()
+				os.Exit(1)
+			}
+			createBranch(args[0], branchCmd.Arg(1), *branchForceArg, *trackArg, *noTrackArg)
+		}
+
+	case "switch":
+		switchCmd.Parse(os.Args[2:])
+		opts := switchOptions{create: *switchCreateArg, detach: *switchDetachArg, force: *switchForceArg}
+		if *switchForceCreateArg != "" {
+			opts.create, opts.forceCreate = *switchForceCreateArg, true
+		}
+		if switchCmd.NArg() > 1 || switchCmd.NArg() == 0 && opts.create == "" && !opts.detach ||
+			*switchCreateArg != "" && *switchForceCreateArg != "" || opts.create != "" && opts.detach {
+			switchCmd.Usage()
+			os.Exit(1)
+		}
+		switchTo(switchCmd.Arg(0), opts)
+
+	case "checkout":
+		// Arguments after "--" are always paths.
+		args, paths, dashdash := os.Args[2:], []string(nil), false
+		for i, arg := range args {
+			if arg == "--" {
+				args, paths, dashdash = args[:i], args[i+1:], true
+				break
+			}
+		}
+		checkoutCmd.Parse(args)
+		opts := switchOptions{create: *checkoutCreateArg, detach: *checkoutDetachArg, force: *checkoutForceArg}
+		if *checkoutForceCreateArg != "" {
+			opts.create, opts.forceCreate = *checkoutForceCreateArg, true
+		}
+		if *checkoutCreateArg != "" && *checkoutForceCreateArg != "" || opts.create != "" && opts.detach {
+			checkoutCmd.Usage()
+			os.Exit(1)
+		}
+		checkout(checkoutCmd.Args(), paths, dashdash, opts)
+
+	case "restore":
+		restoreCmd.Parse(os.Args[2:])
+		restore(restoreCmd.Args(), mygit.RestoreOptions{
+			Source:   *restoreSourceArg,
+			Staged:   *restoreStagedArg,
+			Worktree: *restoreWorktreeArg,
+			Overlay:  *restoreOverlayArg,
+		})
 
 	case "config":
 		configCmd.Parse(os.Args[2:])
-		name := *nameArg
-		email := *emailArg
-		if name == "" || email == "" {
+		opts := configOptions{file: *configFileArg, showOrigin: *showOriginArg, showScope: *showScopeArg}
+		scopes := 0
+		for scope, set := range map[config.Scope]bool{config.ScopeSystem: *systemArg, config.ScopeGlobal: *globalArg, config.ScopeLocal: *localArg} {
+			if set {
+				opts.scope = scope
+				scopes++
+			}
+		}
+		actions := make([]string, 0)
+		for action, set := range configActions {
+			if *set {
+				actions = append(actions, action)
+			}
+		}
+		// Without an action, one argument gets a key and two set it.
+		if len(actions) == 0 && configCmd.NArg() == 1 {
+			actions = append(actions, "get")
+		} else if len(actions) == 0 && configCmd.NArg() == 2 {
+			actions = append(actions, "set")
+		}
+		args := map[string]int{"get": 1, "get-all": 1, "get-regexp": 1, "list": 0, "set": 2, "add": 2, "replace-all": 2, "unset": 1, "unset-all": 1}
+		if len(actions) != 1 || configCmd.NArg() != args[actions[0]] || scopes > 1 || scopes > 0 && opts.file != "" {
 			configCmd.Usage()
 			os.Exit(1)
 		}
-		config(name, email)
+		configure(actions[0], configCmd.Args(), opts)
 
 	case "clone":
 		cloneCmd.Parse(os.Args[2:])
 		url := *urlArg
 		path := *pathArg
-		if url == "" {
+		if url == "" || *cloneBranchArg != "" && *cloneRevisionArg != "" {
 			cloneCmd.Usage()
 			os.Exit(1)
 		}
-		clone(url, path)
+		clone(url, path, mygit.CloneOptions{
+			Branch:     *cloneBranchArg,
+			Revision:   *cloneRevisionArg,
+			NoCheckout: *cloneNoCheckoutArg,
+			Bare:       *cloneBareArg,
+		})
 
 	case "help":
 		fmt.Fprintf(
 			os.Stderr,
 			"usage:  mygit <command> [<args>...]\n"+
-				"\tinit						initialize git directory\n"+
-				"\tcat-file -p <hash>				display blob file contents\n"+
-				"\thash-object -w <filename>			write blob file object\n"+
-				"\tls-tree [--names-only] <hash>\t		display tree object contents\n"+
-				"\twrite-tree					write tree object\n"+
-				"\tcommit-tree -p <parent> -m <message> <hash>	write tree commit object\n"+
-				"\tconfig --name <name> --email <email>		configure git credentials\n"+
-				"\tclone --url <url>				clone repository\n",
+				"\tinit [--object-format=<sha1|sha256>] [-b <branch>]\n"+
+				"\t						initialize git directory\n"+
+				"\tcat-file (-p | -t | -s | -e | <type>) <rev>	display object contents, type or size\n"+
+				"\tcat-file (--batch | --batch-check)		display objects named on stdin\n"+
+				"\thash-object [-w] [-t <type>] [--literally]\n"+
+				"\t    (--stdin | --stdin-paths | <file>...)	compute object names, optionally writing them\n"+
+				"\tls-tree [-r] [-t] [-d] [-l] [-z] [--name-only] [--full-tree]\n"+
+				"\t    <tree-ish> [<path>...]			display tree object contents\n"+
+				"\tadd [-A | -u | -p] [-f] [<path>...]		stage working tree changes\n"+
+				"\trm [--cached] [-r] [-f] <path>...		remove files from the index and working tree\n"+
+				"\tmv [-f] <source>... <destination>		move or rename tracked files\n"+
+				"\tstatus [-s] [-b] [-z] [--porcelain[=v1|v2]] [-u<mode>]\n"+
+				"\t    [--ignored] [<path>...]			show the working tree status\n"+
+				"\twrite-tree [--prefix=<dir>]			write tree object from the index\n"+
+				"\tcommit-tree [-p <parent>]... [-m <message>]... <tree>\n"+
+				"\t						write a commit object, reading the message\n"+
+				"\t						from stdin without -m\n"+
+				"\tcommit (-m <message> | -F <file>) [--amend] [--allow-empty]\n"+
+				"\t						record the index as a new commit\n"+
+				"\trev-parse [--short] [--verify] <rev>...		display object names\n"+
+				"\tupdate-ref [-m <reason>] [--no-deref] (-d <ref> [<old>] | <ref> <new> [<old>]\n"+
+				"\t    | --stdin [-z])				update, create or delete refs\n"+
+				"\tsymbolic-ref [-m <reason>] [--short] [-q] [-d] <name> [<ref>]\n"+
+				"\t						read, set or delete a symbolic ref\n"+
+				"\tshow-ref [--head] [--heads] [--tags] [-d] [-s] [--abbrev[=<n>]]\n"+
+				"\t    [--verify] [-q] [<pattern>...]		list refs\n"+
+				"\tfor-each-ref [--format=<format>] [--sort=<key>]... [--count=<n>]\n"+
+				"\t    [--points-at=<object>] [<pattern>...]	list refs with custom formatting\n"+
+				"\tpack-refs [--all]				move refs into packed-refs\n"+
+				"\treflog [show] [<ref>]				show the history of a ref\n"+
+				"\treflog expire [--expire=<time>] [--expire-unreachable=<time>]\n"+
+				"\t    [--rewrite] [--updateref] [-n] (--all | <ref>...)\n"+
+				"\t						prune old reflog entries\n"+
+				"\treflog delete [--rewrite] [--updateref] [-n] <ref>@{<n>}...\n"+
+				"\t						delete reflog entries\n"+
+				"\treflog exists <ref>				check whether a ref has a reflog\n"+
+				"\tbranch [-v | -vv] [-a | -r] [--contains <commit>] [--merged [<commit>]]\n"+
+				"\t    [--no-merged [<commit>]] [--list] [<pattern>...]\n"+
+				"\t						list branches\n"+
+				"\tbranch [-f] [-t | --no-track] <name> [<start>]	create a branch\n"+
+				"\tbranch (-d | -D) <name>...			delete branches\n"+
+				"\tbranch (-m | -M) [<old>] <new>			rename a branch\n"+
+				"\tbranch (-u <upstream> | --unset-upstream) [<name>]\n"+
+				"\t						set or remove the upstream of a branch\n"+
+				"\tbranch --show-current				print the current branch\n"+
+				"\tswitch [-f] [-c | -C <new>] [-d] [<branch> | <commit>]\n"+
+				"\t						switch branches or detach HEAD\n"+
+				"\tcheckout [-f] [-b | -B <new>] [--detach] [<branch> | <commit>]\n"+
+				"\t						switch branches or detach HEAD\n"+
+				"\tcheckout [<tree-ish>] [--] <path>...		restore files from the index or a commit\n"+
+				"\trestore [-s <tree-ish>] [-S] [-W] [--overlay] <path>...\n"+
+				"\t						restore index entries or working tree files\n"+
+				"\tconfig [--global | --system | --local | -f <file>]\n"+
+				"\t    [--get | --get-all | --unset | --unset-all] <name>\n"+
+				"\t    [--set | --add | --replace-all] <name> <value>\n"+
+				"\t    (--get-regexp <regexp> | --list) [--show-origin] [--show-scope]\n"+
+				"\t						get and set configuration variables\n"+
+				"\tclone [-b <branch> | --revision <rev>] [-n] [--bare]\n"+
+				"\t    --url <url> [--path <dir>]			clone repository\n",
 		)
 		os.Exit(0)
 
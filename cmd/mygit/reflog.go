@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/mygit"
+)
+
+// reflogName returns the full name of the ref whose reflog an argument
+// names, defaulting to HEAD.
+func reflogName(ref string) string {
+	if ref == "" {
+		return "HEAD"
+	}
+	name, err := repo.ExpandRefName(ref)
+	if err != nil {
+		fatal(err)
+	}
+	return name
+}
+
+// reflogShow prints a reflog newest first as "<abbrev> <ref>@{<n>}:
+// <message>", naming the ref as it was given.
+func reflogShow(ref string) {
+	entries, err := repo.ReadReflog(reflogName(ref))
+	if err != nil {
+		fatal(err)
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for n := 0; n < len(entries); n++ {
+		e := entries[len(entries)-1-n]
+		fmt.Fprintf(out, "%s %s@{%d}: %s\n", repo.Abbreviate(e.New, 7), ref, n, e.Message)
+	}
+}
+
+type reflogOptions struct {
+	expire            string
+	expireUnreachable string
+	all               bool
+	rewrite           bool
+	updateRef         bool
+	dryRun            bool
+}
+
+// expireTime parses an expiry time: "never" keeps all entries, "all" and
+// "now" expire all of them, and other values are approximate dates.
+func expireTime(value string) time.Time {
+	switch value {
+	case "never", "false":
+		return time.Time{}
+	case "all":
+		return time.Unix(math.MaxInt32, 0)
+	}
+	t, err := mygit.ParseApproxDate(value, time.Now())
+	if err != nil {
+		fatal(err)
+	}
+	return t
+}
+
+// reflogExpire prunes old entries from the reflogs of refs, or of all refs.
+// Without options, the times come from gc.reflogExpire and
+// gc.reflogExpireUnreachable, defaulting to 90 and 30 days.
+func reflogExpire(refs []string, opts reflogOptions) {
+	cfg, err := repo.Config()
+	if err != nil {
+		fatal(err)
+	}
+	expire, expireUnreachable := opts.expire, opts.expireUnreachable
+	if expire == "" {
+		expire = "90.days.ago"
+		if value, ok := cfg.Get("gc.reflogexpire"); ok {
+			expire = value
+		}
+	}
+	if expireUnreachable == "" {
+		expireUnreachable = "30.days.ago"
+		if value, ok := cfg.Get("gc.reflogexpireunreachable"); ok {
+			expireUnreachable = value
+		}
+	}
+	var names []string
+	if opts.all {
+		if names, err = repo.ListReflogs(); err != nil {
+			fatal(err)
+		}
+	}
+	for _, ref := range refs {
+		names = append(names, reflogName(ref))
+	}
+	expireOpts := mygit.ReflogExpireOptions{
+		Expire:            expireTime(expire),
+		ExpireUnreachable: expireTime(expireUnreachable),
+		Rewrite:           opts.rewrite,
+		UpdateRef:         opts.updateRef,
+		DryRun:            opts.dryRun,
+	}
+	for _, name := range names {
+		if _, err := repo.ExpireReflog(name, expireOpts); err != nil {
+			fatal(err)
+		}
+	}
+}
+
+// reflogDelete removes the reflog entries named as <ref>@{<n>}.
+func reflogDelete(specs []string, opts reflogOptions) {
+	indexes := make(map[string][]int)
+	var names []string
+	for _, spec := range specs {
+		ref, n, ok := strings.Cut(spec, "@{")
+		index, err := strconv.Atoi(strings.TrimSuffix(n, "}"))
+		if !ok || !strings.HasSuffix(n, "}") || err != nil {
+			fatal(fmt.Errorf("not a reflog: %s", spec))
+		}
+		name := reflogName(ref)
+		if _, ok := indexes[name]; !ok {
+			names = append(names, name)
+		}
+		indexes[name] = append(indexes[name], index)
+	}
+	for _, name := range names {
+		err := repo.DeleteReflogEntries(name, indexes[name], mygit.ReflogExpireOptions{
+			Rewrite:   opts.rewrite,
+			UpdateRef: opts.updateRef,
+			DryRun:    opts.dryRun,
+		})
+		if err != nil {
+			fatal(err)
+		}
+	}
+}
+
+func reflogExists(ref string) {
+	if !repo.HasReflog(ref) {
+		os.Exit(1)
+	}
+}
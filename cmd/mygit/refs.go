@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/mygit"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// abbrevFlag is the value of --abbrev[=<n>]; without a value it is 7.
+type abbrevFlag int
+
+func (a *abbrevFlag) String() string { return strconv.Itoa(int(*a)) }
+
+func (a *abbrevFlag) Set(s string) error {
+	if s == "true" {
+		*a = 7
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid abbreviation length %q", s)
+	}
+	*a = abbrevFlag(n)
+	return nil
+}
+
+func (a *abbrevFlag) IsBoolFlag() bool { return true }
+
+// refValue parses the value of an update-ref argument: an empty string or
+// the all-zero name is the zero ID, anything else must name an object.
+func refValue(s string) odb.ID {
+	if s == "" {
+		return odb.ID{}
+	}
+	if id, err := repo.Hash.ParseID(s); err == nil && id.IsZero() {
+		return id
+	}
+	return resolve(s)
+}
+
+func updateRef(args []string, message string, del, noDeref bool) {
+	u := mygit.RefUpdate{Name: args[0], NoDeref: noDeref, Message: message}
+	if del {
+		if len(args) == 2 {
+			u.Old, u.HaveOld = refValue(args[1]), true
+			if u.Old.IsZero() {
+				fatal(fmt.Errorf("delete %s: zero old value", args[0]))
+			}
+		}
+	} else {
+		u.New = refValue(args[1])
+		if len(args) == 3 {
+			u.Old, u.HaveOld = refValue(args[2]), true
+		}
+	}
+	tx := repo.NewRefTransaction()
+	if err := tx.Update(u); err != nil {
+		fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		fatal(err)
+	}
+}
+
+// refArgCounts is the number of arguments after the ref name that each
+// update-ref --stdin command takes with -z, where optional ones are empty.
+var refArgCounts = map[string]int{"update": 2, "create": 1, "delete": 1, "verify": 1}
+
+// updateRefStdin runs the update-ref commands read from stdin. Commands
+// outside start and commit form one transaction that is committed at the
+// end of the input; an explicit transaction left open is aborted.
+func updateRefStdin(nulTerm bool, message string, noDeref bool) {
+	in := bufio.NewReader(os.Stdin)
+	tx := repo.NewRefTransaction()
+	explicit, pending, optNoDeref := false, false, false
+	for {
+		command, args, err := readRefCommand(in, nulTerm)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			fatal(err)
+		}
+		switch command {
+		case "start":
+			explicit, pending = true, false
+			tx = repo.NewRefTransaction()
+			fmt.Println("start: ok")
+			continue
+		case "prepare":
+			if err := tx.Prepare(); err != nil {
+				fatal(err)
+			}
+			fmt.Println("prepare: ok")
+			continue
+		case "commit":
+			if err := tx.Commit(); err != nil {
+				fatal(err)
+			}
+			fmt.Println("commit: ok")
+			explicit, pending = false, false
+			tx = repo.NewRefTransaction()
+			continue
+		case "abort":
+			tx.Abort()
+			fmt.Println("abort: ok")
+			explicit, pending = false, false
+			tx = repo.NewRefTransaction()
+			continue
+		case "option":
+			if len(args) != 1 || args[0] != "no-deref" {
+				fatal(fmt.Errorf("option unknown: %s", strings.Join(args, " ")))
+			}
+			optNoDeref = true
+			continue
+		}
+		u, err := parseRefCommand(command, args)
+		if err != nil {
+			fatal(err)
+		}
+		u.NoDeref = noDeref || optNoDeref
+		u.Message = message
+		optNoDeref = false
+		if err := tx.Update(u); err != nil {
+			fatal(err)
+		}
+		pending = true
+	}
+	if explicit {
+		tx.Abort()
+	} else if pending {
+		if err := tx.Commit(); err != nil {
+			fatal(err)
+		}
+	}
+}
+
+// readRefCommand reads one update-ref --stdin command. Lines hold space
+// separated arguments; with -z the ref and each further argument are
+// terminated by NUL.
+func readRefCommand(in *bufio.Reader, nulTerm bool) (string, []string, error) {
+	delim := byte('\n')
+	if nulTerm {
+		delim = 0
+	}
+	line, err := in.ReadString(delim)
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	line = strings.TrimSuffix(line, string(delim))
+	if !nulTerm {
+		fields := strings.Split(line, " ")
+		return fields[0], fields[1:], nil
+	}
+	command, ref, found := strings.Cut(line, " ")
+	if !found {
+		return command, nil, nil
+	}
+	args := []string{ref}
+	if command == "option" {
+		return command, args, nil
+	}
+	for i := 0; i < refArgCounts[command]; i++ {
+		arg, err := in.ReadString(0)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s %s: missing argument", command, ref)
+		}
+		args = append(args, strings.TrimSuffix(arg, "\x00"))
+	}
+	return command, args, nil
+}
+
+// parseRefCommand converts an update, create, delete or verify command to
+// a ref update. A missing or empty old value is not checked, except that
+// verify then requires the ref not to exist.
+func parseRefCommand(command string, args []string) (mygit.RefUpdate, error) {
+	max, ok := refArgCounts[command]
+	if !ok {
+		return mygit.RefUpdate{}, fmt.Errorf("unknown command: %s", command)
+	}
+	if len(args) < 1 || len(args) > max+1 || command == "update" && len(args) < 2 || command == "create" && len(args) < 2 {
+		return mygit.RefUpdate{}, fmt.Errorf("%s: wrong number of arguments", command)
+	}
+	u := mygit.RefUpdate{Name: args[0]}
+	old := ""
+	switch command {
+	case "update":
+		u.New = refValue(args[1])
+		if len(args) == 3 {
+			old = args[2]
+		}
+	case "create":
+		if u.New = refValue(args[1]); u.New.IsZero() {
+			return mygit.RefUpdate{}, fmt.Errorf("create %s: zero new value", u.Name)
+		}
+		u.HaveOld = true
+	case "delete", "verify":
+		if len(args) == 2 {
+			old = args[1]
+		}
+		u.Verify, u.HaveOld = command == "verify", command == "verify"
+	}
+	if old != "" {
+		u.Old, u.HaveOld = refValue(old), true
+	}
+	return u, nil
+}
+
+func symbolicRef(args []string, message string, short, quiet, del bool) {
+	name := args[0]
+	target, err := repo.ReadSymbolicRef(name)
+	if err != nil && !errors.Is(err, mygit.ErrRefNotFound) {
+		fatal(err)
+	}
+	switch {
+	case len(args) == 2:
+		if err := repo.SetSymbolicRef(name, args[1], message); err != nil {
+			fatal(err)
+		}
+	case target == "":
+		if !quiet {
+			fatal(fmt.Errorf("ref %s is not a symbolic ref", name))
+		}
+		os.Exit(1)
+	case del:
+		if name == "HEAD" {
+			fatal(fmt.Errorf("deleting '%s' is not allowed", name))
+		}
+		tx := repo.NewRefTransaction()
+		if err := tx.Update(mygit.RefUpdate{Name: name, NoDeref: true}); err != nil {
+			fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			fatal(err)
+		}
+	case short:
+		fmt.Println(repo.ShortRefName(target))
+	default:
+		fmt.Println(target)
+	}
+}
+
+type showRefOptions struct {
+	head     bool
+	heads    bool
+	tags     bool
+	deref    bool
+	hashOnly bool
+	abbrev   int
+	verify   bool
+	quiet    bool
+}
+
+// showRef lists refs matching patterns, which match whole trailing
+// components of ref names. With verify, the arguments are full ref names
+// that must all exist. It exits with status 1 if nothing was shown.
+func showRef(patterns []string, opts showRefOptions) {
+	var refs []mygit.Ref
+	if opts.verify {
+		for _, name := range patterns {
+			ref, err := repo.ResolveRef(name)
+			if err != nil || name != "HEAD" && !strings.HasPrefix(name, "refs/") {
+				if opts.quiet {
+					os.Exit(1)
+				}
+				fatal(fmt.Errorf("'%s' - not a valid ref", name))
+			}
+			ref.Name = name
+			refs = append(refs, ref)
+		}
+	} else {
+		all, err := repo.ListRefs("refs/")
+		if err != nil {
+			fatal(err)
+		}
+		if opts.head {
+			if head, err := repo.ResolveRef("HEAD"); err == nil {
+				head.Name = "HEAD"
+				refs = append(refs, head)
+			}
+		}
+		for _, ref := range all {
+			if opts.heads || opts.tags {
+				if !(opts.heads && strings.HasPrefix(ref.Name, "refs/heads/") || opts.tags && strings.HasPrefix(ref.Name, "refs/tags/")) {
+					continue
+				}
+			}
+			if len(patterns) == 0 || matchRefTail(ref.Name, patterns) {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	if len(refs) == 0 {
+		os.Exit(1)
+	}
+	if opts.quiet {
+		return
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	show := func(id odb.ID, name string) {
+		hash := id.String()
+		if opts.abbrev > 0 {
+			hash = repo.Abbreviate(id, opts.abbrev)
+		}
+		if opts.hashOnly {
+			fmt.Fprintln(out, hash)
+		} else {
+			fmt.Fprintf(out, "%s %s\n", hash, name)
+		}
+	}
+	for _, ref := range refs {
+		show(ref.ID, ref.Name)
+		if opts.deref {
+			if peeled, err := repo.PeelRef(ref); err == nil && peeled != ref.ID {
+				show(peeled, ref.Name+"^{}")
+			}
+		}
+	}
+}
+
+// matchRefTail reports whether a ref name equals a pattern or ends with
+// "/" and the pattern.
+func matchRefTail(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if name == pattern || strings.HasSuffix(name, "/"+pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func packRefs(all bool) {
+	if err := repo.PackRefs(all); err != nil {
+		fatal(err)
+	}
+}
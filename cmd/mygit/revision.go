@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// resolve returns the object named by a revision, exiting if there is none.
+func resolve(rev string) odb.ID {
+	id, err := repo.ResolveRevision(rev)
+	if err != nil {
+		fatal(err)
+	}
+	return id
+}
+
+// resolveAs resolves a revision and peels it to an object of type t.
+func resolveAs(rev string, t odb.Type) odb.ID {
+	id, err := repo.Peel(resolve(rev), t)
+	if err != nil {
+		fatal(err)
+	}
+	return id
+}
+
+func revParse(revs []string, short, verify bool) {
+	if verify && len(revs) != 1 {
+		fatal(fmt.Errorf("--verify requires exactly one revision"))
+	}
+	for _, rev := range revs {
+		id := resolve(rev)
+		if verify && !repo.Objects.Has(id) {
+			fatal(fmt.Errorf("%w: %s", odb.ErrNotFound, id))
+		}
+		if short {
+			fmt.Println(repo.Abbreviate(id, 7))
+		} else {
+			fmt.Println(id)
+		}
+	}
+}
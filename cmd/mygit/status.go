@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/mygit"
+)
+
+// porcelainFlag is the value of --porcelain[=<version>].
+type porcelainFlag int
+
+func (p *porcelainFlag) String() string { return fmt.Sprintf("v%d", int(*p)) }
+
+func (p *porcelainFlag) Set(s string) error {
+	switch s {
+	case "true", "v1", "1":
+		*p = 1
+	case "v2", "2":
+		*p = 2
+	case "false":
+		*p = 0
+	default:
+		return fmt.Errorf("unsupported porcelain version %q", s)
+	}
+	return nil
+}
+
+func (p *porcelainFlag) IsBoolFlag() bool { return true }
+
+// untrackedFlag is the value of -u/--untracked-files[=<mode>].
+type untrackedFlag int
+
+func (u *untrackedFlag) String() string {
+	return [...]string{"normal", "all", "no"}[*u]
+}
+
+func (u *untrackedFlag) Set(s string) error {
+	switch s {
+	case "true", "all":
+		*u = mygit.UntrackedAll
+	case "normal":
+		*u = mygit.UntrackedNormal
+	case "no", "false":
+		*u = mygit.UntrackedNo
+	default:
+		return fmt.Errorf("invalid untracked files mode %q", s)
+	}
+	return nil
+}
+
+func (u *untrackedFlag) IsBoolFlag() bool { return true }
+
+type statusOptions struct {
+	porcelain int
+	short     bool
+	branch    bool
+	nulTerm   bool
+	untracked int
+	ignored   bool
+}
+
+func status(paths []string, opts statusOptions) {
+	st, err := repo.Status(mygit.StatusOptions{
+		Paths:     pathspecs(paths),
+		Untracked: opts.untracked,
+		Ignored:   opts.ignored,
+	})
+	if err != nil {
+		fatal(err)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	eol := "\n"
+	if opts.nulTerm {
+		eol = "\x00"
+	}
+	switch {
+	case opts.porcelain == 2:
+		statusV2(out, st, opts.branch, eol)
+	case opts.porcelain == 1 || opts.short || opts.nulTerm:
+		statusShort(out, st, opts.branch, opts.porcelain == 0, eol)
+	default:
+		statusLong(out, st, opts.untracked)
+	}
+}
+
+// displayPath returns a repository-relative path relative to the current
+// directory.
+func displayPath(name string) string {
+	if prefix == "" {
+		return name
+	}
+	rel, err := filepath.Rel(filepath.FromSlash(prefix), filepath.FromSlash(name))
+	if err != nil {
+		return name
+	}
+	rel = filepath.ToSlash(rel)
+	if strings.HasSuffix(name, "/") {
+		rel += "/"
+	}
+	return rel
+}
+
+// upstreamStatus compares the current branch with its upstream.
+type upstreamStatus struct {
+	name          string // short name of the upstream
+	gone          bool   // the upstream or the branch has no commit
+	ahead, behind int
+}
+
+// branchUpstream returns how the current branch compares with its
+// upstream, or nil for a detached HEAD or a branch without upstream.
+func branchUpstream(st *mygit.Status) *upstreamStatus {
+	if st.Branch == "" {
+		return nil
+	}
+	upstream, err := repo.Upstream(strings.TrimPrefix(st.Branch, "refs/heads/"))
+	if err != nil {
+		return nil
+	}
+	u := &upstreamStatus{name: repo.ShortRefName(upstream)}
+	tip, err := repo.ReadRef(upstream)
+	if err != nil || st.Head.IsZero() {
+		u.gone = true
+		return u
+	}
+	if u.ahead, u.behind, err = repo.AheadBehind(st.Head, tip); err != nil {
+		fatal(err)
+	}
+	return u
+}
+
+// branchLine returns the branch header of short status.
+func branchLine(st *mygit.Status) string {
+	branch := strings.TrimPrefix(st.Branch, "refs/heads/")
+	switch {
+	case st.Branch == "":
+		return "## HEAD (no branch)"
+	case st.Head.IsZero():
+		branch = "No commits yet on " + branch
+	}
+	u := branchUpstream(st)
+	switch {
+	case u == nil:
+		return "## " + branch
+	case u.gone:
+		return "## " + branch + "..." + u.name + " [gone]"
+	}
+	var counts []string
+	if u.ahead > 0 {
+		counts = append(counts, fmt.Sprintf("ahead %d", u.ahead))
+	}
+	if u.behind > 0 {
+		counts = append(counts, fmt.Sprintf("behind %d", u.behind))
+	}
+	if len(counts) == 0 {
+		return "## " + branch + "..." + u.name
+	}
+	return "## " + branch + "..." + u.name + " [" + strings.Join(counts, ", ") + "]"
+}
+
+// trackingMessage returns the paragraph of long status that compares the
+// current branch with its upstream, or "" if there is none.
+func trackingMessage(u *upstreamStatus) string {
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 commit"
+		}
+		return fmt.Sprintf("%d commits", n)
+	}
+	switch {
+	case u == nil:
+		return ""
+	case u.gone:
+		return fmt.Sprintf("Your branch is based on '%s', but the upstream is gone.\n"+
+			"  (use \"git branch --unset-upstream\" to fixup)\n", u.name)
+	case u.ahead > 0 && u.behind > 0:
+		return fmt.Sprintf("Your branch and '%s' have diverged,\n"+
+			"and have %d and %d different commits each, respectively.\n"+
+			"  (use \"git pull\" to merge the remote branch into yours)\n", u.name, u.ahead, u.behind)
+	case u.ahead > 0:
+		return fmt.Sprintf("Your branch is ahead of '%s' by %s.\n"+
+			"  (use \"git push\" to publish your local commits)\n", u.name, plural(u.ahead))
+	case u.behind > 0:
+		return fmt.Sprintf("Your branch is behind '%s' by %s, and can be fast-forwarded.\n"+
+			"  (use \"git pull\" to update your local branch)\n", u.name, plural(u.behind))
+	}
+	return fmt.Sprintf("Your branch is up to date with '%s'.\n", u.name)
+}
+
+func statusShort(out *bufio.Writer, st *mygit.Status, branch, relative bool, eol string) {
+	show := func(name string) string {
+		if relative {
+			return displayPath(name)
+		}
+		return name
+	}
+	if branch {
+		fmt.Fprint(out, branchLine(st), eol)
+	}
+	for _, f := range st.Files {
+		fmt.Fprintf(out, "%c%c %s%s", f.Staged, f.Unstaged, show(f.Path), eol)
+	}
+	for _, name := range st.Untracked {
+		fmt.Fprintf(out, "?? %s%s", show(name), eol)
+	}
+	for _, name := range st.Ignored {
+		fmt.Fprintf(out, "!! %s%s", show(name), eol)
+	}
+}
+
+func statusV2(out *bufio.Writer, st *mygit.Status, branch bool, eol string) {
+	if branch {
+		oid, head := "(initial)", "(detached)"
+		if !st.Head.IsZero() {
+			oid = st.Head.String()
+		}
+		if st.Branch != "" {
+			head = strings.TrimPrefix(st.Branch, "refs/heads/")
+		}
+		fmt.Fprintf(out, "# branch.oid %s%s# branch.head %s%s", oid, eol, head, eol)
+		if u := branchUpstream(st); u != nil {
+			fmt.Fprintf(out, "# branch.upstream %s%s", u.name, eol)
+			if !u.gone {
+				fmt.Fprintf(out, "# branch.ab +%d -%d%s", u.ahead, u.behind, eol)
+			}
+		}
+	}
+	zero := repo.Hash.ZeroID()
+	code := func(c byte) byte {
+		if c == mygit.StatusUnmodified {
+			return '.'
+		}
+		return c
+	}
+	for _, f := range st.Files {
+		sub := "N..."
+		if f.IndexMode == mygit.ModeGitlink || f.HeadMode == mygit.ModeGitlink {
+			sub = "S..."
+		}
+		if !f.Unmerged() {
+			headID, indexID := f.HeadID, f.IndexID
+			if headID.IsZero() {
+				headID = zero
+			}
+			if indexID.IsZero() {
+				indexID = zero
+			}
+			fmt.Fprintf(out, "1 %c%c %s %06o %06o %06o %s %s %s%s",
+				code(f.Staged), code(f.Unstaged), sub, uint32(f.HeadMode), uint32(f.IndexMode),
+				uint32(f.WorktreeMode), headID, indexID, f.Path, eol)
+			continue
+		}
+		modes := make([]string, 3)
+		ids := make([]string, 3)
+		for stage := 1; stage <= 3; stage++ {
+			modes[stage-1], ids[stage-1] = "000000", zero.String()
+			if e := f.Stages[stage]; e != nil {
+				modes[stage-1], ids[stage-1] = fmt.Sprintf("%06o", e.Mode), e.ID.String()
+			}
+		}
+		fmt.Fprintf(out, "u %c%c %s %s %06o %s %s%s", f.Staged, f.Unstaged, sub,
+			strings.Join(modes, " "), uint32(f.WorktreeMode), strings.Join(ids, " "), f.Path, eol)
+	}
+	for _, name := range st.Untracked {
+		fmt.Fprintf(out, "? %s%s", name, eol)
+	}
+	for _, name := range st.Ignored {
+		fmt.Fprintf(out, "! %s%s", name, eol)
+	}
+}
+
+// changeLabels name the kinds of changes in long status output.
+var changeLabels = map[byte]string{
+	mygit.StatusAdded:       "new file:",
+	mygit.StatusModified:    "modified:",
+	mygit.StatusDeleted:     "deleted:",
+	mygit.StatusTypeChanged: "typechange:",
+}
+
+// conflictLabels name the kinds of conflicts by their short status code.
+var conflictLabels = map[string]string{
+	"UU": "both modified:",
+	"AA": "both added:",
+	"DD": "both deleted:",
+	"AU": "added by us:",
+	"UA": "added by them:",
+	"DU": "deleted by us:",
+	"UD": "deleted by them:",
+}
+
+func statusLong(out *bufio.Writer, st *mygit.Status, untrackedMode int) {
+	switch {
+	case st.Branch == "":
+		fmt.Fprintf(out, "HEAD detached at %s\n", repo.Abbreviate(st.Head, 7))
+	default:
+		fmt.Fprintf(out, "On branch %s\n", strings.TrimPrefix(st.Branch, "refs/heads/"))
+	}
+	if st.Head.IsZero() {
+		fmt.Fprint(out, "\nNo commits yet\n\n")
+	} else if msg := trackingMessage(branchUpstream(st)); msg != "" {
+		fmt.Fprint(out, msg, "\n")
+	}
+	var staged, unstaged, unmerged []mygit.FileStatus
+	deleted := false
+	for _, f := range st.Files {
+		switch {
+		case f.Unmerged():
+			unmerged = append(unmerged, f)
+			continue
+		case f.Unstaged != mygit.StatusUnmodified:
+			unstaged = append(unstaged, f)
+			deleted = deleted || f.Unstaged == mygit.StatusDeleted
+		}
+		if f.Staged != mygit.StatusUnmodified {
+			staged = append(staged, f)
+		}
+	}
+	if len(staged) > 0 {
+		fmt.Fprint(out, "Changes to be committed:\n")
+		if st.Head.IsZero() {
+			fmt.Fprint(out, "  (use \"git rm --cached <file>...\" to unstage)\n")
+		} else {
+			fmt.Fprint(out, "  (use \"git restore --staged <file>...\" to unstage)\n")
+		}
+		for _, f := range staged {
+			fmt.Fprintf(out, "\t%-12s%s\n", changeLabels[f.Staged], displayPath(f.Path))
+		}
+		fmt.Fprintln(out)
+	}
+	if len(unmerged) > 0 {
+		hint := "\"git add <file>...\""
+		for _, f := range unmerged {
+			if f.Staged == mygit.StatusDeleted || f.Unstaged == mygit.StatusDeleted {
+				hint = "\"git add/rm <file>...\" as appropriate"
+			}
+		}
+		fmt.Fprintf(out, "Unmerged paths:\n  (use %s to mark resolution)\n", hint)
+		for _, f := range unmerged {
+			fmt.Fprintf(out, "\t%-17s%s\n", conflictLabels[string([]byte{f.Staged, f.Unstaged})], displayPath(f.Path))
+		}
+		fmt.Fprintln(out)
+	}
+	if len(unstaged) > 0 {
+		fmt.Fprint(out, "Changes not staged for commit:\n")
+		if deleted {
+			fmt.Fprint(out, "  (use \"git add/rm <file>...\" to update what will be committed)\n")
+		} else {
+			fmt.Fprint(out, "  (use \"git add <file>...\" to update what will be committed)\n")
+		}
+		fmt.Fprint(out, "  (use \"git restore <file>...\" to discard changes in working directory)\n")
+		for _, f := range unstaged {
+			fmt.Fprintf(out, "\t%-12s%s\n", changeLabels[f.Unstaged], displayPath(f.Path))
+		}
+		fmt.Fprintln(out)
+	}
+	listFiles(out, "Untracked files", "git add <file>...", st.Untracked)
+	listFiles(out, "Ignored files", "git add -f <file>...", st.Ignored)
+	if len(staged) > 0 {
+		return
+	}
+	switch {
+	case len(unstaged) > 0 || len(unmerged) > 0:
+		fmt.Fprint(out, "no changes added to commit (use \"git add\" and/or \"git commit -a\")\n")
+	case len(st.Untracked) > 0:
+		fmt.Fprint(out, "nothing added to commit but untracked files present (use \"git add\" to track)\n")
+	case st.Head.IsZero():
+		fmt.Fprint(out, "nothing to commit (create/copy files and use \"git add\" to track)\n")
+	case untrackedMode == mygit.UntrackedNo:
+		fmt.Fprint(out, "nothing to commit (use -u to show untracked files)\n")
+	default:
+		fmt.Fprint(out, "nothing to commit, working tree clean\n")
+	}
+}
+
+func listFiles(out *bufio.Writer, title, hint string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "%s:\n  (use \"%s\" to include in what will be committed)\n", title, hint)
+	for _, name := range names {
+		fmt.Fprintf(out, "\t%s\n", displayPath(name))
+	}
+	fmt.Fprintln(out)
+}
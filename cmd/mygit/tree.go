@@ -1,183 +1,187 @@
 package main
 
 import (
-	"bytes"
-	"compress/zlib"
-	"crypto/sha1"
-	"crypto/sha256"
+	"bufio"
 	"fmt"
 	"io"
 	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
-	"time"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/mygit"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
 )
 
-func lsTree(hash string, namesOnly bool) {
-	path := fmt.Sprintf(".git/objects/%s/%s", hash[:2], hash[2:])
-	file, err := os.Open(path)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading file: %s\n", err)
-		os.Exit(1)
-	}
-	defer file.Close()
-	r, err := zlib.NewReader(file)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating zlib reader: %s\n", err)
-		os.Exit(1)
-	}
-	defer r.Close()
-	var data bytes.Buffer
-	_, err = io.Copy(&data, r)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading data: %s\n", err)
-		os.Exit(1)
-	}
-	var bs []byte
-	tree := make([]string, 0)
-	bs, err = data.ReadBytes(byte(0))
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading data: %s\n", err)
-		os.Exit(1)
-	}
-	header := string(bs)
-	header = strings.TrimSuffix(header, "\x00")
-	if strings.Split(header, " ")[0] != "tree" {
-		fmt.Fprintf(os.Stderr, "File is not a tree\n")
-		os.Exit(1)
+// printTreeEntry prints a tree entry in ls-tree format.
+func printTreeEntry(entry mygit.TreeEntry) {
+	fmt.Printf("%s %s %s\t%s\n", entry.Mode, entry.Mode.Type(), entry.ID, entry.Name)
+}
+
+type lsTreeOptions struct {
+	nameOnly  bool
+	recurse   bool
+	showTrees bool
+	onlyTrees bool
+	long      bool
+	fullTree  bool
+	nulTerm   bool
+}
+
+// pathMatch is how a tree path relates to the ls-tree path arguments.
+type pathMatch int
+
+const (
+	pathExcluded pathMatch = iota
+	// pathAncestor entries lead to a requested path and are descended
+	// into without being listed.
+	pathAncestor
+	pathIncluded
+)
+
+// matchPath reports how path relates to specs. A spec names an entry, or,
+// with a trailing slash, the contents of a directory.
+func matchPath(path string, specs []string) pathMatch {
+	if len(specs) == 0 {
+		return pathIncluded
+	}
+	match := pathExcluded
+	for _, spec := range specs {
+		dir := strings.TrimSuffix(spec, "/")
+		switch {
+		case dir == "" || strings.HasPrefix(path, dir+"/"):
+			return pathIncluded
+		case path == dir && dir != spec:
+			match = pathAncestor
+		case path == dir:
+			return pathIncluded
+		case strings.HasPrefix(dir, path+"/"):
+			match = pathAncestor
+		}
 	}
-	tree = append(tree, header)
-	for data.Len() > 0 {
-		bs, err = data.ReadBytes(byte(' '))
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading data: %s\n", err)
-			os.Exit(1)
+	return match
+}
+
+func lsTree(treeish string, paths []string, opts lsTreeOptions) {
+	specs := make([]string, 0, len(paths))
+	base := prefix
+	if opts.fullTree {
+		base = ""
+	}
+	for _, p := range paths {
+		spec := path.Join(base, p)
+		if spec == "." {
+			spec = ""
 		}
-		mode := string(bs)
-		mode = strings.TrimSuffix(mode, " ")
-		var ftype string
-		if mode == "040000" {
-			ftype = "tree"
-		} else if mode == "100644" {
-			ftype = "blob"
+		if strings.HasSuffix(p, "/") || p == "." || p == ".." {
+			spec += "/"
 		}
-		bs, err = data.ReadBytes(byte(0))
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading data: %s\n", err)
-			os.Exit(1)
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 && base != "" {
+		specs = append(specs, base)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	terminator := "\n"
+	if opts.nulTerm {
+		terminator = "\x00"
+	}
+	show := func(name string, entry mygit.TreeEntry) {
+		if base != "" {
+			if rel, err := filepath.Rel(base, name); err == nil {
+				name = filepath.ToSlash(rel)
+			}
+			if name == "." {
+				name = "./"
+			}
 		}
-		name := string(bs)
-		strings.TrimSuffix(name, "\x00")
-		bs = data.Next(20)
-		hash := fmt.Sprintf("%x", bs)
-		entry := []string{
-			mode, ftype, hash, name,
+		if opts.nameOnly {
+			fmt.Fprint(out, name, terminator)
+			return
 		}
-		var row string
-		if namesOnly {
-			row = name
-		} else {
-			row = strings.Join(entry, " ")
+		fmt.Fprintf(out, "%s %s %s", entry.Mode, entry.Mode.Type(), entry.ID)
+		if opts.long {
+			size := "-"
+			if entry.Mode.Type() == odb.Blob {
+				_, data, err := repo.ReadObject(entry.ID)
+				if err != nil {
+					out.Flush()
+					fatal(err)
+				}
+				size = strconv.Itoa(len(data))
+			}
+			fmt.Fprintf(out, " %7s", size)
 		}
-		tree = append(tree, row)
+		fmt.Fprintf(out, "\t%s%s", name, terminator)
 	}
-	for _, row := range tree {
-		fmt.Println(row)
-	}
-}
 
-func writeTree(path string) string {
-	var tree string
-	entries, err := os.ReadDir(path)
-	for _, entry := range entries {
-		if entry.IsDir() && entry.Name() == ".git" {
-			continue
+	var walk func(tree odb.ID, dir string)
+	walk = func(tree odb.ID, dir string) {
+		entries, err := repo.ReadTree(tree)
+		if err != nil {
+			out.Flush()
+			fatal(err)
 		}
-		if entry.IsDir() {
-			mode := "040000"
-			hash := writeTree(path + "/" + entry.Name())
-			tree += fmt.Sprintf("%s %s\x00%s", mode, entry.Name(), string(hash[:]))
-		} else {
-			mode := "100644"
-			data, err := os.ReadFile(path + "/" + entry.Name())
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error reading file: %s\n", err)
-				os.Exit(1)
+		for _, entry := range entries {
+			path := dir + entry.Name
+			isTree := entry.Mode == mygit.ModeTree
+			switch matchPath(path, specs) {
+			case pathAncestor:
+				if !isTree {
+					continue
+				}
+				if opts.showTrees {
+					show(path, entry)
+				}
+				walk(entry.ID, path+"/")
+			case pathIncluded:
+				recurse := isTree && opts.recurse
+				if opts.onlyTrees && !isTree {
+					continue
+				}
+				if !recurse || opts.showTrees || opts.onlyTrees {
+					show(path, entry)
+				}
+				if recurse {
+					walk(entry.ID, path+"/")
+				}
 			}
-			hash := sha1.Sum(data)
-			tree += fmt.Sprintf("%s %s\x00%s", mode, entry.Name(), string(hash[:]))
 		}
 	}
-	data := []byte(tree)
-	data = append([]byte(fmt.Sprintf("tree %d", len(data)) + "\x00"), data...)
-	shash := sha1.Sum(data)
-	hsum  := sha256.Sum256(data)
-	lhash := fmt.Sprintf("%x", hsum[:])
-	folder := fmt.Sprintf(".git/objects/%s", lhash[:2])
-	filepath := fmt.Sprintf("%s/%s", folder, lhash[2:])
-	err = os.Mkdir(folder, 0750)
-	if err != nil && !os.IsExist(err) {
-		fmt.Fprintf(os.Stderr, "Error creating directory: %s\n", err)
-		os.Exit(1)
-	}
-	file, err := os.Create(filepath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating file: %s\n", err)
-		os.Exit(1)
-	}
-	defer file.Close()
-	w := zlib.NewWriter(file)
-	_, err = w.Write(data)
+	walk(resolveAs(treeish, odb.Tree), "")
+}
+
+func writeTree(prefix string) {
+	id, err := repo.WriteTree(prefix)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error compressing data: %s\n", err)
-		os.Exit(1)
+		fatal(err)
 	}
-	w.Close()
-	fmt.Println(lhash)
-	return string(shash[:])
+	fmt.Println(id)
 }
 
-func commitTree(hash, parent, message string) {
-	_, err := os.Stat(".git/config")
-	if os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "Git is not configured. Try 'config'\n")
-		os.Exit(1)
-	}
-	b, err := os.ReadFile(".git/config")
-	s := string(b)
-	conf := strings.Split(s, "\n")
-	conf = conf[:len(conf)-1]
-	name := strings.Split(conf[0], "=")[1]
-	email := strings.Split(conf[1], "=")[1]
-	var commit string
-	commit += fmt.Sprintf("tree %s\x00", hash)
-	if parent != "" {
-		commit += fmt.Sprintf("parent %s\x00", parent)
-	}
-	commit += fmt.Sprintf("author %s %s %d\x00", name, email, time.Now().Unix())
-	commit += fmt.Sprintf("%s\x00", message)
-	data := []byte(commit)
-	data = append([]byte(fmt.Sprintf("commit %d\x00", len(data))), data...)
-	hashsum := fmt.Sprintf("%x", sha256.Sum256(data))
-	path := fmt.Sprintf(".git/objects/%s", hashsum[:2])
-	filepath := fmt.Sprintf("%s/%s", path, hashsum[2:])
-	err = os.Mkdir(path, 0750)
-	if err != nil && !os.IsExist(err) {
-		fmt.Fprintf(os.Stderr, "Error creating directory: %s\n", err)
-		os.Exit(1)
-	}
-	file, err := os.Create(filepath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating file: %s\n", err)
-		os.Exit(1)
+func commitTree(treeish string, parentRevs, messages []string) {
+	tree := resolveAs(treeish, odb.Tree)
+	parents := make([]odb.ID, 0, len(parentRevs))
+	for _, rev := range parentRevs {
+		parents = append(parents, resolveAs(rev, odb.Commit))
+	}
+	var message string
+	if len(messages) > 0 {
+		// Like git, each -m is a paragraph terminated by a newline.
+		message = strings.Join(messages, "\n\n") + "\n"
+	} else {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fatal(err)
+		}
+		message = string(data)
 	}
-	defer file.Close()
-	w := zlib.NewWriter(file)
-	_, err = w.Write(data)
+	id, err := repo.CommitTree(tree, parents, message)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error compressing data: %s\n", err)
-		os.Exit(1)
+		fatal(err)
 	}
-	w.Close()
-	fmt.Println(hashsum)
+	fmt.Println(id)
 }
-
@@ -0,0 +1,222 @@
+// Package diff computes line-based differences with the Myers algorithm and
+// groups them into unified diff hunks.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Op is the kind of a diff line.
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// Line is a line of a diff. Text includes the line terminator, which is
+// missing only on the last line of a file without a final newline.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Lines splits data into lines, keeping line terminators.
+func Lines(data []byte) []string {
+	lines := make([]string, 0, bytes.Count(data, []byte("\n"))+1)
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			lines = append(lines, string(data))
+			break
+		}
+		lines = append(lines, string(data[:i+1]))
+		data = data[i+1:]
+	}
+	return lines
+}
+
+// Diff returns a shortest edit script turning a into b.
+func Diff(a, b []string) []Line {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	trace := make([][]int, 0)
+	// Forward pass: v[k] is the furthest x reached on diagonal k = x - y.
+	for d := 0; d <= max; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+		done := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+	// Backtrack from the end to recover the edits.
+	lines := make([]Line, 0, max)
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			lines = append(lines, Line{Equal, a[x]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			lines = append(lines, Line{Insert, b[y]})
+		} else {
+			x--
+			lines = append(lines, Line{Delete, a[x]})
+		}
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
+
+// Hunk is a group of changes with surrounding context.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []Line
+	// pos is the zero-based index of the hunk's first line in the old
+	// file.
+	pos int
+}
+
+// Hunks returns the hunks of the diff from a to b with the given number of
+// context lines around each change.
+func Hunks(a, b []string, context int) []Hunk {
+	lines := Diff(a, b)
+	hunks := make([]Hunk, 0)
+	oldPos, newPos := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for i, l := range lines {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if l.Op != Insert {
+			oldPos[i+1]++
+		}
+		if l.Op != Delete {
+			newPos[i+1]++
+		}
+	}
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			i++
+			continue
+		}
+		start := max(i-context, 0)
+		end := i
+		// Extend the hunk while changes are within 2*context lines.
+		for end < len(lines) {
+			if lines[end].Op != Equal {
+				end++
+				continue
+			}
+			next := end
+			for next < len(lines) && lines[next].Op == Equal {
+				next++
+			}
+			if next == len(lines) || next-end > 2*context {
+				end = min(end+context, len(lines))
+				break
+			}
+			end = next
+		}
+		h := Hunk{
+			OldStart: oldPos[start] + 1,
+			OldLines: oldPos[end] - oldPos[start],
+			NewStart: newPos[start] + 1,
+			NewLines: newPos[end] - newPos[start],
+			Lines:    lines[start:end],
+			pos:      oldPos[start],
+		}
+		// Empty ranges are numbered by the line before them.
+		if h.OldLines == 0 {
+			h.OldStart--
+		}
+		if h.NewLines == 0 {
+			h.NewStart--
+		}
+		hunks = append(hunks, h)
+		i = end
+	}
+	return hunks
+}
+
+// String formats the hunk in unified diff format.
+func (h Hunk) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+	for _, l := range h.Lines {
+		sb.WriteByte(" +-"[l.Op])
+		sb.WriteString(l.Text)
+		if !strings.HasSuffix(l.Text, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+	return sb.String()
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// Apply applies a subset of the hunks computed from a, in order, to a.
+func Apply(a []string, hunks []Hunk) []byte {
+	var buf bytes.Buffer
+	pos := 0
+	for _, h := range hunks {
+		for ; pos < h.pos; pos++ {
+			buf.WriteString(a[pos])
+		}
+		for _, l := range h.Lines {
+			if l.Op != Delete {
+				buf.WriteString(l.Text)
+			}
+		}
+		pos += h.OldLines
+	}
+	for ; pos < len(a); pos++ {
+		buf.WriteString(a[pos])
+	}
+	return buf.Bytes()
+}
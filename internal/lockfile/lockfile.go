@@ -0,0 +1,59 @@
+// Package lockfile implements git-style lock files.
+//
+// A file is updated by writing its new content to "<path>.lock", created
+// exclusively, and renaming it over the original. Concurrent writers fail
+// to create the lock instead of overwriting each other's changes.
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrLocked is returned when another process holds the lock.
+var ErrLocked = errors.New("file is locked")
+
+// File is a held lock on a path.
+type File struct {
+	path string
+	file *os.File
+}
+
+// Create takes the lock on path.
+func Create(path string) (*File, error) {
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("%w: %s.lock exists", ErrLocked, path)
+	} else if err != nil {
+		return nil, err
+	}
+	return &File{path, f}, nil
+}
+
+// Write writes to the lock file.
+func (l *File) Write(p []byte) (int, error) {
+	return l.file.Write(p)
+}
+
+// Commit replaces the original file with the lock file's content and
+// releases the lock.
+func (l *File) Commit() error {
+	if err := l.file.Close(); err != nil {
+		os.Remove(l.file.Name())
+		return err
+	}
+	if err := os.Rename(l.file.Name(), l.path); err != nil {
+		os.Remove(l.file.Name())
+		return err
+	}
+	return nil
+}
+
+// Rollback discards the lock file and releases the lock. It is safe to
+// call after Commit.
+func (l *File) Rollback() {
+	if l.file.Close() == nil {
+		os.Remove(l.file.Name())
+	}
+}
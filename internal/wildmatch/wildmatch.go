@@ -0,0 +1,58 @@
+// Package wildmatch implements the glob patterns used by gitignore files
+// and config conditions. A single * or ? does not match a slash, while **
+// as a whole path component matches any number of directories.
+package wildmatch
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Compile returns a regular expression matching whole strings against the
+// glob, optionally ignoring case.
+func Compile(glob string, foldCase bool) (*regexp.Regexp, error) {
+	expr := "^" + Regexp(glob) + "$"
+	if foldCase {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// Regexp translates a glob to a regular expression matching the same
+// strings, without anchors.
+func Regexp(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case glob[i:] == "**" && (i == 0 || glob[i-1] == '/'):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,305 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/wildmatch"
+)
+
+// Scope is the level a configuration file applies to.
+type Scope int
+
+const (
+	ScopeSystem Scope = iota + 1
+	ScopeGlobal
+	ScopeLocal
+	// ScopeCommand is a file named on the command line.
+	ScopeCommand
+)
+
+func (s Scope) String() string {
+	switch s {
+	case ScopeSystem:
+		return "system"
+	case ScopeGlobal:
+		return "global"
+	case ScopeLocal:
+		return "local"
+	case ScopeCommand:
+		return "command"
+	}
+	return "unknown"
+}
+
+// maxIncludeDepth bounds include chains, which catches include loops.
+const maxIncludeDepth = 10
+
+// SystemPath returns the location of the system configuration file, or an
+// empty string if GIT_CONFIG_NOSYSTEM disables it.
+func SystemPath() string {
+	if b, err := ParseBool(os.Getenv("GIT_CONFIG_NOSYSTEM")); err == nil && b {
+		return ""
+	}
+	if path := os.Getenv("GIT_CONFIG_SYSTEM"); path != "" {
+		return path
+	}
+	return "/etc/gitconfig"
+}
+
+// GlobalPath returns the location of the user's configuration file:
+// GIT_CONFIG_GLOBAL if set, otherwise ~/.gitconfig, or the XDG location if
+// only that exists.
+func GlobalPath() string {
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		return path
+	}
+	home, _ := os.UserHomeDir()
+	dotfile := filepath.Join(home, ".gitconfig")
+	if _, err := os.Stat(dotfile); err == nil {
+		return dotfile
+	}
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		xdg = filepath.Join(home, ".config")
+	}
+	if path := filepath.Join(xdg, "git", "config"); fileExists(path) {
+		return path
+	}
+	return dotfile
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Config is the merged configuration of all scopes. Later entries override
+// earlier ones.
+type Config struct {
+	entries []Entry
+}
+
+// Context is the repository state that conditional includes are evaluated
+// against.
+type Context struct {
+	// GitDir is the repository's .git directory, if any.
+	GitDir string
+	// Branch is the short name of the current branch, if any.
+	Branch string
+}
+
+// Load reads the system and global configuration files and, if ctx has a
+// GitDir, the repository's config file, following includes.
+func Load(ctx Context) (*Config, error) {
+	c := &Config{}
+	paths := map[Scope]string{ScopeSystem: SystemPath(), ScopeGlobal: GlobalPath()}
+	if ctx.GitDir != "" {
+		paths[ScopeLocal] = filepath.Join(ctx.GitDir, "config")
+	}
+	for _, scope := range []Scope{ScopeSystem, ScopeGlobal, ScopeLocal} {
+		if paths[scope] == "" {
+			continue
+		}
+		if err := c.load(paths[scope], scope, ctx, 0); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// load appends the entries of a file and the files it includes.
+func (c *Config) load(path string, scope Scope, ctx Context, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("%s: %w: include depth exceeded", path, ErrSyntax)
+	}
+	f, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for _, e := range f.Entries() {
+		e.Scope = scope
+		c.entries = append(c.entries, e)
+		include, ok := includePath(e, ctx)
+		if !ok {
+			continue
+		}
+		include = expandPath(include)
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		if !fileExists(include) {
+			continue
+		}
+		if err := c.load(include, scope, ctx, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// includePath returns the file an include.path or includeIf.<cond>.path
+// entry includes, and reports false if it is not an include or its
+// condition does not hold.
+func includePath(e Entry, ctx Context) (string, bool) {
+	if e.Key == "include.path" {
+		return e.Value, e.Value != ""
+	}
+	rest, ok := strings.CutPrefix(e.Key, "includeif.")
+	if !ok || !strings.HasSuffix(rest, ".path") || e.Value == "" {
+		return "", false
+	}
+	cond := strings.TrimSuffix(rest, ".path")
+	switch {
+	case strings.HasPrefix(cond, "gitdir:"):
+		return e.Value, matchGitDir(strings.TrimPrefix(cond, "gitdir:"), ctx.GitDir, false, e.Origin)
+	case strings.HasPrefix(cond, "gitdir/i:"):
+		return e.Value, matchGitDir(strings.TrimPrefix(cond, "gitdir/i:"), ctx.GitDir, true, e.Origin)
+	case strings.HasPrefix(cond, "onbranch:"):
+		pattern := strings.TrimPrefix(cond, "onbranch:")
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+		re, err := wildmatch.Compile(pattern, false)
+		return e.Value, err == nil && ctx.Branch != "" && re.MatchString(ctx.Branch)
+	}
+	return "", false
+}
+
+// matchGitDir evaluates a gitdir: condition. Relative patterns match at
+// any depth, ./ is relative to the including file, and a trailing slash
+// matches everything below.
+func matchGitDir(pattern, gitDir string, foldCase bool, origin string) bool {
+	if gitDir == "" {
+		return false
+	}
+	// Expanding ~/ and ./ cleans the path, which drops a trailing slash.
+	below := strings.HasSuffix(pattern, "/")
+	pattern = expandPath(pattern)
+	switch {
+	case strings.HasPrefix(pattern, "./"):
+		pattern = filepath.Join(filepath.Dir(origin), pattern[2:])
+	case !filepath.IsAbs(pattern):
+		pattern = "**/" + pattern
+	}
+	if below {
+		pattern = strings.TrimSuffix(pattern, "/") + "/**"
+	}
+	re, err := wildmatch.Compile(filepath.ToSlash(pattern), foldCase)
+	if err != nil {
+		return false
+	}
+	dir, err := filepath.Abs(gitDir)
+	if err != nil {
+		return false
+	}
+	// Like git, try the real path first and then the path as given, which
+	// matches a pattern naming a symbolic link on the way.
+	dirs := []string{dir}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil && resolved != dir {
+		dirs = []string{resolved, dir}
+	}
+	for _, dir := range dirs {
+		dir = filepath.ToSlash(dir)
+		if re.MatchString(dir) || re.MatchString(dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// expandPath replaces a leading ~/ with the home directory.
+func expandPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// Entries returns all entries in the order they were read.
+func (c *Config) Entries() []Entry {
+	return c.entries
+}
+
+// Get returns the last value of a key.
+func (c *Config) Get(key string) (string, bool) {
+	values := c.GetAll(key)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// GetAll returns all values of a key across all scopes.
+func (c *Config) GetAll(key string) []string {
+	canonical, err := CanonicalKey(key)
+	if err != nil {
+		return nil
+	}
+	var values []string
+	for _, e := range c.entries {
+		if e.Key == canonical {
+			values = append(values, e.Value)
+		}
+	}
+	return values
+}
+
+// GetRegexp returns the entries whose key matches a regular expression.
+func (c *Config) GetRegexp(re *regexp.Regexp) []Entry {
+	var entries []Entry
+	for _, e := range c.entries {
+		if re.MatchString(e.Key) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Bool returns the boolean value of a key, or def if it is not set.
+func (c *Config) Bool(key string, def bool) (bool, error) {
+	canonical, err := CanonicalKey(key)
+	if err != nil {
+		return false, err
+	}
+	for i := len(c.entries) - 1; i >= 0; i-- {
+		if e := c.entries[i]; e.Key == canonical {
+			if e.Implicit {
+				return true, nil
+			}
+			return ParseBool(e.Value)
+		}
+	}
+	return def, nil
+}
+
+// CanonicalKey returns the key with its section and variable name in lower
+// case.
+func CanonicalKey(key string) (string, error) {
+	section, subsection, name, err := SplitKey(key)
+	if err != nil {
+		return "", err
+	}
+	return makeKey(section, subsection, name), nil
+}
+
+// ParseBool parses a boolean value: true, yes, on and 1 or false, no, off,
+// 0 and the empty string, ignoring case. Other integers are true.
+func ParseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return n != 0, nil
+	}
+	return false, fmt.Errorf("bad boolean config value '%s'", s)
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile creates a file and its directories.
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// isolate points HOME at a new directory without any configuration and
+// disables the system file. It returns the home directory.
+func isolate(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("GIT_CONFIG_GLOBAL", "")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	return home
+}
+
+func TestLoadIncludes(t *testing.T) {
+	tests := []struct {
+		name string
+		// global is the content of ~/.gitconfig, which may include
+		// ~/included, setting test.value to "included".
+		global string
+		ctx    Context
+		want   string
+	}{
+		{"relative path", "[include]\n\tpath = included\n", Context{}, "included"},
+		{"home directory", "[include]\n\tpath = ~/included\n", Context{}, "included"},
+		{"missing file", "[test]\n\tvalue = global\n[include]\n\tpath = missing\n", Context{}, "global"},
+		{"later value overrides", "[include]\n\tpath = included\n[test]\n\tvalue = global\n", Context{}, "global"},
+		{"included value overrides", "[test]\n\tvalue = global\n[include]\n\tpath = included\n", Context{}, "included"},
+		{"nested include", "[include]\n\tpath = nested\n", Context{}, "included"},
+
+		{"gitdir absolute", "[includeIf \"gitdir:~/work/\"]\n\tpath = included\n", Context{GitDir: "work/repo/.git"}, "included"},
+		{"gitdir absolute mismatch", "[includeIf \"gitdir:~/other/\"]\n\tpath = included\n", Context{GitDir: "work/repo/.git"}, ""},
+		{"gitdir relative", "[includeIf \"gitdir:repo/.git\"]\n\tpath = included\n", Context{GitDir: "work/repo/.git"}, "included"},
+		{"gitdir relative to the file", "[includeIf \"gitdir:./work/\"]\n\tpath = included\n", Context{GitDir: "work/repo/.git"}, "included"},
+		{"gitdir glob", "[includeIf \"gitdir:~/*/repo/\"]\n\tpath = included\n", Context{GitDir: "work/repo/.git"}, "included"},
+		{"gitdir case", "[includeIf \"gitdir:~/WORK/\"]\n\tpath = included\n", Context{GitDir: "work/repo/.git"}, ""},
+		{"gitdir/i case", "[includeIf \"gitdir/i:~/WORK/\"]\n\tpath = included\n", Context{GitDir: "work/repo/.git"}, "included"},
+		{"gitdir outside a repository", "[includeIf \"gitdir:/\"]\n\tpath = included\n", Context{}, ""},
+
+		{"onbranch", "[includeIf \"onbranch:main\"]\n\tpath = included\n", Context{Branch: "main"}, "included"},
+		{"onbranch mismatch", "[includeIf \"onbranch:main\"]\n\tpath = included\n", Context{Branch: "topic"}, ""},
+		{"onbranch glob", "[includeIf \"onbranch:feature/*\"]\n\tpath = included\n", Context{Branch: "feature/x"}, "included"},
+		{"onbranch directory", "[includeIf \"onbranch:feature/\"]\n\tpath = included\n", Context{Branch: "feature/x/y"}, "included"},
+		{"onbranch detached", "[includeIf \"onbranch:*\"]\n\tpath = included\n", Context{}, ""},
+
+		{"unknown condition", "[includeIf \"hasconfig:remote.*.url:*\"]\n\tpath = included\n", Context{}, ""},
+		{"empty path", "[include]\n\tpath =\n", Context{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := isolate(t)
+			writeFile(t, filepath.Join(home, ".gitconfig"), tt.global)
+			writeFile(t, filepath.Join(home, "included"), "[test]\n\tvalue = included\n")
+			writeFile(t, filepath.Join(home, "nested"), "[include]\n\tpath = included\n")
+			ctx := tt.ctx
+			if ctx.GitDir != "" {
+				ctx.GitDir = filepath.Join(home, ctx.GitDir)
+				if err := os.MkdirAll(ctx.GitDir, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c, err := Load(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := c.Get("test.value"); got != tt.want {
+				t.Errorf("test.value = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadIncludeGitDirSymlink(t *testing.T) {
+	home := isolate(t)
+	gitDir := filepath.Join(home, "real", "repo", ".git")
+	if err := os.MkdirAll(gitDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(home, "real"), filepath.Join(home, "link")); err != nil {
+		t.Skip(err)
+	}
+	writeFile(t, filepath.Join(home, "included"), "[test]\n\tvalue = included\n")
+	for _, tt := range []struct {
+		pattern, gitDir string
+	}{
+		{"~/real/", filepath.Join(home, "link", "repo", ".git")},
+		{"~/link/", filepath.Join(home, "link", "repo", ".git")},
+		{"~/real/", gitDir},
+	} {
+		writeFile(t, filepath.Join(home, ".gitconfig"), "[includeIf \"gitdir:"+tt.pattern+"\"]\n\tpath = included\n")
+		c, err := Load(Context{GitDir: tt.gitDir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := c.Get("test.value"); got != "included" {
+			t.Errorf("gitdir:%s for %s: test.value = %q, want included", tt.pattern, tt.gitDir, got)
+		}
+	}
+}
+
+func TestLoadIncludeScope(t *testing.T) {
+	home := isolate(t)
+	gitDir := filepath.Join(home, "repo", ".git")
+	writeFile(t, filepath.Join(gitDir, "config"), "[include]\n\tpath = ../local\n")
+	writeFile(t, filepath.Join(home, "repo", "local"), "[test]\n\tvalue = local\n")
+	c, err := Load(Context{GitDir: gitDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := c.Entries()
+	last := entries[len(entries)-1]
+	if last.Key != "test.value" || last.Value != "local" || last.Scope != ScopeLocal {
+		t.Errorf("last entry = %+v, want test.value=local in the local scope", last)
+	}
+	if want := filepath.Join(home, "repo", "local"); last.Origin != want {
+		t.Errorf("included entry comes from %q, want %q", last.Origin, want)
+	}
+}
+
+func TestLoadIncludeLoop(t *testing.T) {
+	home := isolate(t)
+	writeFile(t, filepath.Join(home, ".gitconfig"), "[include]\n\tpath = other\n")
+	writeFile(t, filepath.Join(home, "other"), "[include]\n\tpath = .gitconfig\n")
+	if _, err := Load(Context{}); !errors.Is(err, ErrSyntax) {
+		t.Errorf("Load with an include loop = %v, want ErrSyntax", err)
+	}
+}
@@ -0,0 +1,439 @@
+// Package config reads and writes git configuration files.
+//
+// A File is a single configuration file that can be modified while keeping
+// its comments and layout. A Config merges the system, global and
+// repository files, following include and includeIf directives.
+//
+// Keys have the form section.name or section.subsection.name. Section and
+// variable names are case-insensitive; subsection names are not.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/lockfile"
+)
+
+var (
+	// ErrSyntax is returned for a malformed configuration file.
+	ErrSyntax = errors.New("bad config syntax")
+	// ErrInvalidKey is returned for a key without a section or with
+	// invalid characters.
+	ErrInvalidKey = errors.New("invalid config key")
+	// ErrNotSet is returned when unsetting a key that is not set.
+	ErrNotSet = errors.New("config key not set")
+	// ErrMultipleValues is returned when replacing or removing a single
+	// value of a key that has several.
+	ErrMultipleValues = errors.New("config key has multiple values")
+)
+
+type itemKind int
+
+const (
+	itemOther itemKind = iota
+	itemSection
+	itemEntry
+)
+
+// item is a section header, an entry, or a blank or comment line. Items
+// keep their original text so that unchanged parts of a file are written
+// back verbatim.
+type item struct {
+	kind itemKind
+	text string
+	// sameLine items follow the previous item without a line break, as an
+	// entry written on the line of its section header.
+	sameLine bool
+	// section is lower case; subsection keeps its case.
+	section, subsection string
+	// name is the lower case variable name of an entry.
+	name  string
+	value string
+	// implicit entries have no "=" and are boolean true.
+	implicit bool
+}
+
+func (it *item) key() string {
+	return makeKey(it.section, it.subsection, it.name)
+}
+
+func makeKey(section, subsection, name string) string {
+	if subsection == "" {
+		return section + "." + name
+	}
+	return section + "." + subsection + "." + name
+}
+
+// File is a configuration file.
+type File struct {
+	// Path is the file's location, or empty for a file that was not read
+	// from disk.
+	Path  string
+	items []*item
+}
+
+// ReadFile reads and parses the file at path. A missing file is empty.
+func ReadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	f, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	f.Path = path
+	return f, nil
+}
+
+// Write replaces the file at f.Path through a lock file.
+func (f *File) Write() error {
+	lock, err := lockfile.Create(f.Path)
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+	if _, err := lock.Write(f.Encode()); err != nil {
+		return err
+	}
+	return lock.Commit()
+}
+
+// Encode returns the content of the file.
+func (f *File) Encode() []byte {
+	var sb strings.Builder
+	for i, it := range f.items {
+		if i > 0 && !it.sameLine {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(it.text)
+	}
+	if len(f.items) > 0 {
+		sb.WriteByte('\n')
+	}
+	return []byte(sb.String())
+}
+
+// Entry is a configuration variable.
+type Entry struct {
+	// Key is the canonical key: section and name in lower case.
+	Key   string
+	Value string
+	// Implicit is set for a variable without "=", which is a boolean true
+	// and has an empty Value.
+	Implicit bool
+	// Scope and Origin tell where the entry was read from.
+	Scope  Scope
+	Origin string
+}
+
+// Entries returns the variables of the file in order, without following
+// includes.
+func (f *File) Entries() []Entry {
+	entries := make([]Entry, 0)
+	for _, it := range f.items {
+		if it.kind == itemEntry {
+			entries = append(entries, Entry{Key: it.key(), Value: it.value, Implicit: it.implicit, Origin: f.Path})
+		}
+	}
+	return entries
+}
+
+// Get returns the last value of a key.
+func (f *File) Get(key string) (string, bool) {
+	values := f.GetAll(key)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// GetAll returns all values of a key in order.
+func (f *File) GetAll(key string) []string {
+	section, subsection, name, err := SplitKey(key)
+	if err != nil {
+		return nil
+	}
+	canonical := makeKey(section, subsection, name)
+	var values []string
+	for _, it := range f.items {
+		if it.kind == itemEntry && it.key() == canonical {
+			values = append(values, it.value)
+		}
+	}
+	return values
+}
+
+// Set sets a key to a single value, replacing its current value in place
+// or adding it to the end of its section. It fails with ErrMultipleValues
+// if the key has more than one value.
+func (f *File) Set(key, value string) error {
+	section, subsection, name, err := SplitKey(key)
+	if err != nil {
+		return err
+	}
+	matches := f.find(makeKey(section, subsection, name))
+	switch len(matches) {
+	case 0:
+		f.add(section, subsection, name, value)
+	case 1:
+		f.replace(matches[0], name, value)
+	default:
+		return fmt.Errorf("%w: %s", ErrMultipleValues, key)
+	}
+	return nil
+}
+
+// Add adds a value to a key, keeping its current values.
+func (f *File) Add(key, value string) error {
+	section, subsection, name, err := SplitKey(key)
+	if err != nil {
+		return err
+	}
+	f.add(section, subsection, name, value)
+	return nil
+}
+
+// ReplaceAll replaces all values of a key by a single value.
+func (f *File) ReplaceAll(key, value string) error {
+	section, subsection, name, err := SplitKey(key)
+	if err != nil {
+		return err
+	}
+	matches := f.find(makeKey(section, subsection, name))
+	if len(matches) == 0 {
+		f.add(section, subsection, name, value)
+		return nil
+	}
+	f.replace(matches[len(matches)-1], name, value)
+	f.remove(matches[:len(matches)-1])
+	return nil
+}
+
+// Unset removes a key. It fails with ErrNotSet if the key is not set and
+// with ErrMultipleValues if it has more than one value.
+func (f *File) Unset(key string) error {
+	matches, err := f.findKey(key)
+	if err != nil {
+		return err
+	}
+	if len(matches) > 1 {
+		return fmt.Errorf("%w: %s", ErrMultipleValues, key)
+	}
+	f.remove(matches)
+	return nil
+}
+
+// UnsetAll removes all values of a key. It fails with ErrNotSet if the key
+// is not set.
+func (f *File) UnsetAll(key string) error {
+	matches, err := f.findKey(key)
+	if err != nil {
+		return err
+	}
+	f.remove(matches)
+	return nil
+}
+
+// RemoveSection removes a section with all its entries. name is the section
+// name, optionally followed by a dot and the subsection name.
+func (f *File) RemoveSection(name string) error {
+	section, subsection, _ := strings.Cut(name, ".")
+	section = strings.ToLower(section)
+	kept := f.items[:0]
+	found := false
+	for _, it := range f.items {
+		if it.kind != itemOther && it.section == section && it.subsection == subsection {
+			found = true
+			continue
+		}
+		kept = append(kept, it)
+	}
+	f.items = kept
+	if !found {
+		return fmt.Errorf("%w: no such section %s", ErrNotSet, name)
+	}
+	return nil
+}
+
+// RenameSection renames a section, keeping its entries. The names are
+// section names, optionally followed by a dot and the subsection name.
+func (f *File) RenameSection(oldName, newName string) error {
+	section, subsection, _ := strings.Cut(oldName, ".")
+	section = strings.ToLower(section)
+	newSection, newSubsection, _ := strings.Cut(newName, ".")
+	newSection = strings.ToLower(newSection)
+	if !validName(newSection, true) {
+		return fmt.Errorf("%w: %s", ErrInvalidKey, newName)
+	}
+	found := false
+	for i, it := range f.items {
+		if it.kind == itemOther || it.section != section || it.subsection != subsection {
+			continue
+		}
+		found = true
+		renamed := *it
+		renamed.section, renamed.subsection = newSection, newSubsection
+		if it.kind == itemSection {
+			renamed.text = sectionHeader(newSection, newSubsection)
+		}
+		f.items[i] = &renamed
+	}
+	if !found {
+		return fmt.Errorf("%w: no such section %s", ErrNotSet, oldName)
+	}
+	return nil
+}
+
+func (f *File) findKey(key string) ([]int, error) {
+	section, subsection, name, err := SplitKey(key)
+	if err != nil {
+		return nil, err
+	}
+	matches := f.find(makeKey(section, subsection, name))
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotSet, key)
+	}
+	return matches, nil
+}
+
+// find returns the positions of the entries for a canonical key.
+func (f *File) find(key string) []int {
+	var matches []int
+	for i, it := range f.items {
+		if it.kind == itemEntry && it.key() == key {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// replace rewrites the entry at position i with a new value.
+func (f *File) replace(i int, name, value string) {
+	it := *f.items[i]
+	it.text = "\t" + name + " = " + quote(value)
+	it.sameLine = false
+	it.value, it.implicit = value, false
+	f.items[i] = &it
+}
+
+// remove deletes the items at the given positions, which are in order.
+func (f *File) remove(positions []int) {
+	for n := len(positions) - 1; n >= 0; n-- {
+		i := positions[n]
+		next := i + 1
+		// An entry on its header's line leaves the header in place.
+		if next < len(f.items) && f.items[next].sameLine && i > 0 {
+			f.items[next].sameLine = f.items[i].sameLine
+		}
+		f.items = append(f.items[:i], f.items[i+1:]...)
+	}
+}
+
+// add appends an entry to the last matching section, creating the section
+// at the end of the file if there is none.
+func (f *File) add(section, subsection, name, value string) {
+	entry := &item{
+		kind:       itemEntry,
+		text:       "\t" + name + " = " + quote(value),
+		section:    section,
+		subsection: subsection,
+		name:       name,
+		value:      value,
+	}
+	last := -1
+	for i, it := range f.items {
+		if it.kind != itemOther && it.section == section && it.subsection == subsection {
+			last = i
+		}
+	}
+	if last < 0 {
+		header := &item{kind: itemSection, text: sectionHeader(section, subsection), section: section, subsection: subsection}
+		f.items = append(f.items, header, entry)
+		return
+	}
+	f.items = append(f.items, nil)
+	copy(f.items[last+2:], f.items[last+1:])
+	f.items[last+1] = entry
+}
+
+// sectionHeader returns the header line of a section.
+func sectionHeader(section, subsection string) string {
+	if subsection == "" {
+		return "[" + section + "]"
+	}
+	return "[" + section + " \"" + escapeSubsection(subsection) + "\"]"
+}
+
+// SplitKey splits a key into its lower case section, subsection and lower
+// case variable name.
+func SplitKey(key string) (section, subsection, name string, err error) {
+	first := strings.IndexByte(key, '.')
+	last := strings.LastIndexByte(key, '.')
+	if first <= 0 || last == len(key)-1 {
+		return "", "", "", fmt.Errorf("%w: %s", ErrInvalidKey, key)
+	}
+	section, name = strings.ToLower(key[:first]), strings.ToLower(key[last+1:])
+	if first < last {
+		subsection = key[first+1 : last]
+	}
+	if !validName(section, true) || !validName(name, false) {
+		return "", "", "", fmt.Errorf("%w: %s", ErrInvalidKey, key)
+	}
+	return section, subsection, name, nil
+}
+
+// validName reports whether s is a valid section or variable name:
+// alphanumeric characters and dashes, and for sections also dots, with
+// variable names starting with a letter.
+func validName(s string, section bool) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' || c == '-':
+			if i == 0 && !section {
+				return false
+			}
+		case c == '.' && section:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// quote formats a value so that it reads back unchanged.
+func quote(value string) string {
+	needsQuotes := value != strings.TrimSpace(value) || strings.ContainsAny(value, "#;")
+	var sb strings.Builder
+	for _, c := range value {
+		switch c {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '"':
+			sb.WriteString(`\"`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\b':
+			sb.WriteString(`\b`)
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	if needsQuotes {
+		return "\"" + sb.String() + "\""
+	}
+	return sb.String()
+}
+
+func escapeSubsection(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
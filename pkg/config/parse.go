@@ -0,0 +1,252 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parser decodes a configuration file one line at a time.
+type parser struct {
+	data string
+	pos  int
+	line int
+	// section and subsection are the current section.
+	section, subsection string
+	items               []*item
+}
+
+// Parse decodes the content of a configuration file.
+func Parse(data []byte) (*File, error) {
+	p := &parser{data: strings.TrimPrefix(string(data), "\ufeff"), line: 1}
+	for p.pos < len(p.data) {
+		if err := p.parseLine(); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrSyntax, p.line, err)
+		}
+	}
+	return &File{items: p.items}, nil
+}
+
+// parseLine parses the line starting at p.pos and the lines it continues
+// onto.
+func (p *parser) parseLine() error {
+	start := p.pos
+	p.skipSpace()
+	switch {
+	case p.pos >= len(p.data) || p.data[p.pos] == '\n' || p.data[p.pos] == '#' || p.data[p.pos] == ';':
+		p.skipToEOL()
+		p.items = append(p.items, &item{kind: itemOther, text: p.text(start)})
+		return p.endLine()
+	case p.data[p.pos] == '[':
+		if err := p.parseSection(start); err != nil {
+			return err
+		}
+		// An entry may follow on the same line.
+		rest := p.pos
+		p.skipSpace()
+		if p.atEOL() {
+			p.skipToEOL()
+			p.items[len(p.items)-1].text = p.text(start)
+			return p.endLine()
+		}
+		if err := p.parseEntry(rest); err != nil {
+			return err
+		}
+		p.items[len(p.items)-1].sameLine = true
+		return p.endLine()
+	}
+	if err := p.parseEntry(start); err != nil {
+		return err
+	}
+	return p.endLine()
+}
+
+// parseSection parses a [section] or [section "subsection"] header.
+func (p *parser) parseSection(start int) error {
+	p.pos++
+	nameStart := p.pos
+	for p.pos < len(p.data) && p.data[p.pos] != ']' && p.data[p.pos] != ' ' && p.data[p.pos] != '\t' && p.data[p.pos] != '\n' {
+		p.pos++
+	}
+	name := p.data[nameStart:p.pos]
+	if !validName(name, true) {
+		return fmt.Errorf("invalid section name %q", name)
+	}
+	section, subsection := strings.ToLower(name), ""
+	if dot := strings.IndexByte(section, '.'); dot >= 0 {
+		// The deprecated [section.subsection] syntax is case-insensitive.
+		section, subsection = section[:dot], section[dot+1:]
+	}
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == '"' {
+		p.pos++
+		var sb strings.Builder
+		for {
+			if p.pos >= len(p.data) || p.data[p.pos] == '\n' {
+				return fmt.Errorf("unterminated subsection name")
+			}
+			c := p.data[p.pos]
+			p.pos++
+			if c == '"' {
+				break
+			}
+			if c == '\\' && p.pos < len(p.data) && p.data[p.pos] != '\n' {
+				c = p.data[p.pos]
+				p.pos++
+			}
+			sb.WriteByte(c)
+		}
+		subsection = sb.String()
+	}
+	if p.pos >= len(p.data) || p.data[p.pos] != ']' {
+		return fmt.Errorf("missing ] in section header")
+	}
+	p.pos++
+	p.section, p.subsection = section, subsection
+	p.items = append(p.items, &item{kind: itemSection, text: p.text(start), section: section, subsection: subsection})
+	return nil
+}
+
+// parseEntry parses a "name = value" or "name" entry.
+func (p *parser) parseEntry(start int) error {
+	if p.section == "" {
+		return fmt.Errorf("entry outside of a section")
+	}
+	p.skipSpace()
+	nameStart := p.pos
+	for p.pos < len(p.data) && isNameChar(p.data[p.pos]) {
+		p.pos++
+	}
+	name := p.data[nameStart:p.pos]
+	if !validName(name, false) {
+		return fmt.Errorf("invalid variable name %q", name)
+	}
+	it := &item{kind: itemEntry, section: p.section, subsection: p.subsection, name: strings.ToLower(name)}
+	p.skipSpace()
+	switch {
+	case p.atEOL():
+		it.implicit = true
+		p.skipToEOL()
+	case p.data[p.pos] == '=':
+		p.pos++
+		value, err := p.parseValue()
+		if err != nil {
+			return err
+		}
+		it.value = value
+	default:
+		return fmt.Errorf("expected = after %s", name)
+	}
+	it.text = p.text(start)
+	p.items = append(p.items, it)
+	return nil
+}
+
+// parseValue parses a value up to the end of the line or a comment.
+// Whitespace is trimmed and collapsed to the original spacing only between
+// words, except inside quotes.
+func (p *parser) parseValue() (string, error) {
+	var sb strings.Builder
+	quoted := false
+	space := 0
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == '\n' {
+			break
+		}
+		p.pos++
+		if !quoted && (c == ' ' || c == '\t') {
+			if sb.Len() > 0 {
+				space++
+			}
+			continue
+		}
+		if !quoted && (c == '#' || c == ';') {
+			p.skipToEOL()
+			break
+		}
+		for ; space > 0; space-- {
+			sb.WriteByte(' ')
+		}
+		switch c {
+		case '"':
+			quoted = !quoted
+		case '\\':
+			if p.pos >= len(p.data) {
+				return "", fmt.Errorf("backslash at end of file")
+			}
+			next := p.data[p.pos]
+			p.pos++
+			switch next {
+			case '\n':
+				p.line++
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'b':
+				sb.WriteByte('\b')
+			case '\\', '"':
+				sb.WriteByte(next)
+			case '\r':
+				if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+					p.pos++
+					p.line++
+					continue
+				}
+				fallthrough
+			default:
+				return "", fmt.Errorf("invalid escape \\%c", next)
+			}
+		case '\r':
+			if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+				continue
+			}
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	if quoted {
+		return "", fmt.Errorf("unterminated quoted value")
+	}
+	return sb.String(), nil
+}
+
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-'
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.data) && (p.data[p.pos] == ' ' || p.data[p.pos] == '\t' || p.data[p.pos] == '\r') {
+		p.pos++
+	}
+}
+
+func (p *parser) atEOL() bool {
+	return p.pos >= len(p.data) || p.data[p.pos] == '\n' || p.data[p.pos] == '#' || p.data[p.pos] == ';'
+}
+
+func (p *parser) skipToEOL() {
+	for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+		p.pos++
+	}
+}
+
+// text returns the source text from start to the current position.
+func (p *parser) text(start int) string {
+	return strings.TrimSuffix(p.data[start:p.pos], "\r")
+}
+
+// endLine consumes the line break after an item.
+func (p *parser) endLine() error {
+	p.skipSpace()
+	if !p.atEOL() {
+		return fmt.Errorf("unexpected %q", p.data[p.pos])
+	}
+	p.skipToEOL()
+	if p.pos < len(p.data) {
+		p.pos++
+		p.line++
+	}
+	return nil
+}
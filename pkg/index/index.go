@@ -0,0 +1,381 @@
+// Package index reads and writes the git index (the staging area), stored
+// in .git/index in the DIRC format, versions 2, 3 and 4.
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/internal/lockfile"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// ErrCorrupt is returned when an index file cannot be decoded.
+var ErrCorrupt = errors.New("corrupt index")
+
+const signature = "DIRC"
+
+// Flag bits of an entry.
+const (
+	flagAssumeValid  = 0x8000
+	flagExtended     = 0x4000
+	flagStageMask    = 0x3000
+	flagStageShift   = 12
+	flagNameMask     = 0x0fff
+	flagSkipWorktree = 0x4000
+	flagIntentToAdd  = 0x2000
+)
+
+// Entry is a staged file. The stat fields cache the working tree file's
+// metadata at the time it was staged, so that unchanged files need not be
+// rehashed.
+type Entry struct {
+	CTime time.Time
+	MTime time.Time
+	Dev   uint32
+	Ino   uint32
+	Mode  uint32
+	UID   uint32
+	GID   uint32
+	Size  uint32
+	ID    odb.ID
+	// Stage is 0 for normal entries and 1-3 for the base, ours and
+	// theirs sides of a conflict.
+	Stage        int
+	AssumeValid  bool
+	SkipWorktree bool
+	IntentToAdd  bool
+	Path         string
+}
+
+// Index is the content of an index file. Entries are kept sorted by path
+// and stage.
+type Index struct {
+	Version uint32
+	Entries []*Entry
+	// ModTime is the modification time of the file the index was read
+	// from. Entries whose files were modified at or after it are racily
+	// clean: their stat data cannot prove them unchanged.
+	ModTime time.Time
+}
+
+// New returns an empty version 2 index.
+func New() *Index {
+	return &Index{Version: 2}
+}
+
+// Read reads the index file at path. A missing file is an empty index.
+func Read(path string, algo *odb.Algorithm) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return New(), nil
+	} else if err != nil {
+		return nil, err
+	}
+	idx, err := Parse(data, algo)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if info, err := os.Stat(path); err == nil {
+		idx.ModTime = info.ModTime()
+	}
+	return idx, nil
+}
+
+// Write writes the index to path through a lock file.
+func (idx *Index) Write(path string, algo *odb.Algorithm) error {
+	lock, err := lockfile.Create(path)
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+	if _, err := lock.Write(idx.Encode(algo)); err != nil {
+		return err
+	}
+	return lock.Commit()
+}
+
+func less(a, b *Entry) bool {
+	if a.Path != b.Path {
+		return a.Path < b.Path
+	}
+	return a.Stage < b.Stage
+}
+
+// Sort restores index order after entries were modified directly.
+func (idx *Index) Sort() {
+	sort.SliceStable(idx.Entries, func(i, j int) bool {
+		return less(idx.Entries[i], idx.Entries[j])
+	})
+}
+
+// search returns the position of the first entry not before (path, stage).
+func (idx *Index) search(path string, stage int) int {
+	key := &Entry{Path: path, Stage: stage}
+	return sort.Search(len(idx.Entries), func(i int) bool {
+		return !less(idx.Entries[i], key)
+	})
+}
+
+// Entry returns the stage 0 entry for path, or nil.
+func (idx *Index) Entry(path string) *Entry {
+	i := idx.search(path, 0)
+	if i < len(idx.Entries) && idx.Entries[i].Path == path && idx.Entries[i].Stage == 0 {
+		return idx.Entries[i]
+	}
+	return nil
+}
+
+// Add inserts or replaces an entry. Adding a stage 0 entry resolves any
+// conflict entries for the same path.
+func (idx *Index) Add(e *Entry) {
+	if e.Stage == 0 {
+		idx.Remove(e.Path)
+	}
+	i := idx.search(e.Path, e.Stage)
+	if i < len(idx.Entries) && idx.Entries[i].Path == e.Path && idx.Entries[i].Stage == e.Stage {
+		idx.Entries[i] = e
+		return
+	}
+	idx.Entries = append(idx.Entries, nil)
+	copy(idx.Entries[i+1:], idx.Entries[i:])
+	idx.Entries[i] = e
+}
+
+// Remove deletes all entries for path and reports whether there were any.
+func (idx *Index) Remove(path string) bool {
+	i := idx.search(path, 0)
+	j := i
+	for j < len(idx.Entries) && idx.Entries[j].Path == path {
+		j++
+	}
+	idx.Entries = append(idx.Entries[:i], idx.Entries[j:]...)
+	return j > i
+}
+
+// RemoveDir deletes all entries below the directory dir and returns the
+// removed entries.
+func (idx *Index) RemoveDir(dir string) []*Entry {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	kept := idx.Entries[:0]
+	var removed []*Entry
+	for _, e := range idx.Entries {
+		if strings.HasPrefix(e.Path, prefix) {
+			removed = append(removed, e)
+		} else {
+			kept = append(kept, e)
+		}
+	}
+	idx.Entries = kept
+	return removed
+}
+
+// Unmerged reports whether the index has conflict entries.
+func (idx *Index) Unmerged() bool {
+	for _, e := range idx.Entries {
+		if e.Stage != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse decodes the content of an index file.
+func Parse(data []byte, algo *odb.Algorithm) (*Index, error) {
+	size := algo.Size()
+	if len(data) < 12+size || string(data[:4]) != signature {
+		return nil, fmt.Errorf("%w: bad signature", ErrCorrupt)
+	}
+	h := algo.New()
+	h.Write(data[:len(data)-size])
+	if !bytes.Equal(h.Sum(nil), data[len(data)-size:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+	}
+	idx := &Index{Version: binary.BigEndian.Uint32(data[4:])}
+	if idx.Version < 2 || idx.Version > 4 {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrCorrupt, idx.Version)
+	}
+	count := int(binary.BigEndian.Uint32(data[8:]))
+	body := data[12 : len(data)-size]
+	pos := 0
+	previous := ""
+	fixed := 40 + size + 2
+	for i := 0; i < count; i++ {
+		if pos+fixed > len(body) {
+			return nil, fmt.Errorf("%w: truncated entry", ErrCorrupt)
+		}
+		start := pos
+		b := body[pos:]
+		u32 := func(off int) uint32 { return binary.BigEndian.Uint32(b[off:]) }
+		e := &Entry{
+			CTime: time.Unix(int64(u32(0)), int64(u32(4))),
+			MTime: time.Unix(int64(u32(8)), int64(u32(12))),
+			Dev:   u32(16),
+			Ino:   u32(20),
+			Mode:  u32(24),
+			UID:   u32(28),
+			GID:   u32(32),
+			Size:  u32(36),
+			ID:    odb.NewID(b[40 : 40+size]),
+		}
+		flags := binary.BigEndian.Uint16(b[40+size:])
+		pos += fixed
+		e.AssumeValid = flags&flagAssumeValid != 0
+		e.Stage = int(flags&flagStageMask) >> flagStageShift
+		if flags&flagExtended != 0 {
+			if idx.Version < 3 {
+				return nil, fmt.Errorf("%w: extended flags in version 2", ErrCorrupt)
+			}
+			if pos+2 > len(body) {
+				return nil, fmt.Errorf("%w: truncated entry", ErrCorrupt)
+			}
+			extended := binary.BigEndian.Uint16(body[pos:])
+			pos += 2
+			e.SkipWorktree = extended&flagSkipWorktree != 0
+			e.IntentToAdd = extended&flagIntentToAdd != 0
+		}
+		if idx.Version == 4 {
+			strip, n := readVarint(body[pos:])
+			if n == 0 || strip > uint64(len(previous)) {
+				return nil, fmt.Errorf("%w: bad path compression", ErrCorrupt)
+			}
+			pos += n
+			end := bytes.IndexByte(body[pos:], 0)
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated path", ErrCorrupt)
+			}
+			e.Path = previous[:len(previous)-int(strip)] + string(body[pos:pos+end])
+			pos += end + 1
+		} else {
+			end := bytes.IndexByte(body[pos:], 0)
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated path", ErrCorrupt)
+			}
+			e.Path = string(body[pos : pos+end])
+			// Entries are NUL-padded to a multiple of eight bytes.
+			pos = start + (pos-start+end+8)&^7
+		}
+		previous = e.Path
+		idx.Entries = append(idx.Entries, e)
+	}
+	// Extensions follow the entries. Optional ones, whose signature starts
+	// with an upper-case letter, are dropped; they are caches that would
+	// be invalidated by any change anyway.
+	for pos+8 <= len(body) {
+		sig := body[pos : pos+4]
+		n := int(binary.BigEndian.Uint32(body[pos+4:]))
+		if sig[0] < 'A' || sig[0] > 'Z' {
+			return nil, fmt.Errorf("%w: unsupported extension %q", ErrCorrupt, sig)
+		}
+		pos += 8 + n
+	}
+	if pos != len(body) {
+		return nil, fmt.Errorf("%w: trailing data", ErrCorrupt)
+	}
+	return idx, nil
+}
+
+// Encode returns the content of the index file. Version 2 is upgraded to
+// version 3 if an entry needs extended flags.
+func (idx *Index) Encode(algo *odb.Algorithm) []byte {
+	version := idx.Version
+	if version < 2 {
+		version = 2
+	}
+	for _, e := range idx.Entries {
+		if version == 2 && (e.SkipWorktree || e.IntentToAdd) {
+			version = 3
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString(signature)
+	binary.Write(&buf, binary.BigEndian, version)
+	binary.Write(&buf, binary.BigEndian, uint32(len(idx.Entries)))
+	previous := ""
+	for _, e := range idx.Entries {
+		start := buf.Len()
+		for _, v := range []uint32{
+			uint32(e.CTime.Unix()), uint32(e.CTime.Nanosecond()),
+			uint32(e.MTime.Unix()), uint32(e.MTime.Nanosecond()),
+			e.Dev, e.Ino, e.Mode, e.UID, e.GID, e.Size,
+		} {
+			binary.Write(&buf, binary.BigEndian, v)
+		}
+		buf.Write(e.ID.Bytes())
+		flags := uint16(min(len(e.Path), flagNameMask))
+		flags |= uint16(e.Stage<<flagStageShift) & flagStageMask
+		if e.AssumeValid {
+			flags |= flagAssumeValid
+		}
+		extended := e.SkipWorktree || e.IntentToAdd
+		if extended {
+			flags |= flagExtended
+		}
+		binary.Write(&buf, binary.BigEndian, flags)
+		if extended {
+			var ext uint16
+			if e.SkipWorktree {
+				ext |= flagSkipWorktree
+			}
+			if e.IntentToAdd {
+				ext |= flagIntentToAdd
+			}
+			binary.Write(&buf, binary.BigEndian, ext)
+		}
+		if version == 4 {
+			common := 0
+			for common < len(previous) && common < len(e.Path) && previous[common] == e.Path[common] {
+				common++
+			}
+			buf.Write(appendVarint(nil, uint64(len(previous)-common)))
+			buf.WriteString(e.Path[common:])
+			buf.WriteByte(0)
+		} else {
+			buf.WriteString(e.Path)
+			n := buf.Len() - start
+			buf.Write(make([]byte, (n+8)&^7-n))
+		}
+		previous = e.Path
+	}
+	h := algo.New()
+	h.Write(buf.Bytes())
+	buf.Write(h.Sum(nil))
+	return buf.Bytes()
+}
+
+// readVarint decodes the variable-length integer used for path prefix
+// compression in version 4, returning the value and the number of bytes
+// consumed, or 0 bytes if the encoding is truncated.
+func readVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	v := uint64(b[0] & 0x7f)
+	n := 1
+	for b[n-1]&0x80 != 0 {
+		if n >= len(b) || n > 9 {
+			return 0, 0
+		}
+		v = (v+1)<<7 | uint64(b[n]&0x7f)
+		n++
+	}
+	return v, n
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	var tmp [10]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(v & 0x7f)
+	for v >>= 7; v != 0; v >>= 7 {
+		v--
+		i--
+		tmp[i] = 0x80 | byte(v&0x7f)
+	}
+	return append(b, tmp[i:]...)
+}
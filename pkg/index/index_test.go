@@ -0,0 +1,167 @@
+package index
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// testEntries returns entries in index order that exercise the stat
+// fields, conflict stages, flags, shared path prefixes for version 4 and a
+// path too long for the name length bits.
+func testEntries(algo *odb.Algorithm, extended bool) []*Entry {
+	long := strings.Repeat("d/", 2100) + "file"
+	entries := []*Entry{
+		{Path: "README", Mode: 0100644, Size: 12},
+		{Path: "conflict", Mode: 0100644, Stage: 1},
+		{Path: "conflict", Mode: 0100644, Stage: 2},
+		{Path: "conflict", Mode: 0100755, Stage: 3},
+		{Path: long, Mode: 0100644},
+		{Path: "dir/sub/a", Mode: 0100644, AssumeValid: true},
+		{Path: "dir/sub/b", Mode: 0120000},
+		{Path: "dir/subdir/c", Mode: 0160000},
+		{Path: "dir2", Mode: 0100644},
+	}
+	for i, e := range entries {
+		e.CTime = time.Unix(1112904793+int64(i), int64(i*1000))
+		e.MTime = time.Unix(1112911993+int64(i), 999999999)
+		e.Dev, e.Ino, e.UID, e.GID = 2049, uint32(1000+i), 1000, 100
+		e.ID = algo.Sum(odb.Blob, []byte(e.Path))
+	}
+	if extended {
+		entries[5].SkipWorktree = true
+		entries[6].IntentToAdd = true
+	}
+	return entries
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		version  uint32
+		extended bool
+		// want is the version written.
+		want uint32
+	}{
+		{2, false, 2},
+		{2, true, 3},
+		{3, false, 3},
+		{3, true, 3},
+		{4, false, 4},
+		{4, true, 4},
+	}
+	for _, algo := range []*odb.Algorithm{odb.SHA1, odb.SHA256} {
+		for _, tt := range tests {
+			idx := &Index{Version: tt.version, Entries: testEntries(algo, tt.extended)}
+			data := idx.Encode(algo)
+			got, err := Parse(data, algo)
+			if err != nil {
+				t.Errorf("%s v%d extended=%t: Parse: %v", algo.Name(), tt.version, tt.extended, err)
+				continue
+			}
+			if got.Version != tt.want {
+				t.Errorf("%s v%d extended=%t: version %d, want %d", algo.Name(), tt.version, tt.extended, got.Version, tt.want)
+			}
+			if !reflect.DeepEqual(got.Entries, idx.Entries) {
+				for i := range idx.Entries {
+					if i < len(got.Entries) && !reflect.DeepEqual(got.Entries[i], idx.Entries[i]) {
+						t.Errorf("%s v%d extended=%t: entry %d = %+v, want %+v", algo.Name(), tt.version, tt.extended, i, got.Entries[i], idx.Entries[i])
+						break
+					}
+				}
+				t.Errorf("%s v%d extended=%t: read %d entries back, want %d", algo.Name(), tt.version, tt.extended, len(got.Entries), len(idx.Entries))
+			}
+			if again := got.Encode(algo); string(again) != string(data) {
+				t.Errorf("%s v%d extended=%t: encoding is not stable", algo.Name(), tt.version, tt.extended)
+			}
+		}
+	}
+}
+
+func TestVersion4CompressesPaths(t *testing.T) {
+	v2 := &Index{Version: 2, Entries: testEntries(odb.SHA1, false)}
+	v4 := &Index{Version: 4, Entries: v2.Entries}
+	if n2, n4 := len(v2.Encode(odb.SHA1)), len(v4.Encode(odb.SHA1)); n4 >= n2 {
+		t.Errorf("version 4 index is %d bytes, version 2 %d", n4, n2)
+	}
+}
+
+func TestVarint(t *testing.T) {
+	// The encodings are those of git's encode_varint.
+	tests := []struct {
+		v    uint64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x00}},
+		{255, []byte{0x80, 0x7f}},
+		{16511, []byte{0xff, 0x7f}},
+		{16512, []byte{0x80, 0x80, 0x00}},
+	}
+	for _, tt := range tests {
+		got := appendVarint(nil, tt.v)
+		if string(got) != string(tt.want) {
+			t.Errorf("appendVarint(%d) = %x, want %x", tt.v, got, tt.want)
+		}
+		if v, n := readVarint(append(got, 0xaa)); v != tt.v || n != len(tt.want) {
+			t.Errorf("readVarint(%x) = %d, %d, want %d, %d", got, v, n, tt.v, len(tt.want))
+		}
+	}
+	if _, n := readVarint([]byte{0x80}); n != 0 {
+		t.Errorf("readVarint of a truncated varint consumed %d bytes", n)
+	}
+}
+
+func TestParseCorrupt(t *testing.T) {
+	valid := (&Index{Version: 4, Entries: testEntries(odb.SHA1, true)}).Encode(odb.SHA1)
+	// rehash replaces the checksum after the content was changed.
+	rehash := func(data []byte) []byte {
+		body := data[:len(data)-odb.SHA1.Size()]
+		h := odb.SHA1.New()
+		h.Write(body)
+		return h.Sum(body)
+	}
+	modify := func(f func(data []byte) []byte) []byte {
+		return rehash(f(append([]byte(nil), valid...)))
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad signature", modify(func(b []byte) []byte { b[0] = 'X'; return b })},
+		{"checksum mismatch", func() []byte { b := append([]byte(nil), valid...); b[20]++; return b }()},
+		{"version 1", modify(func(b []byte) []byte { b[7] = 1; return b })},
+		{"version 5", modify(func(b []byte) []byte { b[7] = 5; return b })},
+		{"extended flags in version 2", func() []byte {
+			b := (&Index{Version: 3, Entries: testEntries(odb.SHA1, true)}).Encode(odb.SHA1)
+			b[7] = 2
+			return rehash(b)
+		}()},
+		{"too many entries", modify(func(b []byte) []byte { b[11]++; return b })},
+		{"truncated", rehash(append([]byte(nil), valid[:len(valid)/2]...))},
+		{"unknown required extension", modify(func(b []byte) []byte {
+			body := b[:len(b)-odb.SHA1.Size()]
+			return append(body, "link\x00\x00\x00\x00"+strings.Repeat("\x00", odb.SHA1.Size())...)
+		})},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.data, odb.SHA1); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: Parse = %v, want ErrCorrupt", tt.name, err)
+		}
+	}
+
+	// Optional extensions, such as the cache tree, are skipped.
+	withTree := modify(func(b []byte) []byte {
+		body := b[:len(b)-odb.SHA1.Size()]
+		return append(body, "TREE\x00\x00\x00\x02ab"+strings.Repeat("\x00", odb.SHA1.Size())...)
+	})
+	if idx, err := Parse(withTree, odb.SHA1); err != nil || len(idx.Entries) != len(testEntries(odb.SHA1, true)) {
+		t.Errorf("Parse with an optional extension = %v", err)
+	}
+}
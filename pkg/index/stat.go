@@ -0,0 +1,77 @@
+package index
+
+import (
+	"io/fs"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// Modes recorded for working tree files.
+const (
+	modeFile       = 0100644
+	modeExecutable = 0100755
+	modeSymlink    = 0120000
+	modeGitlink    = 0160000
+)
+
+// FileMode returns the index mode for a working tree file: a symlink, an
+// executable or a regular file.
+func FileMode(info fs.FileInfo) uint32 {
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		return modeSymlink
+	case info.IsDir():
+		return modeGitlink
+	case info.Mode()&0111 != 0:
+		return modeExecutable
+	}
+	return modeFile
+}
+
+// NewEntry returns an entry for a working tree file with the given lstat
+// information and blob name.
+func NewEntry(path string, info fs.FileInfo, id odb.ID) *Entry {
+	e := &Entry{Path: path, ID: id, Mode: FileMode(info)}
+	e.SetStat(info)
+	return e
+}
+
+// SetStat records the stat information of the working tree file.
+func (e *Entry) SetStat(info fs.FileInfo) {
+	e.MTime = info.ModTime()
+	e.CTime = e.MTime
+	e.Size = uint32(info.Size())
+	fillStat(e, info)
+}
+
+// Changed reports whether the working tree file may differ from the
+// staged content according to its stat information. A false result means
+// the file can be assumed unchanged without reading it.
+func (e *Entry) Changed(info fs.FileInfo) bool {
+	if e.Mode != FileMode(info) && !(e.Mode == modeGitlink && info.IsDir()) {
+		return true
+	}
+	if e.Mode == modeGitlink {
+		return false
+	}
+	if e.MTime.IsZero() || !e.MTime.Equal(info.ModTime()) || e.Size != uint32(info.Size()) {
+		return true
+	}
+	other := &Entry{}
+	fillStat(other, info)
+	return other.Ino != e.Ino || !other.CTime.IsZero() && !other.CTime.Equal(e.CTime)
+}
+
+// IsRacy reports whether the file could have been modified within the
+// timestamp granularity of the index write, in which case stat data alone
+// cannot prove it unchanged.
+func (e *Entry) IsRacy(indexTime time.Time) bool {
+	return !e.MTime.Before(indexTime)
+}
+
+// UpToDate reports whether the stat information of a working tree file
+// proves that it still matches the entry, without reading it.
+func (idx *Index) UpToDate(e *Entry, info fs.FileInfo) bool {
+	return !e.Changed(info) && !e.IsRacy(idx.ModTime)
+}
@@ -0,0 +1,21 @@
+//go:build linux
+
+package index
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+func fillStat(e *Entry, info fs.FileInfo) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	e.CTime = time.Unix(int64(st.Ctim.Sec), int64(st.Ctim.Nsec))
+	e.Dev = uint32(st.Dev)
+	e.Ino = uint32(st.Ino)
+	e.UID = st.Uid
+	e.GID = st.Gid
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package index
+
+import "io/fs"
+
+// fillStat records only portable stat information on platforms where the
+// layout of the raw stat structure differs.
+func fillStat(e *Entry, info fs.FileInfo) {}
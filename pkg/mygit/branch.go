@@ -0,0 +1,346 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/config"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+var (
+	// ErrBranchExists is returned when creating a branch that exists.
+	ErrBranchExists = errors.New("branch already exists")
+	// ErrBranchCheckedOut is returned when deleting or resetting the
+	// current branch.
+	ErrBranchCheckedOut = errors.New("branch is checked out")
+	// ErrNotMerged is returned when deleting a branch whose commits are
+	// not reachable from its upstream or HEAD.
+	ErrNotMerged = errors.New("branch is not fully merged")
+	// ErrNoUpstream is returned when a branch has no upstream, or a ref
+	// cannot be tracked as one.
+	ErrNoUpstream = errors.New("no upstream branch")
+)
+
+// CheckBranchName validates a branch name, which must make a valid ref
+// name below refs/heads/ and cannot be HEAD or start with a dash.
+func CheckBranchName(name string) error {
+	if name == "HEAD" || strings.HasPrefix(name, "-") {
+		return fmt.Errorf("%w: %s", ErrInvalidRefName, name)
+	}
+	return CheckRefName("refs/heads/" + name)
+}
+
+// CurrentBranch returns the short name of the branch HEAD points to, or an
+// empty string if HEAD is detached. The branch may be unborn.
+func (r *Repository) CurrentBranch() (string, error) {
+	head, err := r.ReadSymbolicRef("HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(head, "refs/heads/"), nil
+}
+
+// CreateBranch creates a branch pointing at the commit startPoint names
+// and returns the commit. With force an existing branch is reset, unless
+// it is the current branch.
+func (r *Repository) CreateBranch(name, startPoint string, force bool) (odb.ID, error) {
+	if err := CheckBranchName(name); err != nil {
+		return odb.ID{}, err
+	}
+	id, err := r.ResolveRevision(startPoint)
+	if err != nil {
+		return odb.ID{}, err
+	}
+	if id, err = r.Peel(id, odb.Commit); err != nil {
+		return odb.ID{}, err
+	}
+	ref := "refs/heads/" + name
+	old, err := r.ReadRef(ref)
+	if err != nil && !errors.Is(err, ErrRefNotFound) {
+		return odb.ID{}, err
+	}
+	message := "branch: Created from " + startPoint
+	if !old.IsZero() {
+		if !force {
+			return odb.ID{}, fmt.Errorf("%w: %s", ErrBranchExists, name)
+		}
+		if current, _ := r.CurrentBranch(); current == name {
+			return odb.ID{}, fmt.Errorf("%w: cannot force update the current branch %s", ErrBranchCheckedOut, name)
+		}
+		message = "branch: Reset to " + startPoint
+	}
+	return id, r.updateRef(ref, old, id, message)
+}
+
+// DeleteBranch deletes a branch and its configuration and returns the
+// commit it pointed to. Unless force is set, the branch must be merged
+// into its upstream, or into HEAD if it has none.
+func (r *Repository) DeleteBranch(name string, force bool) (odb.ID, error) {
+	ref := "refs/heads/" + name
+	id, err := r.ReadRef(ref)
+	if err != nil {
+		return odb.ID{}, err
+	}
+	if current, _ := r.CurrentBranch(); current == name {
+		return odb.ID{}, fmt.Errorf("%w: %s", ErrBranchCheckedOut, name)
+	}
+	if !force {
+		target := "HEAD"
+		if upstream, err := r.Upstream(name); err == nil {
+			target = upstream
+		}
+		into, err := r.ReadRef(target)
+		if err != nil && !errors.Is(err, ErrRefNotFound) {
+			return odb.ID{}, err
+		}
+		merged := false
+		if !into.IsZero() {
+			if merged, err = r.IsAncestor(id, into); err != nil {
+				return odb.ID{}, err
+			}
+		}
+		if !merged {
+			return odb.ID{}, fmt.Errorf("%w: %s", ErrNotMerged, name)
+		}
+	}
+	if err := r.updateRef(ref, id, odb.ID{}, ""); err != nil {
+		return odb.ID{}, err
+	}
+	err = r.updateConfig(func(f *config.File) error {
+		if err := f.RemoveSection("branch." + name); !errors.Is(err, config.ErrNotSet) {
+			return err
+		}
+		return nil
+	})
+	return id, err
+}
+
+// RenameBranch renames a branch together with its reflog and
+// configuration, and updates HEAD if the branch is checked out. With force
+// an existing branch named newName is overwritten. The old ref is deleted
+// and the new one created in one transaction, so a rename that fails,
+// for example because newName conflicts with another branch, leaves the
+// branch as it was. Renaming a branch to its own name does nothing.
+func (r *Repository) RenameBranch(oldName, newName string, force bool) error {
+	if err := CheckBranchName(newName); err != nil {
+		return err
+	}
+	oldRef, newRef := "refs/heads/"+oldName, "refs/heads/"+newName
+	current, _ := r.CurrentBranch()
+	id, err := r.ReadRef(oldRef)
+	if errors.Is(err, ErrRefNotFound) && current == oldName {
+		// The current branch is unborn: only HEAD changes.
+		return r.SetSymbolicRef("HEAD", newRef, "")
+	} else if err != nil {
+		return err
+	}
+	if oldName == newName {
+		return nil
+	}
+	existing, err := r.ReadRef(newRef)
+	if err != nil && !errors.Is(err, ErrRefNotFound) {
+		return err
+	}
+	if !existing.IsZero() {
+		if !force {
+			return fmt.Errorf("%w: %s", ErrBranchExists, newName)
+		}
+		if current == newName {
+			return fmt.Errorf("%w: cannot force update the current branch %s", ErrBranchCheckedOut, newName)
+		}
+	}
+	entries, err := r.ReadReflog(oldRef)
+	if err != nil {
+		return err
+	}
+	tx := r.NewRefTransaction()
+	updates := []RefUpdate{
+		{Name: oldRef, Old: id, HaveOld: true, NoDeref: true},
+		{Name: newRef, New: id, Old: existing, HaveOld: true, NoDeref: true},
+	}
+	for _, u := range updates {
+		if err := tx.Update(u); err != nil {
+			return err
+		}
+	}
+	// The reflog moves with the branch and gets an entry for the rename
+	// that keeps the value.
+	tx.noLog = true
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		if err := r.writeReflog(newRef, entries); err != nil {
+			return err
+		}
+	}
+	message := fmt.Sprintf("Branch: renamed %s to %s", oldRef, newRef)
+	if err := r.appendReflog(newRef, id, id, message); err != nil {
+		return err
+	}
+	if current == oldName {
+		if err := r.SetSymbolicRef("HEAD", newRef, ""); err != nil {
+			return err
+		}
+		if err := r.appendReflog("HEAD", id, id, message); err != nil {
+			return err
+		}
+	}
+	return r.updateConfig(func(f *config.File) error {
+		if err := f.RemoveSection("branch." + newName); err != nil && !errors.Is(err, config.ErrNotSet) {
+			return err
+		}
+		if err := f.RenameSection("branch."+oldName, "branch."+newName); !errors.Is(err, config.ErrNotSet) {
+			return err
+		}
+		return nil
+	})
+}
+
+// Upstream returns the full name of the ref a branch tracks, as configured
+// by branch.<name>.remote and branch.<name>.merge: a remote-tracking ref,
+// or a local branch for the remote ".". The ref need not exist.
+func (r *Repository) Upstream(branch string) (string, error) {
+	c, err := r.Config()
+	if err != nil {
+		return "", err
+	}
+	remote, _ := c.Get("branch." + branch + ".remote")
+	merge, _ := c.Get("branch." + branch + ".merge")
+	if remote == "" || merge == "" {
+		return "", fmt.Errorf("%w: %s", ErrNoUpstream, branch)
+	}
+	if remote == "." {
+		return merge, nil
+	}
+	specs, err := r.FetchRefspecs(remote)
+	if err != nil {
+		return "", err
+	}
+	for _, spec := range specs {
+		if dst, ok := spec.Map(merge); ok && dst != "" {
+			return dst, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s: %s is not fetched from %s", ErrNoUpstream, branch, merge, remote)
+}
+
+// SetUpstream makes a branch track upstream, a full ref name. A local
+// branch is tracked through the remote "."; a remote-tracking ref through
+// the remote whose fetch refspecs map a remote branch to it.
+func (r *Repository) SetUpstream(branch, upstream string) error {
+	remote, merge := ".", upstream
+	if !strings.HasPrefix(upstream, "refs/heads/") {
+		remote = ""
+		remotes, err := r.Remotes()
+		if err != nil {
+			return err
+		}
+	search:
+		for _, name := range remotes {
+			specs, err := r.FetchRefspecs(name)
+			if err != nil {
+				return err
+			}
+			for _, spec := range specs {
+				if src, ok := spec.Reverse(upstream); ok {
+					remote, merge = name, src
+					break search
+				}
+			}
+		}
+		if remote == "" {
+			return fmt.Errorf("%w: %s is not a branch", ErrNoUpstream, upstream)
+		}
+	}
+	return r.updateConfig(func(f *config.File) error {
+		if err := f.Set("branch."+branch+".remote", remote); err != nil {
+			return err
+		}
+		return f.Set("branch."+branch+".merge", merge)
+	})
+}
+
+// UnsetUpstream removes the upstream configuration of a branch.
+func (r *Repository) UnsetUpstream(branch string) error {
+	return r.updateConfig(func(f *config.File) error {
+		errRemote := f.UnsetAll("branch." + branch + ".remote")
+		errMerge := f.UnsetAll("branch." + branch + ".merge")
+		if errors.Is(errRemote, config.ErrNotSet) && errors.Is(errMerge, config.ErrNotSet) {
+			return fmt.Errorf("%w: %s", ErrNoUpstream, branch)
+		}
+		return nil
+	})
+}
+
+// IsAncestor reports whether the commit ancestor is reachable from id.
+func (r *Repository) IsAncestor(ancestor, id odb.ID) (bool, error) {
+	reachable, err := r.reachableCommits(id)
+	if err != nil {
+		return false, err
+	}
+	ancestor, err = r.Peel(ancestor, odb.Commit)
+	if err != nil {
+		return false, err
+	}
+	return reachable[ancestor], nil
+}
+
+// AheadBehind counts the commits reachable from a but not from b, and
+// from b but not from a.
+func (r *Repository) AheadBehind(a, b odb.ID) (ahead, behind int, err error) {
+	fromA, err := r.reachableCommits(a)
+	if err != nil {
+		return 0, 0, err
+	}
+	fromB, err := r.reachableCommits(b)
+	if err != nil {
+		return 0, 0, err
+	}
+	for id := range fromA {
+		if !fromB[id] {
+			ahead++
+		}
+	}
+	for id := range fromB {
+		if !fromA[id] {
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
+
+// DetachedFrom describes a detached HEAD by the revision that was last
+// checked out, according to HEAD's reflog: a tag or remote-tracking branch
+// name, or else an abbreviated commit name. at reports whether HEAD still
+// points at that revision. name is empty if the reflog does not say.
+func (r *Repository) DetachedFrom() (name string, at bool, err error) {
+	head, err := r.ReadRef("HEAD")
+	if err != nil {
+		return "", false, err
+	}
+	entries, err := r.ReadReflog("HEAD")
+	if err != nil {
+		return "", false, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		rest, ok := strings.CutPrefix(entries[i].Message, "checkout: moving from ")
+		if !ok {
+			continue
+		}
+		to := rest[strings.LastIndex(rest, " to ")+len(" to "):]
+		id := entries[i].New
+		name = r.Abbreviate(id, 7)
+		if ref, err := r.ExpandRefName(to); err == nil && (strings.HasPrefix(ref, "refs/tags/") || strings.HasPrefix(ref, "refs/remotes/")) {
+			if target, err := r.ReadRef(ref); err == nil {
+				if peeled, err := r.Peel(target, odb.Commit); err == nil && peeled == id {
+					name = strings.TrimPrefix(strings.TrimPrefix(ref, "refs/tags/"), "refs/remotes/")
+				}
+			}
+		}
+		return name, id == head, nil
+	}
+	return "", false, nil
+}
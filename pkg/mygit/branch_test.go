@@ -0,0 +1,133 @@
+package mygit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// initBranches creates a repository with a commit on main, which is
+// checked out, and a branch for each of the names.
+func initBranches(t *testing.T, names ...string) (*Repository, odb.ID) {
+	t.Helper()
+	r, _ := initRepo(t, odb.SHA1)
+	id := commitTree(t, r, writeTree(t, r, map[string]string{"file": "content\n"}))
+	for _, name := range append([]string{"main"}, names...) {
+		if _, err := r.CreateBranch(name, id.String(), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r, id
+}
+
+func TestRenameBranch(t *testing.T) {
+	tests := []struct {
+		name     string
+		branches []string
+		old, new string
+	}{
+		{"simple", []string{"topic"}, "topic", "feature"},
+		{"into a new directory", []string{"topic"}, "topic", "dir/topic"},
+		{"below itself", []string{"topic"}, "topic", "topic/sub"},
+		{"to its directory", []string{"topic/sub"}, "topic/sub", "topic"},
+		{"current branch", nil, "main", "trunk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, id := initBranches(t, tt.branches...)
+			if err := r.SetUpstream(tt.old, "refs/heads/main"); err != nil && tt.old != "main" {
+				t.Fatal(err)
+			}
+			before, err := r.ReadReflog("refs/heads/" + tt.old)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.RenameBranch(tt.old, tt.new, false); err != nil {
+				t.Fatalf("RenameBranch(%s, %s): %v", tt.old, tt.new, err)
+			}
+			if _, err := r.ReadRef("refs/heads/" + tt.old); !errors.Is(err, ErrRefNotFound) {
+				t.Errorf("old branch still exists: %v", err)
+			}
+			if got, err := r.ReadRef("refs/heads/" + tt.new); err != nil || got != id {
+				t.Errorf("new branch = %s, %v, want %s", got, err, id)
+			}
+			after, err := r.ReadReflog("refs/heads/" + tt.new)
+			if err != nil || len(after) != len(before)+1 {
+				t.Errorf("new branch has %d reflog entries, %v; want %d", len(after), err, len(before)+1)
+			}
+			if r.HasReflog("refs/heads/" + tt.old) {
+				t.Error("old branch still has a reflog")
+			}
+			if tt.old == "main" {
+				if head, _ := r.ReadSymbolicRef("HEAD"); head != "refs/heads/"+tt.new {
+					t.Errorf("HEAD = %s, want refs/heads/%s", head, tt.new)
+				}
+			} else if upstream, err := r.Upstream(tt.new); err != nil || upstream != "refs/heads/main" {
+				t.Errorf("upstream of the renamed branch = %q, %v", upstream, err)
+			}
+		})
+	}
+}
+
+func TestRenameBranchErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		branches []string
+		old, new string
+		want     error
+	}{
+		{"missing branch", nil, "topic", "feature", ErrRefNotFound},
+		{"existing branch", []string{"topic", "feature"}, "topic", "feature", ErrBranchExists},
+		{"directory of a branch", []string{"topic", "dir/sub"}, "topic", "dir", ErrRefConflict},
+		{"below a branch", []string{"topic", "dir"}, "topic", "dir/sub", ErrRefConflict},
+		{"invalid name", []string{"topic"}, "topic", "bad..name", ErrInvalidRefName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, id := initBranches(t, tt.branches...)
+			if err := r.RenameBranch(tt.old, tt.new, false); !errors.Is(err, tt.want) {
+				t.Fatalf("RenameBranch(%s, %s) = %v, want %v", tt.old, tt.new, err, tt.want)
+			}
+			for _, name := range tt.branches {
+				if got, err := r.ReadRef("refs/heads/" + name); err != nil || got != id {
+					t.Errorf("branch %s = %s, %v after a failed rename", name, got, err)
+				}
+				if !r.HasReflog("refs/heads/" + name) {
+					t.Errorf("branch %s lost its reflog", name)
+				}
+			}
+		})
+	}
+}
+
+func TestRenameBranchToItself(t *testing.T) {
+	r, id := initBranches(t, "topic")
+	if err := r.SwitchBranch("main", true); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"main", "topic"} {
+		if err := r.RenameBranch(name, name, false); err != nil {
+			t.Errorf("RenameBranch(%s, %s): %v", name, name, err)
+		}
+		if got, err := r.ReadRef("refs/heads/" + name); err != nil || got != id {
+			t.Errorf("branch %s = %s, %v after renaming it to itself", name, got, err)
+		}
+	}
+	if head, err := r.ReadRef("HEAD"); err != nil || head != id {
+		t.Errorf("HEAD = %s, %v", head, err)
+	}
+}
+
+func TestRenameBranchForce(t *testing.T) {
+	r, id := initBranches(t, "topic", "feature")
+	if err := r.RenameBranch("topic", "feature", true); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := r.ReadRef("refs/heads/feature"); err != nil || got != id {
+		t.Errorf("feature = %s, %v", got, err)
+	}
+	if err := r.RenameBranch("feature", "main", true); !errors.Is(err, ErrBranchCheckedOut) {
+		t.Errorf("overwriting the current branch: %v, want ErrBranchCheckedOut", err)
+	}
+}
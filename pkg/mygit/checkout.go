@@ -0,0 +1,530 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/index"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// ErrUntrackedFiles is returned when a checkout would overwrite files that
+// are not tracked.
+var ErrUntrackedFiles = errors.New("untracked working tree files would be overwritten")
+
+// SwitchBranch checks out a branch and points HEAD at it. Files that
+// differ between the current and the new commit are updated in the index
+// and the working tree; local changes to other files are kept. Unless
+// force is set, the switch fails without changing anything if it would
+// overwrite local changes or untracked files.
+func (r *Repository) SwitchBranch(name string, force bool) error {
+	ref := "refs/heads/" + name
+	id, err := r.ReadRef(ref)
+	if err != nil {
+		return err
+	}
+	from, err := r.checkoutSource()
+	if err != nil {
+		return err
+	}
+	if err := r.checkoutCommit(id, force); err != nil {
+		return err
+	}
+	return r.SetSymbolicRef("HEAD", ref, fmt.Sprintf("checkout: moving from %s to %s", from, name))
+}
+
+// DetachHead checks out the commit a revision names like SwitchBranch and
+// points HEAD directly at it.
+func (r *Repository) DetachHead(rev string, force bool) error {
+	id, err := r.ResolveRevision(rev)
+	if err != nil {
+		return err
+	}
+	if id, err = r.Peel(id, odb.Commit); err != nil {
+		return err
+	}
+	from, err := r.checkoutSource()
+	if err != nil {
+		return err
+	}
+	if err := r.checkoutCommit(id, force); err != nil {
+		return err
+	}
+	tx := r.NewRefTransaction()
+	u := RefUpdate{Name: "HEAD", New: id, NoDeref: true, Message: fmt.Sprintf("checkout: moving from %s to %s", from, rev)}
+	if err := tx.Update(u); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SwitchNewBranch creates a branch at the commit startPoint names and
+// checks it out like SwitchBranch. With reset an existing branch, even the
+// current one, is moved to the commit instead. The branch is only created
+// or moved once the checkout succeeded.
+func (r *Repository) SwitchNewBranch(name, startPoint string, reset, force bool) error {
+	if err := CheckBranchName(name); err != nil {
+		return err
+	}
+	id, err := r.ResolveRevision(startPoint)
+	if err != nil {
+		return err
+	}
+	if id, err = r.Peel(id, odb.Commit); err != nil {
+		return err
+	}
+	ref := "refs/heads/" + name
+	old, err := r.ReadRef(ref)
+	if err != nil && !errors.Is(err, ErrRefNotFound) {
+		return err
+	}
+	message := "branch: Created from " + startPoint
+	if !old.IsZero() {
+		if !reset {
+			return fmt.Errorf("%w: %s", ErrBranchExists, name)
+		}
+		message = "branch: Reset to " + startPoint
+	}
+	from, err := r.checkoutSource()
+	if err != nil {
+		return err
+	}
+	if err := r.checkoutCommit(id, force); err != nil {
+		return err
+	}
+	if err := r.updateRef(ref, old, id, message); err != nil {
+		return err
+	}
+	return r.SetSymbolicRef("HEAD", ref, fmt.Sprintf("checkout: moving from %s to %s", from, name))
+}
+
+// checkoutSource names what HEAD points to for the reflog of a checkout:
+// the current branch, or the commit if HEAD is detached.
+func (r *Repository) checkoutSource() (string, error) {
+	branch, err := r.CurrentBranch()
+	if err != nil || branch != "" {
+		return branch, err
+	}
+	head, err := r.ReadRef("HEAD")
+	if err != nil {
+		return "", err
+	}
+	return head.String(), nil
+}
+
+// checkoutCommit updates the index and the working tree from the tree of
+// HEAD to the tree of a commit.
+func (r *Repository) checkoutCommit(id odb.ID, force bool) error {
+	tree, err := r.Peel(id, odb.Tree)
+	if err != nil {
+		return err
+	}
+	head, err := r.headTree()
+	if err != nil {
+		return err
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if err := r.checkoutTree(idx, head, tree, force); err != nil {
+		return err
+	}
+	return r.WriteIndex(idx)
+}
+
+// checkoutTree moves the index and the working tree from the tree from to
+// the tree to, which may be the zero ID for an empty tree. Only paths that
+// differ between the trees are touched, so local changes to other paths
+// are carried over. Unless force is set, every touched path must be
+// unchanged from the old tree in both the index and the working tree, or
+// already staged as in the new tree, and new files must not overwrite
+// untracked ones; otherwise nothing is changed. With force, the index and
+// the touched files are reset to the new tree.
+func (r *Repository) checkoutTree(idx *index.Index, from, to odb.ID, force bool) error {
+	oldFiles, err := r.ReadTreeFiles(from)
+	if err != nil {
+		return err
+	}
+	newFiles, err := r.ReadTreeFiles(to)
+	if err != nil {
+		return err
+	}
+	unmerged := unmergedPaths(idx)
+	paths := make(map[string]bool)
+	for name := range oldFiles {
+		paths[name] = true
+	}
+	for name := range newFiles {
+		paths[name] = true
+	}
+	if force {
+		for _, e := range idx.Entries {
+			paths[e.Path] = true
+		}
+	}
+	var removals, writes, modified, untracked []string
+	for name := range paths {
+		o, inOld := oldFiles[name]
+		n, inNew := newFiles[name]
+		e := idx.Entry(name)
+		if force {
+			if !inNew {
+				removals = append(removals, name)
+			} else if e == nil || !entryMatches(e, n) || unmerged[name] || r.worktreeChanged(idx, e) {
+				writes = append(writes, name)
+			}
+			continue
+		}
+		if inOld == inNew && (!inOld || o.ID == n.ID && o.Mode == n.Mode) {
+			continue
+		}
+		if unmerged[name] {
+			modified = append(modified, name)
+			continue
+		}
+		if e != nil && inNew && entryMatches(e, n) {
+			// The change is already staged.
+			continue
+		}
+		switch {
+		case e == nil && inOld || e != nil && (!inOld || !entryMatches(e, o)):
+			modified = append(modified, name)
+			continue
+		case e != nil && r.worktreeChanged(idx, e):
+			modified = append(modified, name)
+			continue
+		case e == nil && r.blocksCheckout(idx, name, n):
+			untracked = append(untracked, name)
+			continue
+		}
+		if inNew {
+			writes = append(writes, name)
+		} else {
+			removals = append(removals, name)
+		}
+	}
+	switch {
+	case len(modified) > 0:
+		sort.Strings(modified)
+		return fmt.Errorf("%w by checkout:\n\t%s", ErrLocalChanges, strings.Join(modified, "\n\t"))
+	case len(untracked) > 0:
+		sort.Strings(untracked)
+		return fmt.Errorf("%w by checkout:\n\t%s", ErrUntrackedFiles, strings.Join(untracked, "\n\t"))
+	}
+	// Removing first frees paths that become directories, and the other
+	// way around.
+	sort.Strings(removals)
+	for _, name := range removals {
+		idx.Remove(name)
+		// Files that were only staged are kept, as untracked files.
+		if _, ok := oldFiles[name]; !ok {
+			continue
+		}
+		if err := r.removeWorktreeFile(name); err != nil {
+			return err
+		}
+	}
+	sort.Strings(writes)
+	for _, name := range writes {
+		e, err := r.writeWorktreeFile(name, newFiles[name])
+		if err != nil {
+			return err
+		}
+		idx.Add(e)
+	}
+	return nil
+}
+
+// entryMatches reports whether an index entry stages a tree entry.
+func entryMatches(e *index.Entry, t TreeEntry) bool {
+	return e.ID == t.ID && FileMode(e.Mode) == t.Mode
+}
+
+// unmergedPaths returns the paths with conflict entries in the index.
+func unmergedPaths(idx *index.Index) map[string]bool {
+	paths := make(map[string]bool)
+	for _, e := range idx.Entries {
+		if e.Stage != 0 {
+			paths[e.Path] = true
+		}
+	}
+	return paths
+}
+
+// worktreeChanged reports whether the working tree file of an index entry
+// has changes that a checkout would lose. A deleted file has none.
+func (r *Repository) worktreeChanged(idx *index.Index, e *index.Entry) bool {
+	info, err := os.Lstat(r.worktreePath(e.Path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false
+	} else if err != nil {
+		return true
+	}
+	if info.IsDir() && FileMode(e.Mode) != ModeGitlink {
+		return true
+	}
+	modified, err := r.worktreeModified(idx, e, info)
+	return err != nil || modified
+}
+
+// blocksCheckout reports whether an untracked file, or an untracked
+// directory or file on the way to it, would be overwritten by creating an
+// untracked path from a tree entry. A file that already has the entry's
+// content is not lost.
+func (r *Repository) blocksCheckout(idx *index.Index, name string, t TreeEntry) bool {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if info, err := os.Lstat(r.worktreePath(dir)); err == nil && !info.IsDir() && idx.Entry(dir) == nil {
+			return true
+		}
+	}
+	info, err := os.Lstat(r.worktreePath(name))
+	if err != nil {
+		return false
+	}
+	if info.IsDir() {
+		return t.Mode != ModeGitlink && hasFiles(r.worktreePath(name))
+	}
+	mode, id, err := r.hashWorktreeFile(name, info, false)
+	return err != nil || mode != t.Mode || id != t.ID
+}
+
+// hasFiles reports whether a directory contains anything but empty
+// directories.
+func hasFiles(dir string) bool {
+	found := errors.New("found")
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			return found
+		}
+		return err
+	})
+	return err != nil
+}
+
+// removeWorktreeFile deletes a working tree file and the directories left
+// empty by it.
+func (r *Repository) removeWorktreeFile(name string) error {
+	if err := verifyPath(name); err != nil {
+		return err
+	}
+	full := r.worktreePath(name)
+	info, err := os.Lstat(full)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		// A gitlink is left in place unless it is an empty directory.
+		os.Remove(full)
+	} else if err := os.Remove(full); err != nil {
+		return err
+	}
+	r.removeEmptyDirs(path.Dir(name))
+	return nil
+}
+
+// writeWorktreeFile writes a tree entry to the working tree, replacing
+// what is there, and returns the index entry for it. A gitlink becomes an
+// empty directory where the submodule can be checked out.
+func (r *Repository) writeWorktreeFile(name string, t TreeEntry) (*index.Entry, error) {
+	if err := verifyPath(name); err != nil {
+		return nil, err
+	}
+	full := r.worktreePath(name)
+	if err := r.makeParentDirs(name); err != nil {
+		return nil, err
+	}
+	if info, err := os.Lstat(full); err == nil {
+		if info.IsDir() && t.Mode == ModeGitlink {
+			return &index.Entry{Path: name, Mode: uint32(t.Mode), ID: t.ID}, nil
+		}
+		if err := os.RemoveAll(full); err != nil {
+			return nil, err
+		}
+	}
+	if t.Mode == ModeGitlink {
+		if err := os.Mkdir(full, 0755); err != nil {
+			return nil, err
+		}
+		return &index.Entry{Path: name, Mode: uint32(t.Mode), ID: t.ID}, nil
+	}
+	typ, data, err := r.ReadObject(t.ID)
+	if err != nil {
+		return nil, err
+	}
+	if typ != odb.Blob {
+		return nil, fmt.Errorf("%w: %s: %s is a %s", ErrCorruptObject, name, t.ID, typ)
+	}
+	switch t.Mode {
+	case ModeSymlink:
+		err = os.Symlink(string(data), full)
+	case ModeExecutable:
+		err = os.WriteFile(full, data, 0755)
+	default:
+		err = os.WriteFile(full, data, 0644)
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Lstat(full)
+	if err != nil {
+		return nil, err
+	}
+	e := index.NewEntry(name, info, t.ID)
+	e.Mode = uint32(t.Mode)
+	return e, nil
+}
+
+// makeParentDirs creates the directories leading to a working tree path,
+// replacing files in the way.
+func (r *Repository) makeParentDirs(name string) error {
+	dir := path.Dir(name)
+	if dir == "." {
+		return nil
+	}
+	var missing []string
+	for d := dir; d != "."; d = path.Dir(d) {
+		info, err := os.Lstat(r.worktreePath(d))
+		if err == nil && info.IsDir() {
+			break
+		}
+		if err == nil {
+			if err := os.Remove(r.worktreePath(d)); err != nil {
+				return err
+			}
+		}
+		missing = append(missing, d)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := os.Mkdir(r.worktreePath(missing[i]), 0755); err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreOptions configures Restore.
+type RestoreOptions struct {
+	// Source is the tree-ish to restore from. It defaults to HEAD when
+	// restoring the index and to the index otherwise.
+	Source string
+	// Staged restores the index and Worktree the working tree. If neither
+	// is set, the working tree is restored.
+	Staged, Worktree bool
+	// Overlay keeps files that are missing from the source instead of
+	// removing them.
+	Overlay bool
+}
+
+// Restore overwrites the index entries or working tree files below the
+// repository-relative paths with their content in the source. Each path
+// must match a file in the source or, unless opts.Overlay is set, the
+// index.
+func (r *Repository) Restore(paths []string, opts RestoreOptions) error {
+	if !opts.Staged && !opts.Worktree {
+		opts.Worktree = true
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return err
+	}
+	source := make(map[string]TreeEntry)
+	fromIndex := opts.Source == "" && !opts.Staged
+	if fromIndex {
+		for _, e := range idx.Entries {
+			if e.Stage == 0 {
+				source[e.Path] = TreeEntry{Mode: FileMode(e.Mode), Name: e.Path, ID: e.ID}
+			}
+		}
+	} else {
+		var tree odb.ID
+		if opts.Source != "" {
+			if tree, err = r.resolveTreeish(opts.Source); err != nil {
+				return err
+			}
+		} else if tree, err = r.headTree(); err != nil {
+			return err
+		}
+		if source, err = r.ReadTreeFiles(tree); err != nil {
+			return err
+		}
+	}
+	unmerged := unmergedPaths(idx)
+	matched := make([]bool, len(paths))
+	targets := make(map[string]bool)
+	for name := range source {
+		if i := inPathspec(name, paths); i >= 0 {
+			matched[i] = true
+			targets[name] = true
+		}
+	}
+	for _, e := range idx.Entries {
+		if opts.Overlay {
+			break
+		}
+		if i := inPathspec(e.Path, paths); i >= 0 {
+			matched[i] = true
+			targets[e.Path] = true
+		}
+	}
+	for i, spec := range paths {
+		if !matched[i] {
+			return fmt.Errorf("%w: pathspec '%s' did not match any files", ErrPathNotFound, spec)
+		}
+	}
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		if fromIndex && unmerged[name] {
+			return fmt.Errorf("%w: path '%s' is unmerged", ErrUnmerged, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t, ok := source[name]
+		if opts.Worktree {
+			if ok {
+				e, err := r.writeWorktreeFile(name, t)
+				if err != nil {
+					return err
+				}
+				// The written file matches its index entry if that
+				// stages the same content.
+				if cur := idx.Entry(name); opts.Staged || cur != nil && entryMatches(cur, t) {
+					idx.Add(e)
+				}
+			} else if idx.Entry(name) != nil || opts.Source != "" {
+				if err := r.removeWorktreeFile(name); err != nil {
+					return err
+				}
+			}
+		}
+		if !opts.Staged {
+			continue
+		}
+		switch cur := idx.Entry(name); {
+		case !ok:
+			idx.Remove(name)
+		case cur == nil || !entryMatches(cur, t) || unmerged[name]:
+			idx.Add(&index.Entry{Path: name, Mode: uint32(t.Mode), ID: t.ID})
+		}
+	}
+	return r.WriteIndex(idx)
+}
+
+// resolveTreeish resolves a tree-ish revision to a tree.
+func (r *Repository) resolveTreeish(rev string) (odb.ID, error) {
+	id, err := r.ResolveRevision(rev)
+	if err != nil {
+		return odb.ID{}, err
+	}
+	return r.Peel(id, odb.Tree)
+}
@@ -0,0 +1,203 @@
+package mygit
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+func TestCheckoutRejectsInvalidPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		tree func(r *Repository, blob odb.ID) odb.ID
+	}{
+		{"parent directory", func(r *Repository, blob odb.ID) odb.ID {
+			return writeRawTree(t, r, TreeEntry{Mode: ModeFile, Name: "../escaped", ID: blob})
+		}},
+		{"dot dot", func(r *Repository, blob odb.ID) odb.ID {
+			sub := writeRawTree(t, r, TreeEntry{Mode: ModeFile, Name: "escaped", ID: blob})
+			return writeRawTree(t, r, TreeEntry{Mode: ModeTree, Name: "..", ID: sub})
+		}},
+		{"nested parent directory", func(r *Repository, blob odb.ID) odb.ID {
+			sub := writeRawTree(t, r, TreeEntry{Mode: ModeFile, Name: "../../escaped", ID: blob})
+			return writeRawTree(t, r, TreeEntry{Mode: ModeTree, Name: "sub", ID: sub})
+		}},
+		{"dot", func(r *Repository, blob odb.ID) odb.ID {
+			sub := writeRawTree(t, r, TreeEntry{Mode: ModeFile, Name: "file", ID: blob})
+			return writeRawTree(t, r, TreeEntry{Mode: ModeTree, Name: ".", ID: sub})
+		}},
+		{"empty name", func(r *Repository, blob odb.ID) odb.ID {
+			return writeRawTree(t, r, TreeEntry{Mode: ModeFile, Name: "", ID: blob})
+		}},
+		{"git directory", func(r *Repository, blob odb.ID) odb.ID {
+			sub := writeRawTree(t, r, TreeEntry{Mode: ModeFile, Name: "config", ID: blob})
+			return writeRawTree(t, r, TreeEntry{Mode: ModeTree, Name: ".git", ID: sub})
+		}},
+		{"git directory in another case", func(r *Repository, blob odb.ID) odb.ID {
+			return writeRawTree(t, r, TreeEntry{Mode: ModeFile, Name: ".GiT", ID: blob})
+		}},
+		{"nested git directory", func(r *Repository, blob odb.ID) odb.ID {
+			sub := writeRawTree(t, r, TreeEntry{Mode: ModeFile, Name: ".git", ID: blob})
+			return writeRawTree(t, r, TreeEntry{Mode: ModeTree, Name: "sub", ID: sub})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, dir := initRepo(t, odb.SHA1)
+			base := commitTree(t, r, writeTree(t, r, map[string]string{"file": "base\n"}))
+			if _, err := r.CreateBranch("main", base.String(), true); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.SwitchBranch("main", true); err != nil {
+				t.Fatal(err)
+			}
+			blob, err := r.WriteObject(odb.Blob, []byte("hostile\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			hostile := commitTree(t, r, tt.tree(r, blob), base)
+			if _, err := r.CreateBranch("hostile", hostile.String(), false); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, force := range []bool{false, true} {
+				if err := r.SwitchBranch("hostile", force); !errors.Is(err, ErrInvalidPath) {
+					t.Errorf("SwitchBranch(force=%t) = %v, want ErrInvalidPath", force, err)
+				}
+			}
+			if err := r.DetachHead(hostile.String(), true); !errors.Is(err, ErrInvalidPath) {
+				t.Errorf("DetachHead = %v, want ErrInvalidPath", err)
+			}
+			opts := RestoreOptions{Source: hostile.String(), Staged: true, Worktree: true}
+			if err := r.Restore([]string{""}, opts); !errors.Is(err, ErrInvalidPath) {
+				t.Errorf("Restore = %v, want ErrInvalidPath", err)
+			}
+
+			if _, err := os.Lstat(filepath.Join(filepath.Dir(dir), "escaped")); err == nil {
+				t.Error("checkout wrote a file outside the working tree")
+			}
+			if files := worktreeFiles(t, dir); !slices.Equal(files, []string{"file"}) {
+				t.Errorf("working tree has %q, want only file", files)
+			}
+			if head, err := r.ReadSymbolicRef("HEAD"); err != nil || head != "refs/heads/main" {
+				t.Errorf("HEAD = %q, %v, want refs/heads/main", head, err)
+			}
+			if _, err := r.Config(); err != nil {
+				t.Errorf("repository config is damaged: %v", err)
+			}
+		})
+	}
+}
+
+func TestSwitchBranchRefusesToLoseChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		// change alters the working tree or index on main.
+		change func(r *Repository, dir string) error
+		want   error
+	}{
+		{"modified file", func(r *Repository, dir string) error {
+			return os.WriteFile(filepath.Join(dir, "file"), []byte("modified\n"), 0644)
+		}, ErrLocalChanges},
+		{"staged change", func(r *Repository, dir string) error {
+			return r.Stage("file", ModeFile, []byte("staged\n"))
+		}, ErrLocalChanges},
+		{"staged new file", func(r *Repository, dir string) error {
+			return r.Stage("added", ModeFile, []byte("staged\n"))
+		}, ErrLocalChanges},
+		{"untracked file", func(r *Repository, dir string) error {
+			return os.WriteFile(filepath.Join(dir, "added"), []byte("untracked\n"), 0644)
+		}, ErrUntrackedFiles},
+		{"untracked file in a new directory", func(r *Repository, dir string) error {
+			if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+				return err
+			}
+			return os.WriteFile(filepath.Join(dir, "sub", "new"), []byte("untracked\n"), 0644)
+		}, ErrUntrackedFiles},
+		{"change to an unchanged file", func(r *Repository, dir string) error {
+			return os.WriteFile(filepath.Join(dir, "same"), []byte("modified\n"), 0644)
+		}, nil},
+		{"deleted file", func(r *Repository, dir string) error {
+			return os.Remove(filepath.Join(dir, "file"))
+		}, nil},
+		{"identical untracked file", func(r *Repository, dir string) error {
+			return os.WriteFile(filepath.Join(dir, "added"), []byte("other\n"), 0644)
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, dir := initRepo(t, odb.SHA1)
+			main := commitTree(t, r, writeTree(t, r, map[string]string{"file": "main\n", "same": "same\n"}))
+			other := commitTree(t, r, writeTree(t, r, map[string]string{
+				"file": "other\n", "same": "same\n", "added": "other\n", "sub/new": "other\n",
+			}), main)
+			if _, err := r.CreateBranch("main", main.String(), true); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.CreateBranch("other", other.String(), false); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.SwitchBranch("main", true); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.change(r, dir); err != nil {
+				t.Fatal(err)
+			}
+			before := snapshot(t, r, dir)
+
+			err := r.SwitchBranch("other", false)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("SwitchBranch = %v, want success", err)
+				}
+				if head, _ := r.ReadSymbolicRef("HEAD"); head != "refs/heads/other" {
+					t.Errorf("HEAD = %q after switching, want refs/heads/other", head)
+				}
+				if data, _ := os.ReadFile(filepath.Join(dir, "same")); string(data) != before["worktree same"] {
+					t.Errorf("same = %q after switching, want the local content %q", data, before["worktree same"])
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("SwitchBranch = %v, want %v", err, tt.want)
+			}
+			if after := snapshot(t, r, dir); !maps.Equal(after, before) {
+				t.Errorf("refused checkout changed the repository:\nbefore %q\nafter  %q", before, after)
+			}
+			if err := r.SwitchBranch("other", true); err != nil {
+				t.Errorf("forced SwitchBranch = %v", err)
+			}
+		})
+	}
+}
+
+// snapshot returns the working tree files with their content, the index
+// entries with their blob names and the target of HEAD.
+func snapshot(t *testing.T, r *Repository, dir string) map[string]string {
+	t.Helper()
+	state := make(map[string]string)
+	for _, name := range worktreeFiles(t, dir) {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		state["worktree "+name] = string(data)
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range idx.Entries {
+		state["index "+e.Path] = e.ID.String()
+	}
+	state["HEAD"], err = r.ReadSymbolicRef("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
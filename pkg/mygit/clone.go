@@ -0,0 +1,423 @@
+package mygit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/config"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// advertisedRef is a ref listed by the remote's ls-refs command.
+type advertisedRef struct {
+	name string
+	id   odb.ID
+	// target is the ref a symbolic ref points to.
+	target string
+	// peeled is the object an annotated tag points to.
+	peeled odb.ID
+}
+
+// remoteName is the name of the remote a clone is made from.
+const remoteName = "origin"
+
+// ErrDestinationExists is returned by Clone for a destination that is
+// not an empty directory.
+var ErrDestinationExists = errors.New("destination path already exists and is not an empty directory")
+
+// cloner holds what a remote advertised during a clone.
+type cloner struct {
+	url    string
+	format *odb.Algorithm
+	refs   []advertisedRef
+}
+
+// CloneOptions configures Clone.
+type CloneOptions struct {
+	// Branch names a branch or tag of the remote to check out instead of
+	// the remote's HEAD. A tag is checked out on a detached HEAD.
+	Branch string
+	// Revision is a full object name, or a ref of the remote, to check
+	// out on a detached HEAD. Only its history is fetched and no branches
+	// are created.
+	Revision string
+	// NoCheckout leaves the index and the working tree empty.
+	NoCheckout bool
+	// Bare creates a bare repository in dir. The remote's branches become
+	// local branches and nothing is checked out.
+	Bare bool
+}
+
+// Clone clones the repository at url into dir using the smart HTTP
+// protocol version 2. The remote's branches are recorded as
+// remote-tracking branches of the remote "origin" and its tags as tags;
+// the branch the remote's HEAD points to is created and checked out. A
+// tree with paths that would be written outside dir or into its .git
+// directory fails the clone with ErrInvalidPath before any file is
+// checked out; like any failed clone it leaves dir as it found it.
+func Clone(url, dir string, opts CloneOptions) (*Repository, error) {
+	entries, err := os.ReadDir(dir)
+	existed := err == nil
+	if existed && len(entries) > 0 || err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrDestinationExists, dir)
+	}
+	c := &cloner{url: url}
+	if c.format, err = c.getObjectFormat(); err != nil {
+		return nil, err
+	}
+	if c.refs, err = c.listRefs(); err != nil {
+		return nil, err
+	}
+	head, err := c.checkoutRef(opts)
+	if err != nil {
+		return nil, err
+	}
+	wants := c.wants()
+	if opts.Revision != "" {
+		wants = []odb.ID{head.id}
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	r, err := Init(dir, InitOptions{
+		ObjectFormat:  c.format,
+		InitialBranch: strings.TrimPrefix(head.target, "refs/heads/"),
+		Bare:          opts.Bare,
+	})
+	if err == nil {
+		if err = c.populate(r, wants, head, opts); err != nil {
+			r.Close()
+		}
+	}
+	if err != nil {
+		// A failed clone leaves dir as it found it.
+		if existed {
+			removeContents(dir)
+		} else {
+			os.RemoveAll(dir)
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// removeContents removes everything below dir.
+func removeContents(dir string) {
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		os.RemoveAll(filepath.Join(dir, e.Name()))
+	}
+}
+
+// populate fetches the wanted objects into a new repository, writes the
+// refs and checks out head.
+func (c *cloner) populate(r *Repository, wants []odb.ID, head advertisedRef, opts CloneOptions) error {
+	if err := c.fetchPack(r, wants); err != nil {
+		return err
+	}
+	if err := c.writeRefs(r, head, opts); err != nil {
+		return err
+	}
+	if opts.Bare || opts.NoCheckout || head.id.IsZero() {
+		return nil
+	}
+	tree, err := r.Peel(head.id, odb.Tree)
+	if err != nil {
+		return err
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if err := r.checkoutTree(idx, odb.ID{}, tree, false); err != nil {
+		return err
+	}
+	return r.WriteIndex(idx)
+}
+
+// request sends a request to the remote's upload-pack service and returns
+// the response body, which the caller must close.
+func (c *cloner) request(method, path string, body io.Reader) (io.ReadCloser, error) {
+	req, err := http.NewRequest(method, c.url+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Git-Protocol", "version=2")
+	if body != nil {
+		req.Header.Add("Content-Type", "application/x-git-upload-pack-request")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", c.url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// getObjectFormat reads the server's capability advertisement and returns
+// the object format of the remote repository.
+func (c *cloner) getObjectFormat() (*odb.Algorithm, error) {
+	body, err := c.request("GET", "/info/refs?service=git-upload-pack", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	p := newPktReader(body)
+	for {
+		payload, err := p.next()
+		if err != nil {
+			break
+		}
+		line := strings.TrimSuffix(string(payload), "\n")
+		if format, ok := strings.CutPrefix(line, "object-format="); ok {
+			return odb.LookupAlgorithm(format)
+		}
+	}
+	return odb.SHA1, nil
+}
+
+// capabilities returns the capability lines sent with every command.
+func (c *cloner) capabilities() string {
+	if c.format == odb.SHA1 {
+		return ""
+	}
+	return pktLine("object-format=" + c.format.Name() + "\n")
+}
+
+// listRefs returns the remote's HEAD, branches and tags, with the targets
+// of symbolic refs and the peeled values of annotated tags.
+func (c *cloner) listRefs() ([]advertisedRef, error) {
+	buf := bytes.NewBufferString(
+		pktLine("command=ls-refs\n") + c.capabilities() + "0001" +
+			pktLine("symrefs\n") + pktLine("peel\n") +
+			pktLine("ref-prefix HEAD\n") + pktLine("ref-prefix refs/heads/\n") + pktLine("ref-prefix refs/tags/\n") +
+			"0000",
+	)
+	body, err := c.request("POST", "/git-upload-pack", buf)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	p := newPktReader(body)
+	var refs []advertisedRef
+	for {
+		payload, err := p.next()
+		if err == io.EOF || err == nil && payload == nil {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		line := strings.TrimSuffix(string(payload), "\n")
+		fields := strings.Split(line, " ")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s: bad ref advertisement %q", c.url, line)
+		}
+		id, err := c.format.ParseID(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad ref advertisement %q: %w", c.url, line, err)
+		}
+		ref := advertisedRef{name: fields[1], id: id}
+		for _, attr := range fields[2:] {
+			if target, ok := strings.CutPrefix(attr, "symref-target:"); ok {
+				ref.target = target
+			} else if peeled, ok := strings.CutPrefix(attr, "peeled:"); ok {
+				if ref.peeled, err = c.format.ParseID(peeled); err != nil {
+					return nil, fmt.Errorf("%s: bad ref advertisement %q: %w", c.url, line, err)
+				}
+			}
+		}
+		if ref.name != "HEAD" && CheckRefName(ref.name) != nil {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("%s: no refs advertised", c.url)
+	}
+	return refs, nil
+}
+
+// wants returns the objects the advertised refs point to, without
+// duplicates.
+func (c *cloner) wants() []odb.ID {
+	seen := make(map[odb.ID]bool)
+	var ids []odb.ID
+	for _, ref := range c.refs {
+		if !seen[ref.id] {
+			seen[ref.id] = true
+			ids = append(ids, ref.id)
+		}
+	}
+	return ids
+}
+
+// remoteHead returns the remote's HEAD. Its target is empty if HEAD is
+// detached or does not point to a branch.
+func (c *cloner) remoteHead() advertisedRef {
+	for _, ref := range c.refs {
+		if ref.name == "HEAD" {
+			if !strings.HasPrefix(ref.target, "refs/heads/") {
+				ref.target = ""
+			}
+			return ref
+		}
+	}
+	return advertisedRef{}
+}
+
+// checkoutRef returns what the clone's HEAD points to: the remote's HEAD,
+// or the branch, tag or revision the options name. Its target is the
+// branch to create, or empty for a detached HEAD; a tag is peeled to the
+// commit.
+func (c *cloner) checkoutRef(opts CloneOptions) (advertisedRef, error) {
+	switch {
+	case opts.Revision != "":
+		for _, name := range []string{opts.Revision, "refs/heads/" + opts.Revision, "refs/tags/" + opts.Revision} {
+			if ref, ok := c.findRef(name); ok && name != "HEAD" {
+				return advertisedRef{name: name, id: ref.peeledID()}, nil
+			}
+		}
+		id, err := c.format.ParseID(opts.Revision)
+		if err != nil {
+			return advertisedRef{}, fmt.Errorf("%w: remote revision %s not found in upstream %s", ErrRefNotFound, opts.Revision, remoteName)
+		}
+		return advertisedRef{name: opts.Revision, id: id}, nil
+	case opts.Branch != "":
+		if ref, ok := c.findRef("refs/heads/" + opts.Branch); ok {
+			ref.target = ref.name
+			return ref, nil
+		}
+		if ref, ok := c.findRef("refs/tags/" + opts.Branch); ok {
+			return advertisedRef{name: ref.name, id: ref.peeledID()}, nil
+		}
+		return advertisedRef{}, fmt.Errorf("%w: remote branch %s not found in upstream %s", ErrRefNotFound, opts.Branch, remoteName)
+	}
+	return c.remoteHead(), nil
+}
+
+// findRef looks up an advertised ref by its full name.
+func (c *cloner) findRef(name string) (advertisedRef, bool) {
+	for _, ref := range c.refs {
+		if ref.name == name {
+			return ref, true
+		}
+	}
+	return advertisedRef{}, false
+}
+
+// peeledID returns the object the ref points to after peeling tags.
+func (ref advertisedRef) peeledID() odb.ID {
+	if !ref.peeled.IsZero() {
+		return ref.peeled
+	}
+	return ref.id
+}
+
+// fetchPack fetches the wanted objects and their history and stores the
+// pack in the repository as it arrives.
+func (c *cloner) fetchPack(r *Repository, wants []odb.ID) error {
+	db, ok := r.Objects.(*odb.Database)
+	if !ok {
+		return fmt.Errorf("cannot store a pack in %T", r.Objects)
+	}
+	buf := bytes.NewBufferString(pktLine("command=fetch") + c.capabilities() + "0001" + pktLine("ofs-delta\n"))
+	for _, id := range wants {
+		buf.WriteString(pktLine("want " + id.String() + "\n"))
+	}
+	buf.WriteString(pktLine("done\n") + "0000")
+	body, err := c.request("POST", "/git-upload-pack", buf)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	pack, err := newSidebandReader(body)
+	if err != nil {
+		return err
+	}
+	_, err = db.WritePack(pack)
+	return err
+}
+
+// writeRefs records the remote's branches as remote-tracking branches and
+// its tags in packed-refs, configures the remote, and points HEAD at head:
+// a branch, which is created tracking its remote counterpart, or a commit.
+// A bare clone stores the remote's branches as local branches, and a clone
+// of a revision stores no refs besides HEAD.
+func (c *cloner) writeRefs(r *Repository, head advertisedRef, opts CloneOptions) error {
+	message := "clone: from " + c.url
+	fetch := Refspec{Src: "refs/heads/*", Dst: "refs/remotes/" + remoteName + "/*", Force: true}
+	if opts.Bare {
+		fetch.Dst = "refs/heads/*"
+	}
+	err := r.updateConfig(func(f *config.File) error {
+		if err := f.Set("remote."+remoteName+".url", c.url); err != nil {
+			return err
+		}
+		if opts.Bare {
+			return nil
+		}
+		if err := f.Set("remote."+remoteName+".fetch", fetch.String()); err != nil {
+			return err
+		}
+		if branch, ok := strings.CutPrefix(head.target, "refs/heads/"); ok {
+			if err := f.Set("branch."+branch+".remote", remoteName); err != nil {
+				return err
+			}
+			return f.Set("branch."+branch+".merge", head.target)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if opts.Revision == "" {
+		var packed []Ref
+		for _, ref := range c.refs {
+			if ref.name == "HEAD" {
+				continue
+			}
+			name, ok := fetch.Map(ref.name)
+			if !ok {
+				name = ref.name
+			}
+			packed = append(packed, Ref{Name: name, ID: ref.id, Peeled: ref.peeled})
+		}
+		if err := r.addPackedRefs(packed); err != nil {
+			return err
+		}
+	}
+	switch {
+	case head.id.IsZero() || opts.Bare:
+		// HEAD already points to the branch, which is packed.
+		return nil
+	case head.target == "":
+		tx := r.NewRefTransaction()
+		if err := tx.Update(RefUpdate{Name: "HEAD", New: head.id, NoDeref: true, Message: message}); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	default:
+		if err := r.updateRef(head.target, odb.ID{}, head.id, message); err != nil {
+			return err
+		}
+	}
+	remoteHead := c.remoteHead()
+	if opts.Revision != "" || remoteHead.target == "" {
+		return nil
+	}
+	tracking, _ := fetch.Map(remoteHead.target)
+	return r.SetSymbolicRef("refs/remotes/"+remoteName+"/HEAD", tracking, message)
+}
@@ -0,0 +1,327 @@
+package mygit
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// encodePack returns a pack holding every object of a repository, each
+// stored whole.
+func encodePack(t *testing.T, r *Repository) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteString("PACK\x00\x00\x00\x02\x00\x00\x00\x00")
+	count := 0
+	err := r.Objects.Iterate(func(id odb.ID) error {
+		typ, data, err := r.ReadObject(id)
+		if err != nil {
+			return err
+		}
+		size := uint64(len(data))
+		c := byte(typ)<<4 | byte(size&0x0f)
+		for size >>= 4; size > 0; size >>= 7 {
+			buf.WriteByte(c | 0x80)
+			c = byte(size & 0x7f)
+		}
+		buf.WriteByte(c)
+		w := zlib.NewWriter(&buf)
+		w.Write(data)
+		w.Close()
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pack := buf.Bytes()
+	binary.BigEndian.PutUint32(pack[8:], uint32(count))
+	h := r.Hash.New()
+	h.Write(pack)
+	return h.Sum(pack)
+}
+
+// serveRepository serves the objects of a repository over the smart HTTP
+// protocol version 2, advertising a HEAD that points to the branch main
+// at tip and then refs, and returns the URL to clone from.
+func serveRepository(t *testing.T, r *Repository, tip odb.ID, refs ...Ref) string {
+	t.Helper()
+	pack := encodePack(t, r)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			io.WriteString(w, pktLine("version 2\n")+pktLine("object-format="+r.Hash.Name()+"\n")+"0000")
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		switch {
+		case bytes.HasPrefix(body, []byte(pktLine("command=ls-refs\n"))):
+			io.WriteString(w, pktLine(tip.String()+" HEAD symref-target:refs/heads/main\n")+
+				pktLine(tip.String()+" refs/heads/main\n"))
+			for _, ref := range refs {
+				line := ref.ID.String() + " " + ref.Name
+				if !ref.Peeled.IsZero() {
+					line += " peeled:" + ref.Peeled.String()
+				}
+				io.WriteString(w, pktLine(line+"\n"))
+			}
+			io.WriteString(w, "0000")
+		case bytes.HasPrefix(body, []byte(pktLine("command=fetch"))):
+			io.WriteString(w, pktLine("packfile\n"))
+			for rest := pack; len(rest) > 0; {
+				n := min(len(rest), maxPktLine-5)
+				io.WriteString(w, pktLine("\x01"+string(rest[:n])))
+				rest = rest[n:]
+			}
+			io.WriteString(w, "0000")
+		default:
+			http.Error(w, "unknown command", http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestCloneRejectsInvalidPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		tree func(r *Repository, blob odb.ID) odb.ID
+	}{
+		{"parent directory", func(r *Repository, blob odb.ID) odb.ID {
+			sub := writeRawTree(t, r, TreeEntry{Mode: ModeFile, Name: "../../evil_clone", ID: blob})
+			return writeRawTree(t, r, TreeEntry{Mode: ModeTree, Name: "sub", ID: sub})
+		}},
+		{"dot dot", func(r *Repository, blob odb.ID) odb.ID {
+			sub := writeRawTree(t, r, TreeEntry{Mode: ModeFile, Name: "evil_clone", ID: blob})
+			return writeRawTree(t, r, TreeEntry{Mode: ModeTree, Name: "..", ID: sub})
+		}},
+		{"git directory", func(r *Repository, blob odb.ID) odb.ID {
+			hooks := writeRawTree(t, r, TreeEntry{Mode: ModeExecutable, Name: "post-checkout", ID: blob})
+			sub := writeRawTree(t, r, TreeEntry{Mode: ModeTree, Name: "hooks", ID: hooks})
+			return writeRawTree(t, r, TreeEntry{Mode: ModeTree, Name: ".Git", ID: sub})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, _ := initRepo(t, odb.SHA1)
+			blob, err := src.WriteObject(odb.Blob, []byte("#!/bin/sh\necho pwned\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			url := serveRepository(t, src, commitTree(t, src, tt.tree(src, blob)))
+
+			parent := filepath.Join(t.TempDir(), "parent")
+			dir := filepath.Join(parent, "dst")
+			if _, err := Clone(url, dir, CloneOptions{}); !errors.Is(err, ErrInvalidPath) {
+				t.Fatalf("Clone = %v, want ErrInvalidPath", err)
+			}
+			if _, err := os.Lstat(filepath.Join(parent, "evil_clone")); err == nil {
+				t.Error("clone wrote a file outside the destination")
+			}
+			if _, err := os.Lstat(dir); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("failed clone left its destination behind: %v", err)
+			}
+		})
+	}
+}
+
+func TestClone(t *testing.T) {
+	tests := []struct {
+		name string
+		opts CloneOptions
+		// head is the branch HEAD points to, or "" if it is detached at
+		// the commit named by detached.
+		head     string
+		detached string
+		// files are the files checked out, in the working tree and the
+		// index.
+		files []string
+		// refs are the names of the refs created, besides HEAD.
+		refs []string
+	}{
+		{
+			name:  "default",
+			head:  "refs/heads/main",
+			files: []string{"README", "bin/run", "src/lib/code.go"},
+			refs:  []string{"refs/heads/main", "refs/remotes/origin/HEAD", "refs/remotes/origin/main", "refs/remotes/origin/topic", "refs/tags/v1"},
+		},
+		{
+			name:  "branch",
+			opts:  CloneOptions{Branch: "topic"},
+			head:  "refs/heads/topic",
+			files: []string{"README", "bin/run", "src/lib/code.go", "topic"},
+			refs:  []string{"refs/heads/topic", "refs/remotes/origin/HEAD", "refs/remotes/origin/main", "refs/remotes/origin/topic", "refs/tags/v1"},
+		},
+		{
+			name:     "tag",
+			opts:     CloneOptions{Branch: "v1"},
+			detached: "v1",
+			files:    []string{"README"},
+			refs:     []string{"refs/remotes/origin/HEAD", "refs/remotes/origin/main", "refs/remotes/origin/topic", "refs/tags/v1"},
+		},
+		{
+			name:     "revision",
+			opts:     CloneOptions{Revision: "refs/heads/topic"},
+			detached: "topic",
+			files:    []string{"README", "bin/run", "src/lib/code.go", "topic"},
+		},
+		{
+			name: "no checkout",
+			opts: CloneOptions{NoCheckout: true},
+			head: "refs/heads/main",
+			refs: []string{"refs/heads/main", "refs/remotes/origin/HEAD", "refs/remotes/origin/main", "refs/remotes/origin/topic", "refs/tags/v1"},
+		},
+		{
+			name: "bare",
+			opts: CloneOptions{Bare: true},
+			head: "refs/heads/main",
+			refs: []string{"refs/heads/main", "refs/heads/topic", "refs/tags/v1"},
+		},
+	}
+	for _, format := range []*odb.Algorithm{odb.SHA1, odb.SHA256} {
+		src, _ := initRepo(t, format)
+		first := commitTree(t, src, writeTree(t, src, map[string]string{"README": "first\n"}))
+		main := commitTree(t, src, writeTree(t, src, map[string]string{
+			"README": "hello\n", "bin/run": "#!/bin/sh\n", "src/lib/code.go": "package lib\n",
+		}), first)
+		topic := commitTree(t, src, writeTree(t, src, map[string]string{
+			"README": "hello\n", "bin/run": "#!/bin/sh\n", "src/lib/code.go": "package lib\n", "topic": "topic\n",
+		}), main)
+		tag, err := src.WriteObject(odb.Tag, []byte(fmt.Sprintf("object %s\ntype commit\ntag v1\ntagger C O Mitter <committer@example.com> 1112911993 +0000\n\nfirst\n", first)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		url := serveRepository(t, src, main,
+			Ref{Name: "refs/heads/topic", ID: topic},
+			Ref{Name: "refs/tags/v1", ID: tag, Peeled: first},
+		)
+		commits := map[string]odb.ID{"main": main, "topic": topic, "v1": first}
+
+		for _, tt := range tests {
+			t.Run(format.Name()+" "+tt.name, func(t *testing.T) {
+				dir := filepath.Join(t.TempDir(), "clone")
+				r, err := Clone(url, dir, tt.opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer r.Close()
+				if r.Hash != format {
+					t.Errorf("clone uses %s, want %s", r.Hash.Name(), format.Name())
+				}
+
+				target, err := r.ReadSymbolicRef("HEAD")
+				if err != nil || target != tt.head {
+					t.Errorf("HEAD points to %q, %v, want %q", target, err, tt.head)
+				}
+				want := commits[tt.detached]
+				if tt.head != "" {
+					want = commits[strings.TrimPrefix(tt.head, "refs/heads/")]
+				}
+				if head, err := r.ReadRef("HEAD"); err != nil || head != want {
+					t.Errorf("HEAD = %s, %v, want %s", head, err, want)
+				}
+
+				refs, err := r.ListRefs("refs/")
+				if err != nil {
+					t.Fatal(err)
+				}
+				var names []string
+				for _, ref := range refs {
+					names = append(names, ref.Name)
+				}
+				if !slices.Equal(names, tt.refs) {
+					t.Errorf("refs = %q, want %q", names, tt.refs)
+				}
+				if tt.refs != nil && !tt.opts.Bare {
+					if id, err := r.ReadRef("refs/remotes/origin/topic"); err != nil || id != topic {
+						t.Errorf("origin/topic = %s, %v, want %s", id, err, topic)
+					}
+					if target, _ := r.ReadSymbolicRef("refs/remotes/origin/HEAD"); target != "refs/remotes/origin/main" {
+						t.Errorf("origin/HEAD points to %q, want refs/remotes/origin/main", target)
+					}
+				}
+
+				cfg, err := r.Config()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, _ := cfg.Get("remote.origin.url"); got != url {
+					t.Errorf("remote.origin.url = %q, want %q", got, url)
+				}
+				if branch, ok := strings.CutPrefix(tt.head, "refs/heads/"); ok && !tt.opts.Bare {
+					if upstream, err := r.Upstream(branch); err != nil || upstream != "refs/remotes/origin/"+branch {
+						t.Errorf("upstream of %s = %q, %v, want origin/%s", branch, upstream, err, branch)
+					}
+				}
+
+				if tt.opts.Bare {
+					if r.WorkDir != "" {
+						t.Errorf("bare clone has the working tree %s", r.WorkDir)
+					}
+					return
+				}
+				if files := worktreeFiles(t, dir); !slices.Equal(files, tt.files) {
+					t.Errorf("working tree has %q, want %q", files, tt.files)
+				}
+				idx, err := r.ReadIndex()
+				if err != nil {
+					t.Fatal(err)
+				}
+				var staged []string
+				for _, e := range idx.Entries {
+					staged = append(staged, e.Path)
+				}
+				if !slices.Equal(staged, tt.files) {
+					t.Errorf("index has %q, want %q", staged, tt.files)
+				}
+				if tt.files == nil {
+					return
+				}
+				tree, err := r.Peel(want, odb.Tree)
+				if err != nil {
+					t.Fatal(err)
+				}
+				entries, err := r.ReadTreeFiles(tree)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, name := range tt.files {
+					data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+					if err != nil || r.Hash.Sum(odb.Blob, data) != entries[name].ID {
+						t.Errorf("%s = %q, %v, want the content of %s", name, data, err, entries[name].ID)
+					}
+				}
+				st, err := r.Status(StatusOptions{})
+				if err != nil || len(st.Files) != 0 || len(st.Untracked) != 0 {
+					t.Errorf("status after clone = %+v, %v, want clean", st, err)
+				}
+			})
+		}
+	}
+}
+
+func TestCloneIntoNonEmptyDirectory(t *testing.T) {
+	src, _ := initRepo(t, odb.SHA1)
+	url := serveRepository(t, src, commitTree(t, src, writeTree(t, src, map[string]string{"file": "x\n"})))
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "keep"), []byte("mine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Clone(url, dir, CloneOptions{}); !errors.Is(err, ErrDestinationExists) {
+		t.Fatalf("Clone = %v, want ErrDestinationExists", err)
+	}
+	if files := worktreeFiles(t, dir); !slices.Equal(files, []string{"keep"}) {
+		t.Errorf("destination has %q after the failed clone, want only keep", files)
+	}
+}
@@ -0,0 +1,290 @@
+package mygit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+var (
+	// ErrNothingToCommit is returned when a commit would record the same
+	// tree as its parent.
+	ErrNothingToCommit = errors.New("nothing to commit")
+	// ErrEmptyMessage is returned when committing without a message.
+	ErrEmptyMessage = errors.New("empty commit message")
+)
+
+// CommitTree writes a commit object for tree with the given parents and
+// message and returns its name. The author and committer are the
+// configured user, unless overridden by the GIT_AUTHOR_* and
+// GIT_COMMITTER_* environment variables.
+func (r *Repository) CommitTree(tree odb.ID, parents []odb.ID, message string) (odb.ID, error) {
+	author, err := r.identity("AUTHOR")
+	if err != nil {
+		return odb.ID{}, err
+	}
+	committer, err := r.identity("COMMITTER")
+	if err != nil {
+		return odb.ID{}, err
+	}
+	return r.WriteCommit(&Commit{
+		Tree:      tree,
+		Parents:   parents,
+		Author:    author,
+		Committer: committer,
+		Message:   message,
+	})
+}
+
+// WriteCommit stores a commit object after checking that its tree exists,
+// and returns its name.
+func (r *Repository) WriteCommit(c *Commit) (odb.ID, error) {
+	if _, err := r.ReadTree(c.Tree); err != nil {
+		return odb.ID{}, err
+	}
+	return r.WriteObject(odb.Commit, c.Encode())
+}
+
+// Commit is a decoded commit object.
+type Commit struct {
+	Tree      odb.ID
+	Parents   []odb.ID
+	Author    Signature
+	Committer Signature
+	// Encoding names the character encoding of the message if it is not
+	// UTF-8.
+	Encoding string
+	Message  string
+}
+
+// Encode returns the canonical content of the commit object: the tree,
+// parent, author, committer and optional encoding headers, a blank line
+// and the message.
+func (c *Commit) Encode() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "tree %s\n", c.Tree)
+	for _, parent := range c.Parents {
+		fmt.Fprintf(&buf, "parent %s\n", parent)
+	}
+	fmt.Fprintf(&buf, "author %s\n", c.Author)
+	fmt.Fprintf(&buf, "committer %s\n", c.Committer)
+	if c.Encoding != "" {
+		fmt.Fprintf(&buf, "encoding %s\n", c.Encoding)
+	}
+	buf.WriteByte('\n')
+	buf.WriteString(c.Message)
+	return buf.Bytes()
+}
+
+// ParseCommit decodes the content of a commit object. Headers it does not
+// know, such as signatures, are skipped along with their continuation
+// lines.
+func ParseCommit(data []byte, algo *odb.Algorithm) (*Commit, error) {
+	header, message, found := bytes.Cut(data, []byte("\n\n"))
+	if !found {
+		header, message = bytes.TrimSuffix(data, []byte("\n")), nil
+	}
+	c := &Commit{Message: string(message)}
+	for _, line := range strings.Split(string(header), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		var err error
+		switch key {
+		case "tree":
+			c.Tree, err = algo.ParseID(value)
+		case "parent":
+			var parent odb.ID
+			parent, err = algo.ParseID(value)
+			c.Parents = append(c.Parents, parent)
+		case "author":
+			c.Author, err = ParseSignature(value)
+		case "committer":
+			c.Committer, err = ParseSignature(value)
+		case "encoding":
+			c.Encoding = value
+		}
+		if errors.Is(err, ErrCorruptObject) {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrCorruptObject, err)
+		}
+	}
+	if c.Tree.IsZero() {
+		return nil, fmt.Errorf("%w: commit has no tree", ErrCorruptObject)
+	}
+	return c, nil
+}
+
+// ReadCommit returns the decoded commit with the given name.
+func (r *Repository) ReadCommit(id odb.ID) (*Commit, error) {
+	t, data, err := r.ReadObject(id)
+	if err != nil {
+		return nil, err
+	}
+	if t != odb.Commit {
+		return nil, fmt.Errorf("%w: %s is a %s", ErrNotACommit, id, t)
+	}
+	c, err := ParseCommit(data, r.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", id, err)
+	}
+	return c, nil
+}
+
+// reachableCommits returns the commits reachable from the tips by
+// following parents, including the tips.
+func (r *Repository) reachableCommits(tips ...odb.ID) (map[odb.ID]bool, error) {
+	seen := make(map[odb.ID]bool)
+	var queue []odb.ID
+	for _, tip := range tips {
+		id, err := r.Peel(tip, odb.Commit)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, id)
+	}
+	for len(queue) > 0 {
+		id := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		c, err := r.ReadCommit(id)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, c.Parents...)
+	}
+	return seen, nil
+}
+
+// Subject returns the first paragraph of the message joined into one line.
+func (c *Commit) Subject() string {
+	paragraph, _, _ := strings.Cut(strings.TrimLeft(c.Message, "\n"), "\n\n")
+	return strings.Join(strings.Fields(strings.ReplaceAll(paragraph, "\n", " ")), " ")
+}
+
+// CleanupMessage normalizes a commit message as git does for messages that
+// are not edited interactively: trailing whitespace, leading and trailing
+// blank lines and repeated blank lines are removed, and the message ends
+// with a newline. A message without content becomes empty.
+func CleanupMessage(message string) string {
+	var out strings.Builder
+	blank := false
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if line == "" {
+			blank = out.Len() > 0
+			continue
+		}
+		if blank {
+			out.WriteByte('\n')
+			blank = false
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.String()
+}
+
+// CommitOptions configures Repository.Commit.
+type CommitOptions struct {
+	// Amend replaces the current commit by a new commit with the same
+	// parents.
+	Amend bool
+	// AllowEmpty records a commit even if its tree is the same as its
+	// parent's.
+	AllowEmpty bool
+}
+
+// Commit records the staged content of the index as a new commit on the
+// current branch, or on HEAD if it is detached, and returns its name. The
+// message is cleaned up with CleanupMessage; with opts.Amend an empty
+// message reuses the message of the amended commit.
+func (r *Repository) Commit(message string, opts CommitOptions) (odb.ID, error) {
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return odb.ID{}, err
+	}
+	tree, err := r.WriteIndexTree(idx, "")
+	if err != nil {
+		return odb.ID{}, err
+	}
+	ref, err := r.ReadSymbolicRef("HEAD")
+	if err != nil {
+		return odb.ID{}, err
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	head, err := r.ReadRef("HEAD")
+	if err != nil && !errors.Is(err, ErrRefNotFound) {
+		return odb.ID{}, err
+	}
+	var parents []odb.ID
+	var amended *Commit
+	action := "commit"
+	switch {
+	case opts.Amend:
+		if head.IsZero() {
+			return odb.ID{}, fmt.Errorf("%w: nothing to amend on an unborn branch", ErrUnknownRevision)
+		}
+		if amended, err = r.ReadCommit(head); err != nil {
+			return odb.ID{}, err
+		}
+		parents = amended.Parents
+		if CleanupMessage(message) == "" {
+			message = amended.Message
+		}
+		action = "commit (amend)"
+	case head.IsZero():
+		action = "commit (initial)"
+	default:
+		parents = []odb.ID{head}
+	}
+	message = CleanupMessage(message)
+	if message == "" {
+		return odb.ID{}, ErrEmptyMessage
+	}
+	if !opts.AllowEmpty && !opts.Amend {
+		var parentTree odb.ID
+		if len(parents) > 0 {
+			if parentTree, err = r.Peel(parents[0], odb.Tree); err != nil {
+				return odb.ID{}, err
+			}
+		}
+		if tree == parentTree || parentTree.IsZero() && len(idx.Entries) == 0 {
+			return odb.ID{}, ErrNothingToCommit
+		}
+	}
+	author, err := r.identity("AUTHOR")
+	if err != nil {
+		return odb.ID{}, err
+	}
+	committer, err := r.identity("COMMITTER")
+	if err != nil {
+		return odb.ID{}, err
+	}
+	if amended != nil {
+		author = amended.Author
+	}
+	id, err := r.WriteCommit(&Commit{
+		Tree:      tree,
+		Parents:   parents,
+		Author:    author,
+		Committer: committer,
+		Message:   message,
+	})
+	if err != nil {
+		return odb.ID{}, err
+	}
+	subject := (&Commit{Message: message}).Subject()
+	if err := r.updateRef(ref, head, id, action+": "+subject); err != nil {
+		return odb.ID{}, err
+	}
+	return id, nil
+}
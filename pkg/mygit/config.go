@@ -0,0 +1,116 @@
+package mygit
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/config"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// writeRepoConfig writes the core repository settings to the config file.
+// SHA-256 repositories require repositoryformatversion 1 so that older
+// implementations refuse to operate on them. An existing repository keeps
+// its object format, which a nil format selects, and its format version
+// is never lowered.
+func writeRepoConfig(gitDir string, format *odb.Algorithm, bare bool) error {
+	f, err := config.ReadFile(filepath.Join(gitDir, "config"))
+	if err != nil {
+		return err
+	}
+	version := 0
+	if old, ok := f.Get("core.repositoryformatversion"); ok {
+		name, _ := f.Get("extensions.objectformat")
+		existing, err := odb.LookupAlgorithm(name)
+		if err != nil {
+			return err
+		}
+		if format != nil && format != existing {
+			return fmt.Errorf("attempt to reinitialize repository with different hash: %s", existing.Name())
+		}
+		format = existing
+		version, _ = strconv.Atoi(old)
+	}
+	if format == nil {
+		format = odb.SHA1
+	}
+	if format != odb.SHA1 {
+		version = max(version, 1)
+	}
+	settings := [][2]string{
+		{"core.repositoryformatversion", strconv.Itoa(version)},
+		{"core.filemode", "true"},
+		{"core.bare", strconv.FormatBool(bare)},
+	}
+	if format != odb.SHA1 {
+		settings = append(settings, [2]string{"extensions.objectformat", format.Name()})
+	}
+	for _, s := range settings {
+		if err := f.Set(s[0], s[1]); err != nil {
+			return err
+		}
+	}
+	return f.Write()
+}
+
+// ConfigPath returns the location of the configuration file of a scope.
+func (r *Repository) ConfigPath(scope config.Scope) string {
+	switch scope {
+	case config.ScopeSystem:
+		return config.SystemPath()
+	case config.ScopeGlobal:
+		return config.GlobalPath()
+	}
+	return filepath.Join(r.GitDir, "config")
+}
+
+// Config reads the merged system, global and repository configuration.
+func (r *Repository) Config() (*config.Config, error) {
+	ctx := config.Context{GitDir: r.GitDir}
+	if head, err := r.ReadSymbolicRef("HEAD"); err == nil {
+		ctx.Branch = strings.TrimPrefix(head, "refs/heads/")
+	}
+	return config.Load(ctx)
+}
+
+// configValue returns the value of a key, or an empty string if it is not
+// set or the configuration cannot be read.
+func (r *Repository) configValue(key string) string {
+	c, err := r.Config()
+	if err != nil {
+		return ""
+	}
+	value, _ := c.Get(key)
+	return value
+}
+
+// SetConfig sets a key in the repository's config file.
+func (r *Repository) SetConfig(key, value string) error {
+	return r.updateConfig(func(f *config.File) error {
+		return f.Set(key, value)
+	})
+}
+
+// updateConfig applies edit to the repository's config file and writes it
+// back if edit succeeds.
+func (r *Repository) updateConfig(edit func(f *config.File) error) error {
+	f, err := config.ReadFile(r.ConfigPath(config.ScopeLocal))
+	if err != nil {
+		return err
+	}
+	if err := edit(f); err != nil {
+		return err
+	}
+	return f.Write()
+}
+
+// SetIdentity stores the author identity as user.name and user.email in
+// the repository's config file.
+func (r *Repository) SetIdentity(name, email string) error {
+	if err := r.SetConfig("user.name", name); err != nil {
+		return err
+	}
+	return r.SetConfig("user.email", email)
+}
@@ -0,0 +1,143 @@
+package mygit
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/wildmatch"
+)
+
+// ignorePattern is a single line of a gitignore file.
+type ignorePattern struct {
+	re *regexp.Regexp
+	// base is the directory of the file the pattern was read from, with
+	// a trailing slash, or empty for the top level.
+	base     string
+	negate   bool
+	dirOnly  bool
+	basename bool
+}
+
+// Ignore decides which untracked working tree paths are ignored, from
+// .git/info/exclude and the .gitignore file of every directory.
+type Ignore struct {
+	workDir  string
+	patterns []ignorePattern
+	loaded   map[string]bool
+}
+
+// Ignore returns the ignore rules of the working tree. Per-directory
+// .gitignore files are read as paths below them are matched.
+func (r *Repository) Ignore() *Ignore {
+	ig := &Ignore{workDir: r.WorkDir, loaded: make(map[string]bool)}
+	ig.loadFile(filepath.Join(r.GitDir, "info", "exclude"), "")
+	return ig
+}
+
+// loadDir reads the .gitignore file of the slash-separated directory dir
+// once.
+func (ig *Ignore) loadDir(dir string) {
+	if ig.loaded[dir] {
+		return
+	}
+	ig.loaded[dir] = true
+	base := ""
+	if dir != "" {
+		base = dir + "/"
+	}
+	ig.loadFile(filepath.Join(ig.workDir, filepath.FromSlash(dir), ".gitignore"), base)
+}
+
+func (ig *Ignore) loadFile(name, base string) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if p, ok := parseIgnorePattern(scanner.Text(), base); ok {
+			ig.patterns = append(ig.patterns, p)
+		}
+	}
+}
+
+// parseIgnorePattern parses a gitignore line, reporting false for blank
+// lines and comments.
+func parseIgnorePattern(line, base string) (ignorePattern, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are dropped unless escaped.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || line[0] == '#' {
+		return ignorePattern{}, false
+	}
+	p := ignorePattern{base: base}
+	if line[0] == '!' {
+		p.negate = true
+		line = line[1:]
+	} else if line[0] == '\\' && len(line) > 1 && (line[1] == '#' || line[1] == '!') {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignorePattern{}, false
+	}
+	p.basename = !strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	re, err := wildmatch.Compile(line, false)
+	if err != nil {
+		return ignorePattern{}, false
+	}
+	p.re = re
+	return p, true
+}
+
+// Match reports whether the slash-separated path is ignored, either by a
+// pattern matching it or because one of its parent directories is. A nil
+// Ignore ignores nothing.
+func (ig *Ignore) Match(name string, isDir bool) bool {
+	if ig == nil {
+		return false
+	}
+	dir := ""
+	for _, part := range strings.Split(path.Dir(name), "/") {
+		if part == "." {
+			break
+		}
+		ig.loadDir(dir)
+		dir = path.Join(dir, part)
+		if ig.match(dir, true) {
+			return true
+		}
+	}
+	ig.loadDir(dir)
+	return ig.match(name, isDir)
+}
+
+// match applies the patterns to a path whose parents are not ignored. The
+// last matching pattern decides.
+func (ig *Ignore) match(name string, isDir bool) bool {
+	for i := len(ig.patterns) - 1; i >= 0; i-- {
+		p := ig.patterns[i]
+		if p.dirOnly && !isDir || !strings.HasPrefix(name, p.base) {
+			continue
+		}
+		rel := name[len(p.base):]
+		if p.basename {
+			rel = path.Base(rel)
+		}
+		if p.re.MatchString(rel) {
+			return !p.negate
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/index"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// IndexPath returns the path of the index file.
+func (r *Repository) IndexPath() string {
+	return filepath.Join(r.GitDir, "index")
+}
+
+// ReadIndex reads the index. A repository without an index file has an
+// empty index.
+func (r *Repository) ReadIndex() (*index.Index, error) {
+	return index.Read(r.IndexPath(), r.Hash)
+}
+
+// WriteIndex replaces the index file.
+func (r *Repository) WriteIndex(idx *index.Index) error {
+	return idx.Write(r.IndexPath(), r.Hash)
+}
+
+// WriteTree writes tree objects for the staged content of the index and
+// returns the name of the tree for the directory prefix, or of the root
+// tree if prefix is empty.
+func (r *Repository) WriteTree(prefix string) (odb.ID, error) {
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return odb.ID{}, err
+	}
+	return r.WriteIndexTree(idx, prefix)
+}
+
+// WriteIndexTree is like WriteTree for an index that has not been written
+// to disk. Blobs referenced by the index but missing from the object
+// database are stored from the working tree.
+func (r *Repository) WriteIndexTree(idx *index.Index, prefix string) (odb.ID, error) {
+	if idx.Unmerged() {
+		return odb.ID{}, ErrUnmerged
+	}
+	dir := strings.Trim(prefix, "/")
+	if dir != "" {
+		dir += "/"
+	}
+	entries := make([]*index.Entry, 0, len(idx.Entries))
+	for _, e := range idx.Entries {
+		if strings.HasPrefix(e.Path, dir) && !e.IntentToAdd {
+			entries = append(entries, e)
+		}
+	}
+	if dir != "" && len(entries) == 0 {
+		return odb.ID{}, fmt.Errorf("%w: %s", ErrPathNotFound, prefix)
+	}
+	return r.writeIndexTree(entries, dir)
+}
+
+// writeIndexTree writes the tree for dir from the sorted index entries
+// below it.
+func (r *Repository) writeIndexTree(entries []*index.Entry, dir string) (odb.ID, error) {
+	tree := make([]TreeEntry, 0)
+	for i := 0; i < len(entries); {
+		e := entries[i]
+		rest := e.Path[len(dir):]
+		name, _, isDir := strings.Cut(rest, "/")
+		if !isDir {
+			if err := r.ensureBlob(e); err != nil {
+				return odb.ID{}, err
+			}
+			tree = append(tree, TreeEntry{FileMode(e.Mode), name, e.ID})
+			i++
+			continue
+		}
+		// Entries below a directory are contiguous in index order.
+		sub := dir + name + "/"
+		j := i
+		for j < len(entries) && strings.HasPrefix(entries[j].Path, sub) {
+			j++
+		}
+		id, err := r.writeIndexTree(entries[i:j], sub)
+		if err != nil {
+			return odb.ID{}, err
+		}
+		tree = append(tree, TreeEntry{ModeTree, name, id})
+		i = j
+	}
+	SortTree(tree)
+	return r.WriteObject(odb.Tree, EncodeTree(tree))
+}
+
+// ensureBlob stores the blob of an index entry from the working tree if it
+// is not in the object database yet.
+func (r *Repository) ensureBlob(e *index.Entry) error {
+	if FileMode(e.Mode) == ModeGitlink || r.Objects.Has(e.ID) {
+		return nil
+	}
+	data, err := r.readWorktreeFile(e.Path, FileMode(e.Mode))
+	if err != nil {
+		return fmt.Errorf("%w: %s for %s", ErrObjectNotFound, e.ID, e.Path)
+	}
+	if r.Hash.Sum(odb.Blob, data) != e.ID {
+		return fmt.Errorf("%w: %s for %s", ErrObjectNotFound, e.ID, e.Path)
+	}
+	_, err = r.WriteObject(odb.Blob, data)
+	return err
+}
+
+// readWorktreeFile returns the blob content of a working tree path: the
+// link target for symlinks and the file content otherwise.
+func (r *Repository) readWorktreeFile(path string, mode FileMode) ([]byte, error) {
+	full := filepath.Join(r.WorkDir, filepath.FromSlash(path))
+	if mode == ModeSymlink {
+		target, err := os.Readlink(full)
+		return []byte(target), err
+	}
+	return os.ReadFile(full)
+}
@@ -0,0 +1,63 @@
+package mygit
+
+import (
+	"fmt"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// ValidateObject checks that data is well-formed content for an object of
+// type t, as fsck checks it. Blobs are always valid, and tree entries must
+// have names that can be checked out.
+func ValidateObject(t odb.Type, data []byte, algo *odb.Algorithm) error {
+	switch t {
+	case odb.Tree:
+		entries, err := ParseTree(data, algo)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if !validEntryName(e.Name) {
+				return fmt.Errorf("%w: invalid tree entry name %q", ErrCorruptObject, e.Name)
+			}
+		}
+	case odb.Commit:
+		c, err := ParseCommit(data, algo)
+		if err != nil {
+			return err
+		}
+		if c.Author.When.IsZero() || c.Committer.When.IsZero() {
+			return fmt.Errorf("%w: commit is missing author or committer", ErrCorruptObject)
+		}
+	case odb.Tag:
+		_, err := ParseTag(data, algo)
+		return err
+	}
+	return nil
+}
+
+// HashObject validates an object and returns its name, storing it in the
+// object database if write is set.
+func (r *Repository) HashObject(t odb.Type, data []byte, write bool) (odb.ID, error) {
+	if err := ValidateObject(t, data, r.Hash); err != nil {
+		return odb.ID{}, err
+	}
+	if !write {
+		return r.Hash.Sum(t, data), nil
+	}
+	return r.WriteObject(t, data)
+}
+
+// HashObjectLiterally returns the name of an object with a type given by
+// name, storing it loose if write is set. Neither the type, which need not
+// be a known one, nor the content is validated.
+func (r *Repository) HashObjectLiterally(typeName string, data []byte, write bool) (odb.ID, error) {
+	if !write {
+		return r.Hash.SumLiterally(typeName, data), nil
+	}
+	db, ok := r.Objects.(*odb.Database)
+	if !ok {
+		return odb.ID{}, fmt.Errorf("cannot store an object of type %q in %T", typeName, r.Objects)
+	}
+	return db.WriteLiterally(typeName, data)
+}
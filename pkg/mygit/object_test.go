@@ -0,0 +1,84 @@
+package mygit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+func TestValidateObject(t *testing.T) {
+	treeEntry := func(name string) string {
+		return "100644 " + name + "\x00" + string(make([]byte, odb.SHA1.Size()))
+	}
+	const tree = "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n"
+	const who = "A U Thor <author@example.com> 1112904793 +0200\n"
+	valid := map[odb.Type]string{
+		odb.Blob:   "anything",
+		odb.Tree:   treeEntry("file") + treeEntry(".gitignore") + treeEntry("...") + treeEntry(".git.orig"),
+		odb.Commit: tree + "author " + who + "committer " + who + "\nmessage\n",
+		odb.Tag:    "object 4b825dc642cb6eb9a060e54bf8d69288fbee4904\ntype tree\ntag v1\n\nmessage\n",
+	}
+	for typ, data := range valid {
+		if err := ValidateObject(typ, []byte(data), odb.SHA1); err != nil {
+			t.Errorf("ValidateObject(%s, %q): %v", typ, data, err)
+		}
+	}
+
+	invalid := []struct {
+		typ  odb.Type
+		data string
+	}{
+		{odb.Tree, "100644 file"},
+		{odb.Tree, treeEntry("")},
+		{odb.Tree, treeEntry(".")},
+		{odb.Tree, treeEntry("..")},
+		{odb.Tree, treeEntry(".git")},
+		{odb.Tree, treeEntry(".GIT")},
+		{odb.Tree, treeEntry("sub/file")},
+		{odb.Tree, treeEntry("file") + treeEntry("../file")},
+		{odb.Commit, "author " + who},
+		{odb.Commit, "tree xyz\n"},
+		{odb.Commit, tree + "author bad signature\n"},
+		{odb.Commit, tree + "author " + who},
+		{odb.Tag, "type tree\ntag v1\n"},
+	}
+	for _, tt := range invalid {
+		err := ValidateObject(tt.typ, []byte(tt.data), odb.SHA1)
+		if !errors.Is(err, ErrCorruptObject) {
+			t.Errorf("ValidateObject(%s, %q) = %v, want ErrCorruptObject", tt.typ, tt.data, err)
+		} else if n := strings.Count(err.Error(), ErrCorruptObject.Error()); n != 1 {
+			t.Errorf("ValidateObject(%s, %q) error %q names the error %d times", tt.typ, tt.data, err, n)
+		}
+	}
+}
+
+func TestHashObjectLiterally(t *testing.T) {
+	r, _ := initRepo(t, odb.SHA1)
+	tests := []struct {
+		typeName string
+		data     string
+		want     string
+	}{
+		// The names are those git hash-object --literally computes.
+		{"foo", "hi\n", "a6fce8938ab565292c2b14f56f839a7cea21e656"},
+		{"a b", "hi\n", "12560878553cb8678920e27762a090fb26a6d605"},
+		{"", "hi\n", "6fcc64ffb6b4c1734f50a3c02438b5b1b9f1537c"},
+		{"tree", "hi\n", "4c53eae1a663601cdae9d2f9c05def9a8391509c"},
+	}
+	for _, tt := range tests {
+		for _, write := range []bool{false, true} {
+			id, err := r.HashObjectLiterally(tt.typeName, []byte(tt.data), write)
+			if err != nil || id.String() != tt.want {
+				t.Errorf("HashObjectLiterally(%q, %q, write=%t) = %s, %v, want %s", tt.typeName, tt.data, write, id, err, tt.want)
+			}
+			if has := r.Objects.Has(id); has != write {
+				t.Errorf("after HashObjectLiterally(%q, %q, write=%t) the object exists: %t", tt.typeName, tt.data, write, has)
+			}
+		}
+	}
+	if _, err := r.HashObject(odb.Tree, []byte("hi\n"), false); !errors.Is(err, ErrCorruptObject) {
+		t.Errorf("HashObject of a bad tree = %v, want ErrCorruptObject", err)
+	}
+}
@@ -0,0 +1,202 @@
+package mygit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/lockfile"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// packedRefsHeader starts the packed-refs files written here. The traits
+// promise that every annotated tag is followed by a "^<peeled>" line and
+// that refs are sorted by name.
+const packedRefsHeader = "# pack-refs with: peeled fully-peeled sorted \n"
+
+// packedRefsPath returns the location of the packed-refs file.
+func (r *Repository) packedRefsPath() string {
+	return filepath.Join(r.GitDir, "packed-refs")
+}
+
+// readPackedRefs parses the packed-refs file. A missing file has no refs.
+func (r *Repository) readPackedRefs() ([]Ref, error) {
+	file, err := os.Open(r.packedRefsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var refs []Ref
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "^"):
+			if len(refs) == 0 {
+				return nil, fmt.Errorf("packed-refs: peeled line before any ref")
+			}
+			peeled, err := r.Hash.ParseID(line[1:])
+			if err != nil {
+				return nil, fmt.Errorf("packed-refs: %w", err)
+			}
+			refs[len(refs)-1].Peeled = peeled
+			continue
+		}
+		hash, name, found := strings.Cut(line, " ")
+		if !found {
+			return nil, fmt.Errorf("packed-refs: bad line %q", line)
+		}
+		id, err := r.Hash.ParseID(hash)
+		if err != nil {
+			return nil, fmt.Errorf("packed-refs: %w", err)
+		}
+		refs = append(refs, Ref{Name: name, ID: id})
+	}
+	return refs, scanner.Err()
+}
+
+// readPackedRef looks a ref up in the packed-refs file.
+func (r *Repository) readPackedRef(name string) (Ref, error) {
+	refs, err := r.readPackedRefs()
+	if err != nil {
+		return Ref{}, err
+	}
+	for _, ref := range refs {
+		if ref.Name == name {
+			return ref, nil
+		}
+	}
+	return Ref{}, fmt.Errorf("%w: %s", ErrRefNotFound, name)
+}
+
+// writePackedRefs writes refs to a held lock on the packed-refs file,
+// computing the peeled value of annotated tags that lack one.
+func (r *Repository) writePackedRefs(w io.Writer, refs []Ref) error {
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	bw := bufio.NewWriter(w)
+	bw.WriteString(packedRefsHeader)
+	for _, ref := range refs {
+		fmt.Fprintf(bw, "%s %s\n", ref.ID, ref.Name)
+		peeled := ref.Peeled
+		if peeled.IsZero() {
+			if t, _, err := r.ReadObject(ref.ID); err == nil && t == odb.Tag {
+				if peeled, err = r.peelTo(ref.ID, ""); err != nil {
+					return err
+				}
+			}
+		}
+		if !peeled.IsZero() && peeled != ref.ID {
+			fmt.Fprintf(bw, "^%s\n", peeled)
+		}
+	}
+	return bw.Flush()
+}
+
+// PackRefs moves loose refs into the packed-refs file and deletes them.
+// Without all, only tags are packed. Symbolic refs are never packed.
+func (r *Repository) PackRefs(all bool) error {
+	lock, err := lockfile.Create(r.packedRefsPath())
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+	refs, err := r.readPackedRefs()
+	if err != nil {
+		return err
+	}
+	loose, err := r.ListRefs("refs/")
+	if err != nil {
+		return err
+	}
+	packed := make(map[string]int)
+	for i, ref := range refs {
+		packed[ref.Name] = i
+	}
+	pruned := make(map[string]odb.ID)
+	for _, ref := range loose {
+		info, err := os.Lstat(r.refPath(ref.Name))
+		if err != nil || info.IsDir() || ref.Symbolic() || !all && !strings.HasPrefix(ref.Name, "refs/tags/") {
+			continue
+		}
+		if i, ok := packed[ref.Name]; ok {
+			refs[i] = ref
+		} else {
+			refs = append(refs, ref)
+		}
+		pruned[ref.Name] = ref.ID
+	}
+	if err := r.writePackedRefs(lock, refs); err != nil {
+		return err
+	}
+	if err := lock.Commit(); err != nil {
+		return err
+	}
+	for name, id := range pruned {
+		// A ref that a concurrent update locked or changed stays loose.
+		refLock, err := lockfile.Create(r.refPath(name))
+		if err != nil {
+			continue
+		}
+		current, err := r.readRef(name)
+		if err == nil && current.ID == id {
+			os.Remove(r.refPath(name))
+		}
+		refLock.Rollback()
+		r.removeEmptyRefDirs(name)
+	}
+	return nil
+}
+
+// addPackedRefs adds refs to the packed-refs file, replacing packed refs
+// of the same names.
+func (r *Repository) addPackedRefs(refs []Ref) error {
+	lock, err := lockfile.Create(r.packedRefsPath())
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+	existing, err := r.readPackedRefs()
+	if err != nil {
+		return err
+	}
+	added := make(map[string]bool)
+	for _, ref := range refs {
+		added[ref.Name] = true
+	}
+	refs = append([]Ref(nil), refs...)
+	for _, ref := range existing {
+		if !added[ref.Name] {
+			refs = append(refs, ref)
+		}
+	}
+	if err := r.writePackedRefs(lock, refs); err != nil {
+		return err
+	}
+	return lock.Commit()
+}
+
+// removeEmptyRefDirs removes the directories of a deleted ref, and of its
+// reflog, that became empty, up to the refs and logs/refs directories.
+func (r *Repository) removeEmptyRefDirs(name string) {
+	pruneEmptyDirs(filepath.Dir(r.refPath(name)), filepath.Join(r.GitDir, "refs"))
+	pruneEmptyDirs(filepath.Dir(r.reflogPath(name)), filepath.Join(r.GitDir, "logs", "refs"))
+}
+
+// pruneEmptyDirs removes dir and its parents below top while they are
+// empty directories. A ref or reflog file where a directory was, such as
+// refs/heads/a after a/b was renamed to a, is kept.
+func pruneEmptyDirs(dir, top string) {
+	for ; strings.HasPrefix(dir, top+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if !isDir(dir) || os.Remove(dir) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package mygit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxPktLine is the largest pkt-line, including its length prefix.
+const maxPktLine = 65520
+
+// pktLine encodes a string as a pkt-line with a 4-digit hex length prefix.
+func pktLine(s string) string {
+	return fmt.Sprintf("%04x%s", len(s)+4, s)
+}
+
+// pktReader reads pkt-lines from a stream without buffering more than one.
+type pktReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func newPktReader(r io.Reader) *pktReader {
+	return &pktReader{r: bufio.NewReader(r), buf: make([]byte, maxPktLine)}
+}
+
+// next returns the payload of the next pkt-line, which is only valid until
+// the next call, or nil for a flush, delimiter or response-end packet. It
+// returns io.EOF at the end of the stream, and reports an "ERR" line as an
+// error.
+func (p *pktReader) next() ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(p.r, length[:]); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, errors.New("truncated pkt-line in server response")
+	}
+	size, err := strconv.ParseUint(string(length[:]), 16, 16)
+	if err != nil || size == 3 || size > maxPktLine {
+		return nil, fmt.Errorf("bad pkt-line length %q in server response", length[:])
+	}
+	if size < 4 {
+		return nil, nil
+	}
+	payload := p.buf[:size-4]
+	if _, err := io.ReadFull(p.r, payload); err != nil {
+		return nil, errors.New("truncated pkt-line in server response")
+	}
+	if message, ok := bytes.CutPrefix(payload, []byte("ERR ")); ok {
+		return nil, fmt.Errorf("remote error: %s", strings.TrimSpace(string(message)))
+	}
+	return payload, nil
+}
+
+// sidebandReader reads the pack sent on band 1 of the packfile section of
+// a fetch response as it arrives. Progress messages on band 2 are
+// dropped; band 3 reports an error.
+type sidebandReader struct {
+	p *pktReader
+	// data is the unread part of the current band 1 payload.
+	data []byte
+	done bool
+}
+
+// newSidebandReader skips the sections of a fetch response that precede
+// the packfile section.
+func newSidebandReader(r io.Reader) (*sidebandReader, error) {
+	p := newPktReader(r)
+	for {
+		payload, err := p.next()
+		if err == io.EOF {
+			return nil, errors.New("no pack in server response")
+		} else if err != nil {
+			return nil, err
+		}
+		if string(payload) == "packfile\n" {
+			return &sidebandReader{p: p}, nil
+		}
+	}
+}
+
+func (s *sidebandReader) Read(b []byte) (int, error) {
+	for len(s.data) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		payload, err := s.p.next()
+		switch {
+		case err == io.EOF || err == nil && payload == nil:
+			s.done = true
+		case err != nil:
+			return 0, err
+		case len(payload) == 0:
+		case payload[0] == 1:
+			s.data = payload[1:]
+		case payload[0] == 2:
+			// Progress messages are not shown.
+		case payload[0] == 3:
+			return 0, fmt.Errorf("remote error: %s", strings.TrimSpace(string(payload[1:])))
+		default:
+			return 0, fmt.Errorf("bad sideband %d in server response", payload[0])
+		}
+	}
+	n := copy(b, s.data)
+	s.data = s.data[n:]
+	return n, nil
+}
@@ -0,0 +1,340 @@
+package mygit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/internal/lockfile"
+	"github.com/codecrafters-io/git-starter-go/pkg/config"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// ErrReflogEntry is returned for a reflog entry that does not exist, such
+// as main@{5} in a log with three entries.
+var ErrReflogEntry = errors.New("no such reflog entry")
+
+// ReflogEntry is one line of a reflog: a ref changing from Old to New.
+type ReflogEntry struct {
+	Old     odb.ID
+	New     odb.ID
+	Who     Signature
+	Message string
+}
+
+// String formats the entry as a line of a reflog file, without the line
+// break.
+func (e ReflogEntry) String() string {
+	line := fmt.Sprintf("%s %s %s", e.Old, e.New, e.Who)
+	if e.Message != "" {
+		line += "\t" + e.Message
+	}
+	return line
+}
+
+// reflogPath returns the location of the reflog of a ref.
+func (r *Repository) reflogPath(name string) string {
+	return filepath.Join(r.GitDir, "logs", filepath.FromSlash(name))
+}
+
+// HasReflog reports whether a ref has a reflog.
+func (r *Repository) HasReflog(name string) bool {
+	info, err := os.Stat(r.reflogPath(name))
+	return err == nil && !info.IsDir()
+}
+
+// logRefUpdate reports whether updates of a ref are recorded: always if it
+// has a reflog, and otherwise as core.logAllRefUpdates says. It defaults
+// to true outside bare repositories, which logs HEAD, branches,
+// remote-tracking refs and notes; "always" logs every ref.
+func (r *Repository) logRefUpdate(name string) bool {
+	if r.HasReflog(name) {
+		return true
+	}
+	setting := r.configValue("core.logallrefupdates")
+	if setting == "always" {
+		return true
+	}
+	enabled, err := config.ParseBool(setting)
+	if setting == "" || err != nil {
+		bare, _ := config.ParseBool(r.configValue("core.bare"))
+		enabled = !bare
+	}
+	if !enabled {
+		return false
+	}
+	for _, prefix := range []string{"refs/heads/", "refs/remotes/", "refs/notes/"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return name == "HEAD"
+}
+
+// appendReflog adds an entry to the reflog of a ref if its updates are
+// logged. Like git, it collapses whitespace in the message to single
+// spaces.
+func (r *Repository) appendReflog(name string, old, id odb.ID, message string) error {
+	if !r.logRefUpdate(name) {
+		return nil
+	}
+	path := r.reflogPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if old.IsZero() {
+		old = r.Hash.ZeroID()
+	}
+	if id.IsZero() {
+		id = r.Hash.ZeroID()
+	}
+	who, err := r.identity("COMMITTER")
+	if err != nil {
+		who = Signature{When: time.Now()}
+	}
+	entry := ReflogEntry{Old: old, New: id, Who: who, Message: strings.Join(strings.Fields(message), " ")}
+	_, err = fmt.Fprintln(file, entry)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ReadReflog returns the entries of a ref's reflog, oldest first. A ref
+// without a reflog has no entries.
+func (r *Repository) ReadReflog(name string) ([]ReflogEntry, error) {
+	file, err := os.Open(r.reflogPath(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var entries []ReflogEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		entry, err := r.parseReflogEntry(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s reflog: %w", name, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func (r *Repository) parseReflogEntry(line string) (ReflogEntry, error) {
+	header, message, _ := strings.Cut(line, "\t")
+	fields := strings.SplitN(header, " ", 3)
+	if len(fields) != 3 {
+		return ReflogEntry{}, fmt.Errorf("%w: bad reflog line %q", ErrCorruptObject, line)
+	}
+	old, err := r.Hash.ParseID(fields[0])
+	if err != nil {
+		return ReflogEntry{}, err
+	}
+	id, err := r.Hash.ParseID(fields[1])
+	if err != nil {
+		return ReflogEntry{}, err
+	}
+	who, err := ParseSignature(fields[2])
+	if err != nil {
+		return ReflogEntry{}, err
+	}
+	return ReflogEntry{Old: old, New: id, Who: who, Message: message}, nil
+}
+
+// writeReflog replaces a ref's reflog through a lock file.
+func (r *Repository) writeReflog(name string, entries []ReflogEntry) error {
+	path := r.reflogPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	lock, err := lockfile.Create(path)
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+	w := bufio.NewWriter(lock)
+	for _, e := range entries {
+		fmt.Fprintln(w, e)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return lock.Commit()
+}
+
+// ListReflogs returns the names of all refs with a reflog.
+func (r *Repository) ListReflogs() ([]string, error) {
+	var names []string
+	dir := filepath.Join(r.GitDir, "logs")
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	return names, err
+}
+
+// ReflogValue returns the n-th prior value of a ref, where 0 is the value
+// of the newest entry. n may be the number of entries to get the value
+// before the oldest entry, if there was one.
+func (r *Repository) ReflogValue(name string, n int) (odb.ID, error) {
+	entries, err := r.ReadReflog(name)
+	if err != nil {
+		return odb.ID{}, err
+	}
+	switch {
+	case n < len(entries):
+		return entries[len(entries)-1-n].New, nil
+	case n == len(entries) && n > 0 && !entries[0].Old.IsZero():
+		return entries[0].Old, nil
+	}
+	return odb.ID{}, fmt.Errorf("%w: log for '%s' only has %d entries", ErrReflogEntry, name, len(entries))
+}
+
+// ReflogValueAt returns the value a ref had at a time according to its
+// reflog. Before the oldest entry, it is the oldest known value.
+func (r *Repository) ReflogValueAt(name string, at time.Time) (odb.ID, error) {
+	entries, err := r.ReadReflog(name)
+	if err != nil {
+		return odb.ID{}, err
+	}
+	if len(entries) == 0 {
+		return odb.ID{}, fmt.Errorf("%w: log for '%s' is empty", ErrReflogEntry, name)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Who.When.After(at) {
+			return entries[i].New, nil
+		}
+	}
+	if !entries[0].Old.IsZero() {
+		return entries[0].Old, nil
+	}
+	return entries[0].New, nil
+}
+
+// ReflogExpireOptions configures ExpireReflog.
+type ReflogExpireOptions struct {
+	// Expire removes entries older than this time.
+	Expire time.Time
+	// ExpireUnreachable removes older entries whose new value is not
+	// reachable from the current value of the ref.
+	ExpireUnreachable time.Time
+	// Rewrite sets the old value of each entry to the new value of the
+	// entry before it, once others have been removed.
+	Rewrite bool
+	// UpdateRef sets the ref to the new value of the newest remaining
+	// entry if the newest entry was removed.
+	UpdateRef bool
+	DryRun    bool
+}
+
+// ExpireReflog removes old entries from a ref's reflog and returns the
+// number of entries removed.
+func (r *Repository) ExpireReflog(name string, opts ReflogExpireOptions) (int, error) {
+	entries, err := r.ReadReflog(name)
+	if err != nil {
+		return 0, err
+	}
+	var reachable map[odb.ID]bool
+	if tip, err := r.ReadRef(name); err == nil && !opts.ExpireUnreachable.IsZero() {
+		if reachable, err = r.reachableCommits(tip); err != nil {
+			return 0, err
+		}
+	}
+	keep := make([]bool, len(entries))
+	for i, e := range entries {
+		when := e.Who.When
+		keep[i] = !when.Before(opts.Expire) &&
+			(reachable == nil || reachable[e.New] || !when.Before(opts.ExpireUnreachable))
+	}
+	return r.pruneReflog(name, entries, keep, opts)
+}
+
+// DeleteReflogEntries removes the entries of a ref's reflog with the given
+// indexes, where 0 is the newest entry, as in main@{0}.
+func (r *Repository) DeleteReflogEntries(name string, indexes []int, opts ReflogExpireOptions) error {
+	entries, err := r.ReadReflog(name)
+	if err != nil {
+		return err
+	}
+	keep := make([]bool, len(entries))
+	for i := range keep {
+		keep[i] = true
+	}
+	for _, n := range indexes {
+		if n < 0 || n >= len(entries) {
+			return fmt.Errorf("%w: %s@{%d}", ErrReflogEntry, name, n)
+		}
+		keep[len(entries)-1-n] = false
+	}
+	_, err = r.pruneReflog(name, entries, keep, opts)
+	return err
+}
+
+// pruneReflog rewrites a reflog with the entries marked to keep.
+func (r *Repository) pruneReflog(name string, entries []ReflogEntry, keep []bool, opts ReflogExpireOptions) (int, error) {
+	var kept []ReflogEntry
+	for i, e := range entries {
+		if !keep[i] {
+			continue
+		}
+		if opts.Rewrite && len(kept) > 0 {
+			e.Old = kept[len(kept)-1].New
+		}
+		kept = append(kept, e)
+	}
+	removed := len(entries) - len(kept)
+	if removed == 0 || opts.DryRun {
+		return removed, nil
+	}
+	if err := r.writeReflog(name, kept); err != nil {
+		return 0, err
+	}
+	if opts.UpdateRef && len(kept) > 0 && !keep[len(entries)-1] {
+		current, err := r.ReadRef(name)
+		if err != nil {
+			return 0, err
+		}
+		tx := r.NewRefTransaction()
+		u := RefUpdate{Name: name, New: kept[len(kept)-1].New, Old: current, HaveOld: true, NoDeref: true}
+		if err := tx.Update(u); err != nil {
+			return 0, err
+		}
+		// The update must not add an entry to the log it just pruned.
+		tx.noLog = true
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+	return removed, nil
+}
+
+// parseReflogIndex parses the n of name@{n}.
+func parseReflogIndex(spec string) (int, bool) {
+	n, err := strconv.Atoi(spec)
+	return n, err == nil && n >= 0
+}
@@ -0,0 +1,250 @@
+package mygit
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// day is the time of the n-th reflog entry written by updateAt.
+func day(n int) time.Time {
+	return time.Date(2005, 4, 7+n, 22, 13, 13, 0, time.UTC)
+}
+
+// updateAt points a ref at id with a reflog entry dated day(n).
+func updateAt(t *testing.T, r *Repository, name string, id odb.ID, n int, message string) {
+	t.Helper()
+	t.Setenv("GIT_COMMITTER_DATE", day(n).Format(time.RFC3339))
+	if err := commitUpdates(r, RefUpdate{Name: name, New: id, Message: message}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// reflogValues returns the new values of a ref's reflog, oldest first.
+func reflogValues(t *testing.T, r *Repository, name string) []odb.ID {
+	t.Helper()
+	entries, err := r.ReadReflog(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []odb.ID
+	for _, e := range entries {
+		values = append(values, e.New)
+	}
+	return values
+}
+
+func TestReflogRecordsUpdates(t *testing.T) {
+	r, a, b := twoCommits(t)
+	if err := r.SetSymbolicRef("HEAD", "refs/heads/main", ""); err != nil {
+		t.Fatal(err)
+	}
+	updateAt(t, r, "refs/heads/main", a, 0, "commit (initial): a")
+	updateAt(t, r, "refs/heads/main", b, 1, "commit:  two\n\tlines ")
+	updateAt(t, r, "refs/heads/topic", a, 2, "branch: Created from main")
+
+	entries, err := r.ReadReflog("refs/heads/main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero := r.Hash.ZeroID()
+	want := []ReflogEntry{
+		{Old: zero, New: a, Message: "commit (initial): a"},
+		{Old: a, New: b, Message: "commit: two lines"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("main reflog has %d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e.Old != want[i].Old || e.New != want[i].New || e.Message != want[i].Message {
+			t.Errorf("main@{%d} = %s %s %q, want %s %s %q", len(entries)-1-i, e.Old, e.New, e.Message, want[i].Old, want[i].New, want[i].Message)
+		}
+		if e.Who.Name != "C O Mitter" || !e.Who.When.Equal(day(i)) {
+			t.Errorf("main@{%d} was written by %s", len(entries)-1-i, e.Who)
+		}
+	}
+	if got := reflogValues(t, r, "HEAD"); !slices.Equal(got, []odb.ID{a, b}) {
+		t.Errorf("HEAD reflog = %s, want the updates of the current branch", got)
+	}
+	if got := reflogValues(t, r, "refs/heads/topic"); !slices.Equal(got, []odb.ID{a}) {
+		t.Errorf("topic reflog = %s, want %s", got, a)
+	}
+	names, err := r.ListReflogs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"HEAD", "refs/heads/main", "refs/heads/topic"}; !slices.Equal(names, want) {
+		t.Errorf("ListReflogs = %q, want %q", names, want)
+	}
+}
+
+func TestLogRefUpdate(t *testing.T) {
+	tests := []struct {
+		setting string
+		bare    bool
+		logged  []string
+	}{
+		{"", false, []string{"HEAD", "refs/heads/main", "refs/remotes/origin/main", "refs/notes/commits"}},
+		{"", true, nil},
+		{"true", true, []string{"HEAD", "refs/heads/main", "refs/remotes/origin/main", "refs/notes/commits"}},
+		{"false", false, nil},
+		{"always", false, []string{"HEAD", "refs/heads/main", "refs/remotes/origin/main", "refs/notes/commits", "refs/tags/v1", "refs/other"}},
+	}
+	for _, tt := range tests {
+		r, _ := initRepo(t, odb.SHA1)
+		if tt.setting != "" {
+			if err := r.SetConfig("core.logAllRefUpdates", tt.setting); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := r.SetConfig("core.bare", map[bool]string{true: "true", false: "false"}[tt.bare]); err != nil {
+			t.Fatal(err)
+		}
+		var logged []string
+		for _, name := range []string{"HEAD", "refs/heads/main", "refs/remotes/origin/main", "refs/notes/commits", "refs/tags/v1", "refs/other"} {
+			if r.logRefUpdate(name) {
+				logged = append(logged, name)
+			}
+		}
+		if !slices.Equal(logged, tt.logged) {
+			t.Errorf("core.logAllRefUpdates=%q bare=%t: logged %q, want %q", tt.setting, tt.bare, logged, tt.logged)
+		}
+	}
+
+	// A ref that has a reflog keeps it up to date whatever the setting.
+	r, a, b := twoCommits(t)
+	if err := r.SetConfig("core.logAllRefUpdates", "always"); err != nil {
+		t.Fatal(err)
+	}
+	updateAt(t, r, "refs/tags/v1", a, 0, "")
+	if err := r.SetConfig("core.logAllRefUpdates", "false"); err != nil {
+		t.Fatal(err)
+	}
+	updateAt(t, r, "refs/tags/v1", b, 1, "")
+	if got := reflogValues(t, r, "refs/tags/v1"); !slices.Equal(got, []odb.ID{a, b}) {
+		t.Errorf("tag reflog = %s, want both updates", got)
+	}
+}
+
+func TestReflogRevisions(t *testing.T) {
+	r, a, b := twoCommits(t)
+	if err := r.SetSymbolicRef("HEAD", "refs/heads/main", ""); err != nil {
+		t.Fatal(err)
+	}
+	updateAt(t, r, "refs/heads/main", a, 0, "")
+	updateAt(t, r, "refs/heads/main", b, 2, "")
+	updateAt(t, r, "refs/heads/main", a, 4, "")
+
+	tests := []struct {
+		rev  string
+		want odb.ID
+	}{
+		{"main@{0}", a},
+		{"main@{1}", b},
+		{"main@{2}", a},
+		{"refs/heads/main@{1}", b},
+		{"@{1}", b},
+		{"HEAD@{1}", b},
+		{"main@{1}^", a},
+		{"main@{" + day(3).Format("2006-01-02 15:04:05 -0700") + "}", b},
+		{"main@{" + day(1).Format("2006-01-02 15:04:05 -0700") + "}", a},
+		{"main@{1990-01-01}", a},
+		{"main@{now}", a},
+	}
+	for _, tt := range tests {
+		if got, err := r.ResolveRevision(tt.rev); err != nil || got != tt.want {
+			t.Errorf("ResolveRevision(%q) = %s, %v, want %s", tt.rev, got, err, tt.want)
+		}
+	}
+	for _, rev := range []string{"main@{3}", "topic@{0}"} {
+		if got, err := r.ResolveRevision(rev); err == nil {
+			t.Errorf("ResolveRevision(%q) = %s, want an error", rev, got)
+		}
+	}
+	if _, err := r.ReflogValue("refs/heads/main", 3); !errors.Is(err, ErrReflogEntry) {
+		t.Errorf("ReflogValue past the oldest entry = %v, want ErrReflogEntry", err)
+	}
+
+	// Once older entries are gone, the value before the oldest remaining
+	// one is still known.
+	if err := r.DeleteReflogEntries("refs/heads/main", []int{2}, ReflogExpireOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := r.ReflogValue("refs/heads/main", 2); err != nil || got != a {
+		t.Errorf("main@{2} after pruning = %s, %v, want the old value %s", got, err, a)
+	}
+}
+
+func TestExpireReflog(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ReflogExpireOptions
+		// want holds the old and new values of the remaining entries as
+		// indexes into the commits zero, a, b and c.
+		want    [][2]int
+		removed int
+	}{
+		{"nothing old enough", ReflogExpireOptions{Expire: day(0)}, [][2]int{{0, 1}, {1, 2}, {2, 3}, {3, 1}}, 0},
+		{"older entries", ReflogExpireOptions{Expire: day(2)}, [][2]int{{2, 3}, {3, 1}}, 2},
+		{"rewrite", ReflogExpireOptions{Expire: day(1), Rewrite: true}, [][2]int{{1, 2}, {2, 3}, {3, 1}}, 1},
+		{"dry run", ReflogExpireOptions{Expire: day(9), DryRun: true}, [][2]int{{0, 1}, {1, 2}, {2, 3}, {3, 1}}, 4},
+		{"all", ReflogExpireOptions{Expire: day(9)}, nil, 4},
+		// Neither b nor c is an ancestor of a, the current value.
+		{"unreachable", ReflogExpireOptions{ExpireUnreachable: day(9)}, [][2]int{{0, 1}, {3, 1}}, 2},
+		{"unreachable rewritten", ReflogExpireOptions{ExpireUnreachable: day(9), Rewrite: true}, [][2]int{{0, 1}, {1, 1}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, a, b := twoCommits(t)
+			c := commitTree(t, r, writeTree(t, r, map[string]string{"file": "c\n"}), b)
+			commits := []odb.ID{r.Hash.ZeroID(), a, b, c}
+			for i, id := range []odb.ID{a, b, c, a} {
+				updateAt(t, r, "refs/heads/main", id, i, "")
+			}
+			removed, err := r.ExpireReflog("refs/heads/main", tt.opts)
+			if err != nil || removed != tt.removed {
+				t.Errorf("ExpireReflog = %d, %v, want %d", removed, err, tt.removed)
+			}
+			entries, err := r.ReadReflog("refs/heads/main")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got [][2]int
+			for _, e := range entries {
+				got = append(got, [2]int{slices.Index(commits, e.Old), slices.Index(commits, e.New)})
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("remaining entries = %v, want %v", got, tt.want)
+			}
+			if tip, err := r.ReadRef("refs/heads/main"); err != nil || tip != a {
+				t.Errorf("main = %s, %v, want it unchanged at %s", tip, err, a)
+			}
+		})
+	}
+}
+
+func TestDeleteReflogEntries(t *testing.T) {
+	r, a, b := twoCommits(t)
+	for i, id := range []odb.ID{a, b, a} {
+		updateAt(t, r, "refs/heads/main", id, i, "")
+	}
+	if err := r.DeleteReflogEntries("refs/heads/main", []int{3}, ReflogExpireOptions{}); !errors.Is(err, ErrReflogEntry) {
+		t.Errorf("deleting main@{3} = %v, want ErrReflogEntry", err)
+	}
+
+	// Deleting the newest entry with UpdateRef moves the ref back, without
+	// logging the move.
+	opts := ReflogExpireOptions{Rewrite: true, UpdateRef: true}
+	if err := r.DeleteReflogEntries("refs/heads/main", []int{0}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := reflogValues(t, r, "refs/heads/main"); !slices.Equal(got, []odb.ID{a, b}) {
+		t.Errorf("main reflog = %s, want %s %s", got, a, b)
+	}
+	if tip, err := r.ReadRef("refs/heads/main"); err != nil || tip != b {
+		t.Errorf("main = %s, %v, want %s", tip, err, b)
+	}
+}
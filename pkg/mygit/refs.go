@@ -0,0 +1,289 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/lockfile"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+var (
+	// ErrRefChanged is returned when a ref does not have the value an
+	// update expected, because another process changed it.
+	ErrRefChanged = errors.New("ref changed concurrently")
+	// ErrInvalidRefName is returned for a malformed ref name.
+	ErrInvalidRefName = errors.New("invalid ref name")
+	// ErrRefConflict is returned when creating a ref whose name is a
+	// directory of an existing ref, or the other way around.
+	ErrRefConflict = errors.New("ref name conflicts with an existing ref")
+)
+
+// maxSymrefDepth bounds the length of symbolic ref chains.
+const maxSymrefDepth = 5
+
+// Ref is a reference. A symbolic ref names another ref in Target and has
+// the object that ref resolves to in ID.
+type Ref struct {
+	// Name is the full name, such as "HEAD" or "refs/heads/main".
+	Name   string
+	ID     odb.ID
+	Target string
+	// Peeled is the object an annotated tag ref points to after peeling
+	// all tags, if packed-refs records it.
+	Peeled odb.ID
+}
+
+// Symbolic reports whether the ref points to another ref.
+func (ref Ref) Symbolic() bool {
+	return ref.Target != ""
+}
+
+// refPath returns the location of a loose ref.
+func (r *Repository) refPath(name string) string {
+	return filepath.Join(r.GitDir, filepath.FromSlash(name))
+}
+
+// readRef reads a ref without following symbolic refs. ID is zero for a
+// symbolic ref.
+func (r *Repository) readRef(name string) (Ref, error) {
+	path := r.refPath(name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// A directory, or a path below a file, is not a loose ref.
+		if info, statErr := os.Stat(path); statErr != nil || info.IsDir() {
+			return r.readPackedRef(name)
+		}
+		return Ref{}, err
+	}
+	value := strings.TrimSpace(string(data))
+	if target, ok := strings.CutPrefix(value, "ref: "); ok {
+		return Ref{Name: name, Target: target}, nil
+	}
+	id, err := r.Hash.ParseID(value)
+	if err != nil {
+		return Ref{}, fmt.Errorf("%s: %w", name, err)
+	}
+	return Ref{Name: name, ID: id}, nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// ReadRef returns the object a ref points to, following symbolic refs.
+// name is a full ref name such as "HEAD" or "refs/heads/main".
+func (r *Repository) ReadRef(name string) (odb.ID, error) {
+	ref, err := r.ResolveRef(name)
+	if err != nil {
+		return odb.ID{}, err
+	}
+	return ref.ID, nil
+}
+
+// ResolveRef follows symbolic refs from name and returns the ref that
+// holds an object name.
+func (r *Repository) ResolveRef(name string) (Ref, error) {
+	for depth := 0; depth < maxSymrefDepth; depth++ {
+		ref, err := r.readRef(name)
+		if err != nil {
+			return Ref{}, err
+		}
+		if !ref.Symbolic() {
+			return ref, nil
+		}
+		name = ref.Target
+	}
+	return Ref{}, fmt.Errorf("%s: symbolic ref loop", name)
+}
+
+// resolveRefName follows symbolic refs from name and returns the name of
+// the last ref in the chain, which need not exist.
+func (r *Repository) resolveRefName(name string) (string, error) {
+	for depth := 0; depth < maxSymrefDepth; depth++ {
+		ref, err := r.readRef(name)
+		if errors.Is(err, ErrRefNotFound) || err == nil && !ref.Symbolic() {
+			return name, nil
+		} else if err != nil {
+			return "", err
+		}
+		name = ref.Target
+	}
+	return "", fmt.Errorf("%s: symbolic ref loop", name)
+}
+
+// ReadSymbolicRef returns the ref a symbolic ref such as HEAD points to,
+// or the empty string if the ref holds an object name.
+func (r *Repository) ReadSymbolicRef(name string) (string, error) {
+	ref, err := r.readRef(name)
+	if err != nil {
+		return "", err
+	}
+	return ref.Target, nil
+}
+
+// SetSymbolicRef points the symbolic ref name at the ref target. If
+// message is not empty, the change is recorded in name's reflog.
+func (r *Repository) SetSymbolicRef(name, target, message string) error {
+	if err := CheckRefName(name); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(target, "refs/") {
+		return fmt.Errorf("%w: refusing to point %s outside of refs/: %s", ErrInvalidRefName, name, target)
+	}
+	if err := CheckRefName(target); err != nil {
+		return err
+	}
+	path := r.refPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	lock, err := lockfile.Create(path)
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+	old, _ := r.ReadRef(name)
+	if _, err := fmt.Fprintf(lock, "ref: %s\n", target); err != nil {
+		return err
+	}
+	if err := lock.Commit(); err != nil {
+		return err
+	}
+	if id, err := r.ReadRef(target); err == nil && message != "" {
+		return r.appendReflog(name, old, id, message)
+	}
+	return nil
+}
+
+// ListRefs returns the refs whose names start with prefix, loose and
+// packed, sorted by name. Symbolic refs are included with the object
+// they resolve to; dangling ones are skipped.
+func (r *Repository) ListRefs(prefix string) ([]Ref, error) {
+	packed, err := r.readPackedRefs()
+	if err != nil {
+		return nil, err
+	}
+	refs := make(map[string]Ref)
+	for _, ref := range packed {
+		refs[ref.Name] = ref
+	}
+	err = filepath.WalkDir(filepath.Join(r.GitDir, "refs"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(r.GitDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if CheckRefName(name) != nil {
+			return nil
+		}
+		ref, err := r.readRef(name)
+		if err != nil {
+			return err
+		}
+		if p, ok := refs[name]; ok && p.ID == ref.ID {
+			ref.Peeled = p.Peeled
+		}
+		refs[name] = ref
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Ref, 0, len(refs))
+	for name, ref := range refs {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if ref.Symbolic() {
+			target, err := r.ResolveRef(ref.Target)
+			if err != nil {
+				continue
+			}
+			ref.ID, ref.Peeled = target.ID, target.Peeled
+		}
+		list = append(list, ref)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// PeelRef returns the object a ref points to after peeling annotated tags,
+// using the peeled value from packed-refs when there is one.
+func (r *Repository) PeelRef(ref Ref) (odb.ID, error) {
+	if !ref.Peeled.IsZero() {
+		return ref.Peeled, nil
+	}
+	return r.peelTo(ref.ID, "")
+}
+
+// ShortRefName returns the shortest unambiguous name for a full ref name,
+// such as "main" for "refs/heads/main", or "heads/main" if there is also a
+// tag named main. Like git, it keeps the "/HEAD" of remote HEADs.
+func (r *Repository) ShortRefName(name string) string {
+	for i := len(refSearchPath) - 1; i > 0; i-- {
+		prefix, suffix, _ := strings.Cut(refSearchPath[i], "%s")
+		short, ok := strings.CutPrefix(name, prefix)
+		if !ok || suffix != "" || short == "" {
+			continue
+		}
+		ambiguous := false
+		for j, pattern := range refSearchPath {
+			if j == i {
+				continue
+			}
+			if _, err := r.readRef(fmt.Sprintf(pattern, short)); err == nil {
+				ambiguous = true
+				break
+			}
+		}
+		if !ambiguous {
+			return short
+		}
+	}
+	return name
+}
+
+// CheckRefName validates a full ref name with the rules of git
+// check-ref-format. Names outside refs/ must be upper case, like HEAD or
+// FETCH_HEAD.
+func CheckRefName(name string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: %s: %s", ErrInvalidRefName, name, reason)
+	}
+	if name == "" || name == "@" {
+		return invalid("empty or @")
+	}
+	if !strings.HasPrefix(name, "refs/") && strings.Trim(name, "ABCDEFGHIJKLMNOPQRSTUVWXYZ_") != "" {
+		return invalid("not below refs/")
+	}
+	if strings.Contains(name, "..") || strings.Contains(name, "@{") || strings.HasSuffix(name, ".") {
+		return invalid(`contains "..", "@{" or ends with "."`)
+	}
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			return invalid(fmt.Sprintf("contains %q", c))
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if component == "" || strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return invalid("bad path component")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/internal/lockfile"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// RefUpdate is a change to one ref in a RefTransaction.
+type RefUpdate struct {
+	Name string
+	// New is the new value; the zero ID deletes the ref.
+	New odb.ID
+	// Old is compared with the current value when HaveOld is set. The
+	// zero ID requires that the ref does not exist.
+	Old     odb.ID
+	HaveOld bool
+	// Verify only checks Old and leaves the ref unchanged.
+	Verify bool
+	// NoDeref changes a symbolic ref itself instead of the ref it points
+	// to.
+	NoDeref bool
+	// Message is recorded in the reflog.
+	Message string
+}
+
+// RefTransaction updates several refs atomically: either all updates are
+// applied or none is. Every ref is locked before any is changed, so
+// concurrent writers fail instead of overwriting each other's updates.
+type RefTransaction struct {
+	r        *Repository
+	updates  []RefUpdate
+	prepared bool
+	// current holds the value of each updated ref when it was locked.
+	current []odb.ID
+	locks   []*lockfile.File
+	packed  *lockfile.File
+	// noLog skips the reflog entries of the updates.
+	noLog bool
+}
+
+// NewRefTransaction starts an empty transaction.
+func (r *Repository) NewRefTransaction() *RefTransaction {
+	return &RefTransaction{r: r}
+}
+
+// Update adds an update to the transaction.
+func (tx *RefTransaction) Update(u RefUpdate) error {
+	if tx.prepared {
+		return fmt.Errorf("ref transaction is already prepared")
+	}
+	if err := CheckRefName(u.Name); err != nil {
+		return err
+	}
+	if !u.Verify && !u.New.IsZero() && !tx.r.Objects.Has(u.New) {
+		return fmt.Errorf("%w: trying to write ref %s with nonexistent object %s", ErrObjectNotFound, u.Name, u.New)
+	}
+	tx.updates = append(tx.updates, u)
+	return nil
+}
+
+// Prepare locks all refs and checks their old values. After a successful
+// Prepare, Commit cannot fail because of concurrent changes.
+func (tx *RefTransaction) Prepare() error {
+	if tx.prepared {
+		return nil
+	}
+	r := tx.r
+	seen := make(map[string]bool)
+	for i := range tx.updates {
+		u := &tx.updates[i]
+		if !u.NoDeref {
+			name, err := r.resolveRefName(u.Name)
+			if err != nil {
+				return err
+			}
+			u.Name = name
+		}
+		if seen[u.Name] {
+			return fmt.Errorf("multiple updates for ref %s not allowed", u.Name)
+		}
+		seen[u.Name] = true
+	}
+	sort.SliceStable(tx.updates, func(i, j int) bool { return tx.updates[i].Name < tx.updates[j].Name })
+	tx.prepared = true
+	err := tx.lock()
+	if err != nil {
+		tx.Abort()
+	}
+	return err
+}
+
+// lock takes the locks and reads the current values.
+func (tx *RefTransaction) lock() error {
+	r := tx.r
+	deleted := make(map[string]bool)
+	for _, u := range tx.updates {
+		if u.New.IsZero() && !u.Verify {
+			deleted[u.Name] = true
+		}
+	}
+	var existing []Ref
+	listed := false
+	needPacked := false
+	for _, u := range tx.updates {
+		path := r.refPath(u.Name)
+		if !u.Verify && !u.New.IsZero() {
+			if !listed {
+				refs, err := r.ListRefs("")
+				if err != nil {
+					return err
+				}
+				existing, listed = refs, true
+			}
+			if err := checkRefConflict(u.Name, existing, deleted); err != nil {
+				return err
+			}
+			if isDir(path) {
+				// An empty directory left behind by deleted refs, as
+				// checkRefConflict found no refs below it.
+				os.Remove(path)
+			}
+		}
+		var current odb.ID
+		if !u.Verify && !u.New.IsZero() && r.blockedByDeletion(u.Name, deleted) {
+			// A loose ref deleted by this transaction, and already locked
+			// since it sorts first, is in the way of the ref's
+			// directory, as when renaming a to a/b. The ref cannot exist
+			// and cannot be created by others while that lock is held;
+			// Commit locks it once the deleted ref is gone.
+			tx.locks = append(tx.locks, nil)
+		} else {
+			lock, err := lockRef(path)
+			if err != nil {
+				return fmt.Errorf("cannot lock ref %s: %w", u.Name, err)
+			}
+			tx.locks = append(tx.locks, lock)
+			current, err = r.ReadRef(u.Name)
+			if errors.Is(err, ErrRefNotFound) {
+				current = odb.ID{}
+			} else if err != nil {
+				return err
+			}
+		}
+		tx.current = append(tx.current, current)
+		if u.HaveOld && current != u.Old && !(current.IsZero() && u.Old.IsZero()) {
+			switch {
+			case current.IsZero():
+				return fmt.Errorf("%w: %s does not exist but expected %s", ErrRefChanged, u.Name, u.Old)
+			case u.Old.IsZero():
+				return fmt.Errorf("%w: %s already exists", ErrRefChanged, u.Name)
+			}
+			return fmt.Errorf("%w: %s is at %s but expected %s", ErrRefChanged, u.Name, current, u.Old)
+		}
+		if deleted[u.Name] {
+			if _, err := r.readPackedRef(u.Name); err == nil {
+				needPacked = true
+			}
+		}
+	}
+	if needPacked {
+		lock, err := lockfile.Create(r.packedRefsPath())
+		if err != nil {
+			return fmt.Errorf("cannot lock packed-refs: %w", err)
+		}
+		tx.packed = lock
+	}
+	return nil
+}
+
+// lockRef creates the directories of a loose ref and locks it.
+func lockRef(path string) (*lockfile.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return lockfile.Create(path)
+}
+
+// blockedByDeletion reports whether a loose ref in deleted is a directory
+// of the ref name.
+func (r *Repository) blockedByDeletion(name string, deleted map[string]bool) bool {
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if info, err := os.Lstat(r.refPath(dir)); deleted[dir] && err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRefConflict fails if name is a directory of an existing ref or an
+// existing ref is a directory of name, ignoring refs being deleted.
+func checkRefConflict(name string, refs []Ref, deleted map[string]bool) error {
+	for _, ref := range refs {
+		if deleted[ref.Name] {
+			continue
+		}
+		if strings.HasPrefix(name, ref.Name+"/") || strings.HasPrefix(ref.Name, name+"/") {
+			return fmt.Errorf("%w: cannot create %s while %s exists", ErrRefConflict, name, ref.Name)
+		}
+	}
+	return nil
+}
+
+// Commit applies the updates, preparing the transaction first if needed,
+// and records them in the reflogs.
+func (tx *RefTransaction) Commit() error {
+	if err := tx.Prepare(); err != nil {
+		return err
+	}
+	defer tx.Abort()
+	r := tx.r
+	if tx.packed != nil {
+		refs, err := r.readPackedRefs()
+		if err != nil {
+			return err
+		}
+		deleted := make(map[string]bool)
+		for _, u := range tx.updates {
+			deleted[u.Name] = u.New.IsZero() && !u.Verify
+		}
+		kept := refs[:0]
+		for _, ref := range refs {
+			if !deleted[ref.Name] {
+				kept = append(kept, ref)
+			}
+		}
+		if err := r.writePackedRefs(tx.packed, kept); err != nil {
+			return err
+		}
+		if err := tx.packed.Commit(); err != nil {
+			return err
+		}
+	}
+	// Deletions go first, so that they free the paths of refs created
+	// where they were, such as a/b after a.
+	for i, u := range tx.updates {
+		if u.Verify || !u.New.IsZero() {
+			continue
+		}
+		if err := os.Remove(r.refPath(u.Name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		os.Remove(r.reflogPath(u.Name))
+		tx.locks[i].Rollback()
+		r.removeEmptyRefDirs(u.Name)
+	}
+	head, _ := r.ReadSymbolicRef("HEAD")
+	for i, u := range tx.updates {
+		if u.Verify || u.New.IsZero() {
+			continue
+		}
+		if tx.locks[i] == nil {
+			lock, err := lockRef(r.refPath(u.Name))
+			if err != nil {
+				return fmt.Errorf("cannot lock ref %s: %w", u.Name, err)
+			}
+			tx.locks[i] = lock
+		}
+		if _, err := fmt.Fprintf(tx.locks[i], "%s\n", u.New); err != nil {
+			return err
+		}
+		if err := tx.locks[i].Commit(); err != nil {
+			return err
+		}
+		if tx.noLog {
+			continue
+		}
+		if err := r.appendReflog(u.Name, tx.current[i], u.New, u.Message); err != nil {
+			return err
+		}
+		if head == u.Name {
+			if err := r.appendReflog("HEAD", tx.current[i], u.New, u.Message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Abort releases all locks without changing any ref. It is safe to call
+// after Commit.
+func (tx *RefTransaction) Abort() {
+	for _, lock := range tx.locks {
+		if lock != nil {
+			lock.Rollback()
+		}
+	}
+	if tx.packed != nil {
+		tx.packed.Rollback()
+	}
+	// Locking created the directories of refs that did not exist.
+	for _, u := range tx.updates {
+		tx.r.removeEmptyRefDirs(u.Name)
+	}
+}
+
+// updateRef points the ref name at id, or deletes it if id is zero. The
+// update fails with ErrRefChanged unless the ref currently points at old,
+// or does not exist if old is the zero ID.
+func (r *Repository) updateRef(name string, old, id odb.ID, message string) error {
+	tx := r.NewRefTransaction()
+	err := tx.Update(RefUpdate{Name: name, New: id, Old: old, HaveOld: true, NoDeref: true, Message: message})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,188 @@
+package mygit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/internal/lockfile"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// twoCommits returns a repository with two commits, the second a child of
+// the first.
+func twoCommits(t *testing.T) (*Repository, odb.ID, odb.ID) {
+	t.Helper()
+	r, _ := initRepo(t, odb.SHA1)
+	a := commitTree(t, r, writeTree(t, r, map[string]string{"file": "a\n"}))
+	b := commitTree(t, r, writeTree(t, r, map[string]string{"file": "b\n"}), a)
+	return r, a, b
+}
+
+// commitUpdates applies updates in one transaction.
+func commitUpdates(r *Repository, updates ...RefUpdate) error {
+	tx := r.NewRefTransaction()
+	for _, u := range updates {
+		if err := tx.Update(u); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// lockFiles returns the lock files left below the refs directory.
+func lockFiles(t *testing.T, r *Repository) []string {
+	t.Helper()
+	var locks []string
+	filepath.WalkDir(filepath.Join(r.GitDir, "refs"), func(name string, d os.DirEntry, err error) error {
+		if err == nil && strings.HasSuffix(name, ".lock") {
+			locks = append(locks, name)
+		}
+		return nil
+	})
+	return locks
+}
+
+func TestRefTransaction(t *testing.T) {
+	r, a, b := twoCommits(t)
+	err := commitUpdates(r,
+		RefUpdate{Name: "refs/heads/main", New: a, Message: "create main"},
+		RefUpdate{Name: "refs/heads/dir/topic", New: b, Old: odb.ID{}, HaveOld: true, Message: "create topic"},
+		RefUpdate{Name: "refs/tags/v1", New: a},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]odb.ID{"refs/heads/main": a, "refs/heads/dir/topic": b, "refs/tags/v1": a} {
+		if got, err := r.ReadRef(name); err != nil || got != want {
+			t.Errorf("%s = %s, %v, want %s", name, got, err, want)
+		}
+	}
+	entries, err := r.ReadReflog("refs/heads/dir/topic")
+	if err != nil || len(entries) != 1 || entries[0].New != b || entries[0].Message != "create topic" {
+		t.Errorf("reflog of refs/heads/dir/topic = %v, %v", entries, err)
+	}
+
+	err = commitUpdates(r,
+		RefUpdate{Name: "refs/heads/main", New: b, Old: a, HaveOld: true},
+		RefUpdate{Name: "refs/heads/dir/topic", Old: b, HaveOld: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.ReadRef("refs/heads/main"); got != b {
+		t.Errorf("refs/heads/main = %s, want %s", got, b)
+	}
+	if _, err := r.ReadRef("refs/heads/dir/topic"); !errors.Is(err, ErrRefNotFound) {
+		t.Errorf("deleted ref: %v, want ErrRefNotFound", err)
+	}
+	if r.HasReflog("refs/heads/dir/topic") {
+		t.Error("deleted ref kept its reflog")
+	}
+	if isDir(filepath.Join(r.GitDir, "refs", "heads", "dir")) {
+		t.Error("deleting the last ref below refs/heads/dir left the directory")
+	}
+}
+
+func TestRefTransactionIsAtomic(t *testing.T) {
+	tests := []struct {
+		name   string
+		update RefUpdate
+		setup  func(r *Repository)
+		want   error
+	}{
+		{"wrong old value", RefUpdate{Name: "refs/heads/main", Old: odb.ID{}, HaveOld: true}, nil, ErrRefChanged},
+		{"directory of a ref", RefUpdate{Name: "refs/heads/dir"}, nil, ErrRefConflict},
+		{"below a ref", RefUpdate{Name: "refs/heads/main/sub"}, nil, ErrRefConflict},
+		{"below a packed ref", RefUpdate{Name: "refs/tags/v1/sub"}, func(r *Repository) {
+			if err := r.PackRefs(true); err != nil {
+				t.Fatal(err)
+			}
+		}, ErrRefConflict},
+		{"locked ref", RefUpdate{Name: "refs/heads/other"}, func(r *Repository) {
+			if err := os.WriteFile(filepath.Join(r.GitDir, "refs", "heads", "other.lock"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, lockfile.ErrLocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, a, b := twoCommits(t)
+			refs := map[string]odb.ID{"refs/heads/main": a, "refs/heads/dir/topic": a, "refs/tags/v1": a}
+			for name, id := range refs {
+				if err := commitUpdates(r, RefUpdate{Name: name, New: id}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.setup != nil {
+				tt.setup(r)
+			}
+			locksBefore := len(lockFiles(t, r))
+			u := tt.update
+			u.New = b
+			err := commitUpdates(r, RefUpdate{Name: "refs/heads/new", New: b}, u, RefUpdate{Name: "refs/tags/v1", Old: a, HaveOld: true, Verify: true})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Commit = %v, want %v", err, tt.want)
+			}
+			for name, id := range refs {
+				if got, err := r.ReadRef(name); err != nil || got != id {
+					t.Errorf("%s = %s, %v after a failed transaction, want %s", name, got, err, id)
+				}
+				if strings.HasPrefix(name, "refs/heads/") && !r.HasReflog(name) {
+					t.Errorf("%s lost its reflog", name)
+				}
+			}
+			if _, err := r.ReadRef("refs/heads/new"); !errors.Is(err, ErrRefNotFound) {
+				t.Errorf("refs/heads/new was created by a failed transaction: %v", err)
+			}
+			if locks := lockFiles(t, r); len(locks) != locksBefore {
+				t.Errorf("failed transaction left lock files %q", locks)
+			}
+		})
+	}
+}
+
+func TestRefTransactionUpdateErrors(t *testing.T) {
+	r, a, _ := twoCommits(t)
+	tx := r.NewRefTransaction()
+	if err := tx.Update(RefUpdate{Name: "refs/heads/bad..name", New: a}); !errors.Is(err, ErrInvalidRefName) {
+		t.Errorf("invalid name: %v, want ErrInvalidRefName", err)
+	}
+	missing := r.Hash.Sum(odb.Blob, []byte("missing"))
+	if err := tx.Update(RefUpdate{Name: "refs/heads/main", New: missing}); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("missing object: %v, want ErrObjectNotFound", err)
+	}
+	err := commitUpdates(r, RefUpdate{Name: "refs/heads/main", New: a}, RefUpdate{Name: "refs/heads/main", New: a})
+	if err == nil {
+		t.Error("two updates of one ref succeeded")
+	}
+}
+
+func TestRefTransactionReplacesDirectory(t *testing.T) {
+	// A ref can take the place of a ref deleted in the same transaction
+	// that is in the way, and the other way around.
+	for _, names := range [][2]string{{"refs/heads/a", "refs/heads/a/b"}, {"refs/heads/a/b", "refs/heads/a"}} {
+		r, a, b := twoCommits(t)
+		if err := commitUpdates(r, RefUpdate{Name: names[0], New: a}); err != nil {
+			t.Fatal(err)
+		}
+		err := commitUpdates(r,
+			RefUpdate{Name: names[0], Old: a, HaveOld: true},
+			RefUpdate{Name: names[1], New: b, Old: odb.ID{}, HaveOld: true},
+		)
+		if err != nil {
+			t.Fatalf("replacing %s with %s: %v", names[0], names[1], err)
+		}
+		if got, err := r.ReadRef(names[1]); err != nil || got != b {
+			t.Errorf("%s = %s, %v, want %s", names[1], got, err, b)
+		}
+		if !r.HasReflog(names[1]) {
+			t.Errorf("%s has no reflog", names[1])
+		}
+		if locks := lockFiles(t, r); len(locks) != 0 {
+			t.Errorf("transaction left lock files %q", locks)
+		}
+	}
+}
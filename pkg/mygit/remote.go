@@ -0,0 +1,110 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/config"
+)
+
+// ErrInvalidRefspec is returned for a malformed refspec.
+var ErrInvalidRefspec = errors.New("invalid refspec")
+
+// Refspec maps refs of a remote to local refs, as in
+// "+refs/heads/*:refs/remotes/origin/*". Src and Dst may each contain one
+// "*", which matches any sequence of characters.
+type Refspec struct {
+	Src, Dst string
+	// Force allows updates that are not fast-forwards.
+	Force bool
+}
+
+// ParseRefspec parses a refspec of the form [+]<src>[:<dst>].
+func ParseRefspec(s string) (Refspec, error) {
+	var spec Refspec
+	spec.Force = strings.HasPrefix(s, "+")
+	spec.Src, spec.Dst, _ = strings.Cut(strings.TrimPrefix(s, "+"), ":")
+	srcGlob, dstGlob := strings.Count(spec.Src, "*"), strings.Count(spec.Dst, "*")
+	if srcGlob > 1 || dstGlob > 1 || spec.Dst != "" && srcGlob != dstGlob {
+		return Refspec{}, fmt.Errorf("%w: %s", ErrInvalidRefspec, s)
+	}
+	return spec, nil
+}
+
+// String formats the refspec as ParseRefspec accepts it.
+func (spec Refspec) String() string {
+	s := spec.Src
+	if spec.Force {
+		s = "+" + s
+	}
+	if spec.Dst != "" {
+		s += ":" + spec.Dst
+	}
+	return s
+}
+
+// Map returns the local ref a remote ref is stored in, if the refspec
+// matches it.
+func (spec Refspec) Map(src string) (string, bool) {
+	return mapRefPattern(spec.Src, spec.Dst, src)
+}
+
+// Reverse returns the remote ref stored in a local ref, if the refspec
+// matches it.
+func (spec Refspec) Reverse(dst string) (string, bool) {
+	if spec.Dst == "" {
+		return "", false
+	}
+	return mapRefPattern(spec.Dst, spec.Src, dst)
+}
+
+// mapRefPattern matches name against from and substitutes the part matched
+// by "*" into to.
+func mapRefPattern(from, to, name string) (string, bool) {
+	prefix, suffix, glob := strings.Cut(from, "*")
+	if !glob {
+		return to, name == from
+	}
+	if len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	return strings.Replace(to, "*", name[len(prefix):len(name)-len(suffix)], 1), true
+}
+
+// Remotes returns the names of the configured remotes in the order they
+// first appear in the configuration.
+func (r *Repository) Remotes() ([]string, error) {
+	c, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, e := range c.Entries() {
+		section, name, _, err := config.SplitKey(e.Key)
+		if err != nil || section != "remote" || name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// FetchRefspecs returns the remote.<name>.fetch refspecs of a remote.
+func (r *Repository) FetchRefspecs(remote string) ([]Refspec, error) {
+	c, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+	var specs []Refspec
+	for _, value := range c.GetAll("remote." + remote + ".fetch") {
+		spec, err := ParseRefspec(value)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
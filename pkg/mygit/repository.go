@@ -0,0 +1,199 @@
+// Package mygit implements git repository operations as a library.
+//
+// Functions and methods report failures as errors instead of exiting, so
+// they can be used from long-running programs. Errors can be matched with
+// errors.Is against the sentinel values below.
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/config"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+var (
+	// ErrObjectNotFound is returned when an object does not exist.
+	ErrObjectNotFound = odb.ErrNotFound
+	// ErrCorruptObject is returned when an object cannot be decoded.
+	ErrCorruptObject = odb.ErrCorrupt
+	// ErrNotATree is returned when a tree was expected.
+	ErrNotATree = errors.New("not a tree")
+	// ErrNotACommit is returned when a commit was expected.
+	ErrNotACommit = errors.New("not a commit")
+	// ErrRefNotFound is returned when a ref does not exist.
+	ErrRefNotFound = errors.New("ref not found")
+	// ErrUnknownRevision is returned when a revision cannot be resolved.
+	ErrUnknownRevision = errors.New("unknown revision")
+	// ErrAmbiguousObject is returned when an abbreviated object name
+	// matches more than one object.
+	ErrAmbiguousObject = errors.New("ambiguous object name")
+	// ErrPathNotFound is returned when a path does not exist in a tree.
+	ErrPathNotFound = errors.New("path not found")
+	// ErrUnmerged is returned when the index has unresolved conflicts.
+	ErrUnmerged = errors.New("index has unmerged entries")
+	// ErrNotARepository is returned when no repository exists.
+	ErrNotARepository = errors.New("not a git repository")
+	// ErrIdentityUnknown is returned when committing without a
+	// configured user name and email.
+	ErrIdentityUnknown = errors.New("author identity unknown")
+)
+
+// Repository is a git repository.
+type Repository struct {
+	// WorkDir is the root of the working tree. It is empty for a bare
+	// repository.
+	WorkDir string
+	// GitDir is the repository's .git directory, or the repository
+	// itself if it is bare.
+	GitDir string
+	// Hash is the object format of the repository.
+	Hash *odb.Algorithm
+	// Objects is the object database.
+	Objects odb.Store
+}
+
+// InitOptions configures Init.
+type InitOptions struct {
+	// ObjectFormat is the hash algorithm; nil selects SHA-1, or keeps the
+	// format of a repository being reinitialized.
+	ObjectFormat *odb.Algorithm
+	// InitialBranch is the branch HEAD points to in a new repository. If
+	// empty, init.defaultBranch is used, or else "main".
+	InitialBranch string
+	// Bare creates a repository without a working tree: dir itself is the
+	// git directory.
+	Bare bool
+}
+
+// Init creates a repository in dir, or reinitializes an existing one.
+func Init(dir string, opts InitOptions) (*Repository, error) {
+	branch, err := initialBranch(opts.InitialBranch)
+	if err != nil {
+		return nil, err
+	}
+	gitDir := filepath.Join(dir, ".git")
+	if opts.Bare {
+		gitDir = dir
+	}
+	for _, sub := range []string{"objects", "refs"} {
+		if err := os.MkdirAll(filepath.Join(gitDir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	// Reinitializing keeps the current branch.
+	headPath := filepath.Join(gitDir, "HEAD")
+	if _, err := os.Stat(headPath); os.IsNotExist(err) {
+		head := []byte("ref: refs/heads/" + branch + "\n")
+		if err := os.WriteFile(headPath, head, 0644); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeRepoConfig(gitDir, opts.ObjectFormat, opts.Bare); err != nil {
+		return nil, err
+	}
+	if opts.Bare {
+		return OpenBare(dir)
+	}
+	return Open(dir)
+}
+
+// initialBranch returns the name of the first branch of a new repository:
+// name if it is set, or else init.defaultBranch from the global and system
+// configuration, or else "main".
+func initialBranch(name string) (string, error) {
+	if name == "" {
+		name = "main"
+		if c, err := config.Load(config.Context{}); err == nil {
+			if value, ok := c.Get("init.defaultbranch"); ok && value != "" {
+				name = value
+			}
+		}
+	}
+	if err := CheckBranchName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// Open opens the repository whose working tree is dir.
+func Open(dir string) (*Repository, error) {
+	gitDir := filepath.Join(dir, ".git")
+	if info, err := os.Stat(gitDir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrNotARepository, dir)
+	}
+	return openGitDir(dir, gitDir)
+}
+
+// OpenBare opens the bare repository dir.
+func OpenBare(dir string) (*Repository, error) {
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotARepository, dir)
+	}
+	return openGitDir("", dir)
+}
+
+// openGitDir opens the repository stored in gitDir with the working tree
+// workDir.
+func openGitDir(workDir, gitDir string) (*Repository, error) {
+	r := &Repository{WorkDir: workDir, GitDir: gitDir}
+	// Extensions are only read from the repository's own config file, and
+	// before the object format is known HEAD cannot be parsed to evaluate
+	// conditional includes.
+	local, err := config.ReadFile(filepath.Join(gitDir, "config"))
+	if err != nil {
+		return nil, err
+	}
+	objectFormat, _ := local.Get("extensions.objectformat")
+	format, err := odb.LookupAlgorithm(objectFormat)
+	if err != nil {
+		return nil, err
+	}
+	r.Hash = format
+	db, err := odb.Open(filepath.Join(gitDir, "objects"), format)
+	if err != nil {
+		return nil, err
+	}
+	r.Objects = db
+	return r, nil
+}
+
+// Discover opens the repository containing dir, searching dir and then
+// each of its parent directories for a .git directory.
+func Discover(dir string) (*Repository, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if info, err := os.Stat(filepath.Join(abs, ".git")); err == nil && info.IsDir() {
+			return Open(abs)
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return nil, fmt.Errorf("%w: %s", ErrNotARepository, dir)
+		}
+		abs = parent
+	}
+}
+
+// Close releases resources held by the object database.
+func (r *Repository) Close() error {
+	if db, ok := r.Objects.(*odb.Database); ok {
+		return db.Close()
+	}
+	return nil
+}
+
+// ReadObject returns the type and content of an object.
+func (r *Repository) ReadObject(id odb.ID) (odb.Type, []byte, error) {
+	return r.Objects.Read(id)
+}
+
+// WriteObject stores an object and returns its name.
+func (r *Repository) WriteObject(t odb.Type, data []byte) (odb.ID, error) {
+	return r.Objects.Write(t, data)
+}
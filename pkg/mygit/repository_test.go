@@ -0,0 +1,150 @@
+package mygit
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// initRepo creates a repository in a temporary directory, isolated from
+// the user's global configuration.
+func initRepo(t *testing.T, format *odb.Algorithm) (*Repository, string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "A U Thor")
+	t.Setenv("GIT_AUTHOR_EMAIL", "author@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "C O Mitter")
+	t.Setenv("GIT_COMMITTER_EMAIL", "committer@example.com")
+	dir := t.TempDir()
+	r, err := Init(dir, InitOptions{ObjectFormat: format})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r, dir
+}
+
+// writeTree stores the trees for a set of files, keyed by slash-separated
+// path, and returns the name of the top-level one.
+func writeTree(t *testing.T, r *Repository, files map[string]string) odb.ID {
+	t.Helper()
+	subdirs := make(map[string]map[string]string)
+	var entries []TreeEntry
+	for name, content := range files {
+		if dir, rest, found := strings.Cut(name, "/"); found {
+			if subdirs[dir] == nil {
+				subdirs[dir] = make(map[string]string)
+			}
+			subdirs[dir][rest] = content
+			continue
+		}
+		id, err := r.WriteObject(odb.Blob, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, TreeEntry{Mode: ModeFile, Name: name, ID: id})
+	}
+	for dir, files := range subdirs {
+		entries = append(entries, TreeEntry{Mode: ModeTree, Name: dir, ID: writeTree(t, r, files)})
+	}
+	SortTree(entries)
+	return writeRawTree(t, r, entries...)
+}
+
+// writeRawTree stores a tree with the given entries as they are, without
+// checking or sorting them.
+func writeRawTree(t *testing.T, r *Repository, entries ...TreeEntry) odb.ID {
+	t.Helper()
+	id, err := r.WriteObject(odb.Tree, EncodeTree(entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// commitTree stores a commit of a tree with the given parents.
+func commitTree(t *testing.T, r *Repository, tree odb.ID, parents ...odb.ID) odb.ID {
+	t.Helper()
+	id, err := r.CommitTree(tree, parents, "commit\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// worktreeFiles returns the paths of the files in a working tree, apart
+// from the repository.
+func worktreeFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, name)
+		switch {
+		case d.IsDir() && d.Name() == ".git":
+			return filepath.SkipDir
+		case !d.IsDir():
+			files = append(files, path.Clean(filepath.ToSlash(rel)))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestInitObjectFormat(t *testing.T) {
+	for _, format := range []*odb.Algorithm{odb.SHA1, odb.SHA256} {
+		t.Run(format.Name(), func(t *testing.T) {
+			r, dir := initRepo(t, format)
+			id, err := r.WriteObject(odb.Blob, []byte("hello\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := format.Sum(odb.Blob, []byte("hello\n")); id != want {
+				t.Errorf("WriteObject = %s, want %s", id, want)
+			}
+
+			r2, err := Open(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r2.Close()
+			if r2.Hash != format {
+				t.Errorf("reopened repository uses %s, want %s", r2.Hash.Name(), format.Name())
+			}
+			if _, data, err := r2.ReadObject(id); err != nil || string(data) != "hello\n" {
+				t.Errorf("ReadObject(%s) = %q, %v", id, data, err)
+			}
+		})
+	}
+}
+
+func TestReinitKeepsObjectFormat(t *testing.T) {
+	_, dir := initRepo(t, odb.SHA256)
+	r, err := Init(dir, InitOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.Hash != odb.SHA256 {
+		t.Errorf("reinitialized repository uses %s, want sha256", r.Hash.Name())
+	}
+	if v := r.configValue("core.repositoryformatversion"); v != "1" {
+		t.Errorf("core.repositoryformatversion = %q, want 1", v)
+	}
+	if _, err := Init(dir, InitOptions{ObjectFormat: odb.SHA1}); err == nil {
+		t.Error("reinitializing with a different object format succeeded")
+	}
+}
@@ -0,0 +1,325 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// refSearchPath lists the places a short ref name is looked up, in order.
+var refSearchPath = []string{
+	"%s",
+	"refs/%s",
+	"refs/tags/%s",
+	"refs/heads/%s",
+	"refs/remotes/%s",
+	"refs/remotes/%s/HEAD",
+}
+
+// ResolveRevision returns the object named by rev. It accepts full and
+// unique abbreviated object names, ref names such as HEAD, main or
+// tags/v1.0, reflog entries such as main@{1}, @{2} or HEAD@{yesterday},
+// and the suffixes <rev>^<n>, <rev>~<n>, <rev>^{<type>}, <rev>^{} and
+// <rev>:<path>.
+func (r *Repository) ResolveRevision(rev string) (odb.ID, error) {
+	base, path, hasPath := cutPath(rev)
+	if hasPath && base == "" {
+		return odb.ID{}, fmt.Errorf("%w: %s: index paths are not supported", ErrUnknownRevision, rev)
+	}
+	// Suffixes start after a reflog selector, which may contain ^ or ~.
+	start := 0
+	if at := strings.Index(base, "@{"); at >= 0 {
+		if closing := strings.IndexByte(base[at:], '}'); closing >= 0 {
+			start = at + closing + 1
+		}
+	}
+	end := strings.IndexAny(base[start:], "^~")
+	if end < 0 {
+		end = len(base)
+	} else {
+		end += start
+	}
+	id, err := r.resolveName(base[:end])
+	if err != nil {
+		return odb.ID{}, err
+	}
+	for suffix := base[end:]; suffix != ""; {
+		op := suffix[0]
+		suffix = suffix[1:]
+		if op == '^' && strings.HasPrefix(suffix, "{") {
+			closing := strings.IndexByte(suffix, '}')
+			if closing < 0 {
+				return odb.ID{}, fmt.Errorf("%w: %s", ErrUnknownRevision, rev)
+			}
+			if id, err = r.peelTo(id, suffix[1:closing]); err != nil {
+				return odb.ID{}, err
+			}
+			suffix = suffix[closing+1:]
+			continue
+		}
+		digits := len(suffix) - len(strings.TrimLeft(suffix, "0123456789"))
+		n := 1
+		if digits > 0 {
+			if n, err = strconv.Atoi(suffix[:digits]); err != nil {
+				return odb.ID{}, fmt.Errorf("%w: %s", ErrUnknownRevision, rev)
+			}
+			suffix = suffix[digits:]
+		}
+		if op == '^' {
+			id, err = r.nthParent(id, n)
+		} else {
+			for i := 0; i < n && err == nil; i++ {
+				id, err = r.nthParent(id, 1)
+			}
+		}
+		if err != nil {
+			return odb.ID{}, fmt.Errorf("%s: %w", rev, err)
+		}
+	}
+	if !hasPath {
+		return id, nil
+	}
+	tree, err := r.Peel(id, odb.Tree)
+	if err != nil {
+		return odb.ID{}, err
+	}
+	if path == "" {
+		return tree, nil
+	}
+	entry, err := r.LookupPath(tree, path)
+	if err != nil {
+		return odb.ID{}, fmt.Errorf("%s: %w", rev, err)
+	}
+	return entry.ID, nil
+}
+
+// cutPath splits "<rev>:<path>" at the first colon outside of braces, as
+// the dates of reflog selectors such as main@{2024-01-01 10:00:00} contain
+// colons.
+func cutPath(rev string) (string, string, bool) {
+	depth := 0
+	for i := 0; i < len(rev); i++ {
+		switch rev[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+		case ':':
+			if depth == 0 {
+				return rev[:i], rev[i+1:], true
+			}
+		}
+	}
+	return rev, "", false
+}
+
+// resolveName resolves an object name, ref name or reflog entry without
+// suffixes.
+func (r *Repository) resolveName(name string) (odb.ID, error) {
+	if name == "" {
+		return odb.ID{}, fmt.Errorf("%w: empty name", ErrUnknownRevision)
+	}
+	if ref, spec, ok := strings.Cut(name, "@{"); ok && strings.HasSuffix(spec, "}") {
+		return r.resolveReflog(ref, strings.TrimSuffix(spec, "}"))
+	}
+	if name == "@" {
+		name = "HEAD"
+	}
+	if id, err := r.Hash.ParseID(name); err == nil {
+		return id, nil
+	}
+	for _, pattern := range refSearchPath {
+		id, err := r.ReadRef(fmt.Sprintf(pattern, name))
+		if err == nil {
+			return id, nil
+		} else if !errors.Is(err, ErrRefNotFound) {
+			return odb.ID{}, err
+		}
+	}
+	if len(name) >= odb.MinPrefix && len(name) <= r.Hash.Size()*2 {
+		if matches, err := odb.FindPrefix(r.Objects, name); err == nil {
+			switch len(matches) {
+			case 1:
+				return matches[0], nil
+			case 0:
+			default:
+				return odb.ID{}, fmt.Errorf("%w: %s matches %d objects", ErrAmbiguousObject, name, len(matches))
+			}
+		}
+	}
+	return odb.ID{}, fmt.Errorf("%w: %s", ErrUnknownRevision, name)
+}
+
+// resolveReflog implements <ref>@{<n>} and <ref>@{<date>}. An empty ref
+// is the current branch, or HEAD if it is detached.
+func (r *Repository) resolveReflog(name, spec string) (odb.ID, error) {
+	full := "HEAD"
+	if name == "" {
+		if branch, err := r.ReadSymbolicRef("HEAD"); err == nil && branch != "" {
+			full = branch
+		}
+	} else {
+		var err error
+		if full, err = r.ExpandRefName(name); err != nil {
+			return odb.ID{}, err
+		}
+	}
+	if n, ok := parseReflogIndex(spec); ok {
+		return r.ReflogValue(full, n)
+	}
+	at, err := ParseApproxDate(spec, time.Now())
+	if err != nil {
+		return odb.ID{}, fmt.Errorf("%w: %s@{%s}", ErrUnknownRevision, name, spec)
+	}
+	return r.ReflogValueAt(full, at)
+}
+
+// ExpandRefName returns the full name of the first existing ref that a
+// short name such as main or origin/main refers to.
+func (r *Repository) ExpandRefName(name string) (string, error) {
+	if name == "@" {
+		name = "HEAD"
+	}
+	for _, pattern := range refSearchPath {
+		full := fmt.Sprintf(pattern, name)
+		if _, err := r.readRef(full); err == nil {
+			return full, nil
+		} else if !errors.Is(err, ErrRefNotFound) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownRevision, name)
+}
+
+// nthParent returns the n-th parent of a commit; the 0th is the commit.
+func (r *Repository) nthParent(id odb.ID, n int) (odb.ID, error) {
+	id, err := r.Peel(id, odb.Commit)
+	if err != nil {
+		return odb.ID{}, err
+	}
+	if n == 0 {
+		return id, nil
+	}
+	c, err := r.ReadCommit(id)
+	if err != nil {
+		return odb.ID{}, err
+	}
+	if n > len(c.Parents) {
+		return odb.ID{}, fmt.Errorf("%w: %s has no parent %d", ErrUnknownRevision, id, n)
+	}
+	return c.Parents[n-1], nil
+}
+
+// peelTo implements the ^{<type>} suffix; an empty type peels tags.
+func (r *Repository) peelTo(id odb.ID, typeName string) (odb.ID, error) {
+	if typeName == "" {
+		for {
+			t, data, err := r.ReadObject(id)
+			if err != nil {
+				return odb.ID{}, err
+			}
+			if t != odb.Tag {
+				return id, nil
+			}
+			target, err := tagTarget(data, r.Hash)
+			if err != nil {
+				return odb.ID{}, fmt.Errorf("%s: %w", id, err)
+			}
+			id = target
+		}
+	}
+	t, err := odb.ParseType(typeName)
+	if err != nil {
+		return odb.ID{}, fmt.Errorf("%w: ^{%s}", ErrUnknownRevision, typeName)
+	}
+	return r.Peel(id, t)
+}
+
+// Peel follows tags, and commits when a tree is wanted, until it reaches
+// an object of type want.
+func (r *Repository) Peel(id odb.ID, want odb.Type) (odb.ID, error) {
+	for {
+		t, data, err := r.ReadObject(id)
+		if err != nil {
+			return odb.ID{}, err
+		}
+		switch {
+		case t == want:
+			return id, nil
+		case t == odb.Tag:
+			target, err := tagTarget(data, r.Hash)
+			if err != nil {
+				return odb.ID{}, fmt.Errorf("%s: %w", id, err)
+			}
+			id = target
+		case t == odb.Commit && want == odb.Tree:
+			c, err := ParseCommit(data, r.Hash)
+			if err != nil {
+				return odb.ID{}, fmt.Errorf("%s: %w", id, err)
+			}
+			id = c.Tree
+		case want == odb.Tree:
+			return odb.ID{}, fmt.Errorf("%w: %s is a %s", ErrNotATree, id, t)
+		case want == odb.Commit:
+			return odb.ID{}, fmt.Errorf("%w: %s is a %s", ErrNotACommit, id, t)
+		default:
+			return odb.ID{}, fmt.Errorf("%w: %s is a %s, not a %s", ErrUnknownRevision, id, t, want)
+		}
+	}
+}
+
+// tagTarget returns the object a tag points to.
+func tagTarget(data []byte, algo *odb.Algorithm) (odb.ID, error) {
+	tag, err := ParseTag(data, algo)
+	if err != nil {
+		return odb.ID{}, err
+	}
+	return tag.Object, nil
+}
+
+// LookupPath returns the entry at a slash-separated path below tree.
+func (r *Repository) LookupPath(tree odb.ID, path string) (TreeEntry, error) {
+	entry := TreeEntry{Mode: ModeTree, ID: tree}
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if entry.Mode != ModeTree {
+			return TreeEntry{}, fmt.Errorf("%w: %s", ErrPathNotFound, path)
+		}
+		entries, err := r.ReadTree(entry.ID)
+		if err != nil {
+			return TreeEntry{}, err
+		}
+		found := false
+		for _, e := range entries {
+			if e.Name == name {
+				entry, found = e, true
+				break
+			}
+		}
+		if !found {
+			return TreeEntry{}, fmt.Errorf("%w: %s", ErrPathNotFound, path)
+		}
+	}
+	return entry, nil
+}
+
+// Abbreviate returns the shortest prefix of id, at least min hex digits
+// long, that names no other object.
+func (r *Repository) Abbreviate(id odb.ID, min int) string {
+	hash := id.String()
+	if min < odb.MinPrefix {
+		min = odb.MinPrefix
+	}
+	for n := min; n < len(hash); n++ {
+		matches, err := odb.FindPrefix(r.Objects, hash[:n])
+		if err == nil && len(matches) <= 1 {
+			return hash[:n]
+		}
+	}
+	return hash
+}
@@ -0,0 +1,178 @@
+package mygit
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature is the identity and time recorded for the author or committer
+// of a commit.
+type Signature struct {
+	Name  string
+	Email string
+	// When is the time, in the time zone of the person.
+	When time.Time
+}
+
+// String formats the signature as it appears in objects and reflogs:
+// "Name <email> <epoch seconds> <+hhmm>".
+func (s Signature) String() string {
+	return fmt.Sprintf("%s <%s> %d %s", s.Name, s.Email, s.When.Unix(), s.When.Format("-0700"))
+}
+
+// ParseSignature decodes a signature formatted as by Signature.String.
+func ParseSignature(s string) (Signature, error) {
+	open := strings.IndexByte(s, '<')
+	closing := strings.LastIndexByte(s, '>')
+	if open < 0 || closing < open {
+		return Signature{}, fmt.Errorf("%w: bad signature %q", ErrCorruptObject, s)
+	}
+	when, err := parseRawDate(strings.TrimSpace(s[closing+1:]))
+	if err != nil {
+		return Signature{}, fmt.Errorf("%w: bad signature %q", ErrCorruptObject, s)
+	}
+	return Signature{
+		Name:  strings.TrimSpace(s[:open]),
+		Email: s[open+1 : closing],
+		When:  when,
+	}, nil
+}
+
+// parseRawDate parses git's internal date format, "<epoch> <+hhmm>".
+func parseRawDate(s string) (time.Time, error) {
+	seconds, zone, _ := strings.Cut(strings.TrimPrefix(s, "@"), " ")
+	epoch, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc := time.UTC
+	if zone != "" {
+		if loc, err = parseZone(zone); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Unix(epoch, 0).In(loc), nil
+}
+
+// parseZone parses a "+hhmm" time zone offset.
+func parseZone(zone string) (*time.Location, error) {
+	if len(zone) != 5 || zone[0] != '+' && zone[0] != '-' {
+		return nil, fmt.Errorf("bad time zone %q", zone)
+	}
+	hhmm, err := strconv.Atoi(zone[1:])
+	if err != nil {
+		return nil, fmt.Errorf("bad time zone %q", zone)
+	}
+	offset := (hhmm/100*60 + hhmm%100) * 60
+	if zone[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone("", offset), nil
+}
+
+// dateLayouts are the formats accepted for GIT_AUTHOR_DATE and
+// GIT_COMMITTER_DATE besides the raw format: RFC 2822, and ISO 8601 with
+// the date also written as 2006.01.02, 01/02/2006 or 02.01.2006 and the
+// time zone, if any, as Z, +hhmm or +hh:mm, attached or after a space.
+// Fractional seconds are accepted and ignored by time.Parse.
+var dateLayouts = func() []string {
+	layouts := []string{
+		time.RFC1123Z,
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		"2 Jan 2006 15:04:05 -0700",
+	}
+	for _, date := range []string{"2006-01-02T", "2006-01-02 ", "2006.01.02 ", "01/02/2006 ", "02.01.2006 "} {
+		for _, zone := range []string{"", "Z0700", "Z07:00", " Z0700", " Z07:00"} {
+			layouts = append(layouts, date+"15:04:05"+zone)
+		}
+	}
+	return layouts
+}()
+
+// ParseDate parses a date in git's raw format ("<epoch> <+hhmm>", optionally
+// prefixed by @), RFC 2822 or ISO 8601. Dates without a time zone are in
+// local time.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := parseRawDate(s); err == nil {
+		return t, nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date format: %s", s)
+}
+
+// approxUnits are the units of relative dates such as "2 weeks ago".
+var approxUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+	"month":  30 * 24 * time.Hour,
+	"year":   365 * 24 * time.Hour,
+}
+
+// ParseApproxDate parses the dates accepted in revisions such as
+// main@{yesterday}: "now", "yesterday", relative dates like "3 days ago"
+// or "1.week.ago", and the absolute dates of ParseDate and "2006-01-02".
+func ParseApproxDate(s string, now time.Time) (time.Time, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "now":
+		return now, nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	}
+	if t, err := ParseDate(s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	fields := strings.Fields(strings.ReplaceAll(s, ".", " "))
+	if len(fields) == 3 && fields[2] == "ago" {
+		n, err := strconv.Atoi(fields[0])
+		unit, ok := approxUnits[strings.TrimSuffix(fields[1], "s")]
+		if err == nil && ok {
+			return now.Add(-time.Duration(n) * unit), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date format: %s", s)
+}
+
+// identity returns the signature of the author or committer, role being
+// "AUTHOR" or "COMMITTER". The GIT_<role>_NAME, GIT_<role>_EMAIL and
+// GIT_<role>_DATE environment variables override the configured user and
+// the current time.
+func (r *Repository) identity(role string) (Signature, error) {
+	lower := strings.ToLower(role)
+	name := firstNonEmpty(os.Getenv("GIT_"+role+"_NAME"), r.configValue(lower+".name"), r.configValue("user.name"))
+	email := firstNonEmpty(os.Getenv("GIT_"+role+"_EMAIL"), r.configValue(lower+".email"), r.configValue("user.email"), os.Getenv("EMAIL"))
+	if name == "" || email == "" {
+		return Signature{}, ErrIdentityUnknown
+	}
+	when := time.Now()
+	if date := os.Getenv("GIT_" + role + "_DATE"); date != "" {
+		var err error
+		if when, err = ParseDate(date); err != nil {
+			return Signature{}, err
+		}
+	}
+	return Signature{Name: name, Email: email, When: when}, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package mygit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	// All of these are 2005-04-07 22:13:13 +0200, as git parses them.
+	for _, s := range []string{
+		"1112904793 +0200",
+		"@1112904793 +0200",
+		"Thu, 07 Apr 2005 22:13:13 +0200",
+		"Thu, 7 Apr 2005 22:13:13 +0200",
+		"7 Apr 2005 22:13:13 +0200",
+		"2005-04-07T22:13:13 +0200",
+		"2005-04-07T22:13:13+0200",
+		"2005-04-07T22:13:13+02:00",
+		"2005-04-07 22:13:13 +0200",
+		"2005-04-07 22:13:13+0200",
+		"2005-04-07T22:13:13.019 +0200",
+		"2005.04.07 22:13:13 +0200",
+		"04/07/2005 22:13:13 +0200",
+		"07.04.2005 22:13:13 +0200",
+	} {
+		got, err := ParseDate(s)
+		if err != nil {
+			t.Errorf("ParseDate(%q): %v", s, err)
+			continue
+		}
+		if _, offset := got.Zone(); got.Unix() != 1112904793 || offset != 2*60*60 {
+			t.Errorf("ParseDate(%q) = %s", s, got)
+		}
+	}
+
+	got, err := ParseDate("2005-04-07T22:13:13Z")
+	if err != nil || got.Unix() != 1112911993 || got.Format("-0700") != "+0000" {
+		t.Errorf("ParseDate with zone Z = %s, %v", got, err)
+	}
+	got, err = ParseDate("2005-04-07 22:13:13")
+	if want := time.Date(2005, 4, 7, 22, 13, 13, 0, time.Local); err != nil || !got.Equal(want) {
+		t.Errorf("ParseDate without zone = %s, %v, want %s", got, err, want)
+	}
+	for _, s := range []string{"", "yesterday", "2005-04-07", "2005-13-07 22:13:13 +0200", "1112904793 +02"} {
+		if got, err := ParseDate(s); err == nil {
+			t.Errorf("ParseDate(%q) = %s, want an error", s, got)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package mygit
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/index"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// Status codes of a changed file, as printed by status --short.
+const (
+	StatusUnmodified  = ' '
+	StatusModified    = 'M'
+	StatusTypeChanged = 'T'
+	StatusAdded       = 'A'
+	StatusDeleted     = 'D'
+	StatusUnmerged    = 'U'
+)
+
+// FileStatus is a tracked path that differs between HEAD, the index and
+// the working tree.
+type FileStatus struct {
+	Path string
+	// Staged is the change from HEAD to the index, and Unstaged the
+	// change from the index to the working tree. For unmerged paths they
+	// describe the two sides of the conflict, as in git status --short.
+	Staged, Unstaged byte
+	// HeadMode, IndexMode and WorktreeMode are zero where the path does
+	// not exist.
+	HeadMode, IndexMode, WorktreeMode FileMode
+	HeadID, IndexID                   odb.ID
+	// Stages holds the conflict entries of unmerged paths by stage 1-3.
+	Stages [4]*index.Entry
+}
+
+// Unmerged reports whether the path has conflicts.
+func (f FileStatus) Unmerged() bool {
+	return f.Stages != [4]*index.Entry{}
+}
+
+// Untracked file listing modes for StatusOptions.
+const (
+	// UntrackedNormal shows untracked directories as a whole.
+	UntrackedNormal = iota
+	// UntrackedAll shows each file in untracked directories.
+	UntrackedAll
+	// UntrackedNo shows no untracked files.
+	UntrackedNo
+)
+
+// StatusOptions configures Status.
+type StatusOptions struct {
+	// Paths limits the result to repository-relative paths and the files
+	// below them.
+	Paths     []string
+	Untracked int
+	Ignored   bool
+}
+
+// Status is the state of the working tree relative to the index and HEAD.
+type Status struct {
+	// Branch is the current branch, or empty if HEAD is detached.
+	Branch string
+	// Head is the current commit, or the zero ID on an unborn branch.
+	Head odb.ID
+	// Files lists changed tracked paths in path order.
+	Files []FileStatus
+	// Untracked and Ignored list files, and directories with a trailing
+	// slash, in path order.
+	Untracked []string
+	Ignored   []string
+}
+
+// Clean reports whether the index and working tree match HEAD, ignoring
+// untracked files.
+func (s *Status) Clean() bool {
+	return len(s.Files) == 0
+}
+
+// Status compares HEAD, the index and the working tree. Files whose stat
+// information matches the index are not read, and the index is updated
+// with the stat information of files found to be unchanged.
+func (r *Repository) Status(opts StatusOptions) (*Status, error) {
+	st := &Status{}
+	branch, err := r.ReadSymbolicRef("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	st.Branch = branch
+	head, err := r.ReadRef("HEAD")
+	if err == nil {
+		st.Head = head
+	} else if !errors.Is(err, ErrRefNotFound) {
+		return nil, err
+	}
+	tree, err := r.headTree()
+	if err != nil {
+		return nil, err
+	}
+	headFiles, err := r.ReadTreeFiles(tree)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	specs := opts.Paths
+	if len(specs) == 0 {
+		specs = []string{""}
+	}
+	refreshed := false
+	files := make(map[string]*FileStatus)
+	for _, e := range idx.Entries {
+		if inPathspec(e.Path, specs) < 0 {
+			continue
+		}
+		f := files[e.Path]
+		if f == nil {
+			f = &FileStatus{Path: e.Path, Staged: StatusUnmodified, Unstaged: StatusUnmodified}
+			files[e.Path] = f
+		}
+		if e.Stage != 0 {
+			f.Stages[e.Stage] = e
+			continue
+		}
+		f.IndexMode, f.IndexID = FileMode(e.Mode), e.ID
+		if h, ok := headFiles[e.Path]; !ok {
+			f.Staged = StatusAdded
+		} else {
+			f.HeadMode, f.HeadID = h.Mode, h.ID
+			f.Staged = changeStatus(h.Mode, h.ID, f.IndexMode, f.IndexID)
+		}
+		unstaged, updated, err := r.worktreeStatus(idx, e, f)
+		if err != nil {
+			return nil, err
+		}
+		f.Unstaged = unstaged
+		refreshed = refreshed || updated
+	}
+	for name, h := range headFiles {
+		if inPathspec(name, specs) < 0 {
+			continue
+		}
+		if f := files[name]; f != nil {
+			f.HeadMode, f.HeadID = h.Mode, h.ID
+		} else {
+			files[name] = &FileStatus{Path: name, Staged: StatusDeleted, Unstaged: StatusUnmodified, HeadMode: h.Mode, HeadID: h.ID}
+		}
+	}
+	for _, f := range files {
+		if f.Unmerged() {
+			f.Staged, f.Unstaged = conflictStatus(f.Stages)
+			if info, err := os.Lstat(r.worktreePath(f.Path)); err == nil {
+				f.WorktreeMode = FileMode(index.FileMode(info))
+			}
+		}
+		if f.Staged != StatusUnmodified || f.Unstaged != StatusUnmodified {
+			st.Files = append(st.Files, *f)
+		}
+	}
+	sort.Slice(st.Files, func(i, j int) bool { return st.Files[i].Path < st.Files[j].Path })
+	if refreshed {
+		// Saving refreshed stat information is an optimization; another
+		// process holding the index lock is not an error.
+		_ = r.WriteIndex(idx)
+	}
+	if opts.Untracked != UntrackedNo || opts.Ignored {
+		if err := r.untracked(st, idx, r.Ignore(), "", specs, opts); err != nil {
+			return nil, err
+		}
+		sort.Strings(st.Untracked)
+		sort.Strings(st.Ignored)
+	}
+	return st, nil
+}
+
+// changeStatus returns the status code of a change between two versions of
+// a file.
+func changeStatus(oldMode FileMode, oldID odb.ID, newMode FileMode, newID odb.ID) byte {
+	switch {
+	case oldMode&0170000 != newMode&0170000:
+		return StatusTypeChanged
+	case oldMode != newMode || oldID != newID:
+		return StatusModified
+	}
+	return StatusUnmodified
+}
+
+// worktreeStatus compares the working tree file of an index entry with the
+// entry. It refreshes the entry's stat information if the file's content
+// is unchanged and reports whether it did.
+func (r *Repository) worktreeStatus(idx *index.Index, e *index.Entry, f *FileStatus) (byte, bool, error) {
+	info, err := os.Lstat(r.worktreePath(e.Path))
+	if err == nil && unpopulatedSubmodule(e, info, r.worktreePath(e.Path)) {
+		f.WorktreeMode = ModeGitlink
+		return StatusUnmodified, false, nil
+	}
+	if errors.Is(err, fs.ErrNotExist) || err == nil && info.IsDir() && !isRepository(r.worktreePath(e.Path)) {
+		return StatusDeleted, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	f.WorktreeMode = FileMode(index.FileMode(info))
+	if idx.UpToDate(e, info) {
+		return StatusUnmodified, false, nil
+	}
+	mode, id, err := r.hashWorktreeFile(e.Path, info, false)
+	if err != nil {
+		return 0, false, err
+	}
+	status := changeStatus(f.IndexMode, e.ID, mode, id)
+	if status != StatusUnmodified || mode == ModeGitlink {
+		return status, false, nil
+	}
+	e.SetStat(info)
+	return status, true, nil
+}
+
+// conflictStatus returns the two-letter status code of an unmerged path
+// from the stages present: base (1), ours (2) and theirs (3).
+func conflictStatus(stages [4]*index.Entry) (byte, byte) {
+	base, ours, theirs := stages[1] != nil, stages[2] != nil, stages[3] != nil
+	switch {
+	case base && ours && theirs:
+		return 'U', 'U'
+	case base && ours:
+		return 'U', 'D'
+	case base && theirs:
+		return 'D', 'U'
+	case ours && theirs:
+		return 'A', 'A'
+	case ours:
+		return 'A', 'U'
+	case theirs:
+		return 'U', 'A'
+	}
+	return 'D', 'D'
+}
+
+// isTracked reports whether the index has entries, in any stage, for a
+// path.
+func isTracked(idx *index.Index, name string) bool {
+	i := sort.Search(len(idx.Entries), func(i int) bool { return idx.Entries[i].Path >= name })
+	return i < len(idx.Entries) && idx.Entries[i].Path == name
+}
+
+// hasTracked reports whether the index has entries below dir.
+func hasTracked(idx *index.Index, dir string) bool {
+	prefix := dir + "/"
+	i := sort.Search(len(idx.Entries), func(i int) bool { return idx.Entries[i].Path >= prefix })
+	return i < len(idx.Entries) && strings.HasPrefix(idx.Entries[i].Path, prefix)
+}
+
+// untracked adds the untracked and ignored files below dir to st.
+// Directories without tracked files are listed as a whole unless
+// opts.Untracked is UntrackedAll.
+func (r *Repository) untracked(st *Status, idx *index.Index, ig *Ignore, dir string, specs []string, opts StatusOptions) error {
+	entries, err := os.ReadDir(r.worktreePath(dir))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if dir != "" {
+			name = dir + "/" + name
+		}
+		if entry.Name() == ".git" || isTracked(idx, name) {
+			continue
+		}
+		// Descend towards the requested paths.
+		if inPathspec(name, specs) < 0 {
+			if entry.IsDir() && leadsTo(name, specs) {
+				if err := r.untracked(st, idx, ig, name, specs, opts); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if entry.IsDir() && hasTracked(idx, name) {
+			if err := r.untracked(st, idx, ig, name, specs, opts); err != nil {
+				return err
+			}
+			continue
+		}
+		ignored := ig.Match(name, entry.IsDir())
+		switch {
+		case !entry.IsDir() || isRepository(r.worktreePath(name)):
+			if entry.IsDir() {
+				name += "/"
+			}
+			st.add(name, ignored, opts)
+		case ignored && opts.Untracked != UntrackedAll:
+			st.add(name+"/", true, opts)
+		default:
+			if err := r.untrackedDir(st, ig, name, ignored, opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// untrackedDir adds the files of a directory without tracked files to st.
+func (r *Repository) untrackedDir(st *Status, ig *Ignore, dir string, ignored bool, opts StatusOptions) error {
+	if ignored {
+		ig = nil
+	}
+	var untracked, ignoredFiles []string
+	err := r.walkWorktree(dir, ig, true, func(name string, info fs.FileInfo, isIgnored bool) error {
+		if info.IsDir() {
+			if isIgnored && opts.Untracked == UntrackedAll {
+				return r.walkWorktree(name, nil, false, func(name string, info fs.FileInfo, _ bool) error {
+					ignoredFiles = append(ignoredFiles, name)
+					return nil
+				})
+			}
+			name += "/"
+		}
+		if isIgnored || ignored {
+			ignoredFiles = append(ignoredFiles, name)
+		} else {
+			untracked = append(untracked, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if opts.Untracked == UntrackedAll {
+		for _, name := range untracked {
+			st.add(name, false, opts)
+		}
+		for _, name := range ignoredFiles {
+			st.add(name, true, opts)
+		}
+		return nil
+	}
+	if len(untracked) > 0 {
+		st.add(dir+"/", false, opts)
+		for _, name := range ignoredFiles {
+			st.add(name, true, opts)
+		}
+	} else if len(ignoredFiles) > 0 {
+		st.add(dir+"/", true, opts)
+	}
+	return nil
+}
+
+func (st *Status) add(name string, ignored bool, opts StatusOptions) {
+	if ignored && opts.Ignored {
+		st.Ignored = append(st.Ignored, name)
+	} else if !ignored && opts.Untracked != UntrackedNo {
+		st.Untracked = append(st.Untracked, name)
+	}
+}
+
+// leadsTo reports whether dir is a parent directory of one of the paths.
+func leadsTo(dir string, paths []string) bool {
+	for _, p := range paths {
+		if strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package mygit
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// Tag is a decoded annotated tag object.
+type Tag struct {
+	Object  odb.ID
+	Type    odb.Type
+	Name    string
+	Tagger  string
+	Message string
+}
+
+// ParseTag decodes the content of a tag object.
+func ParseTag(data []byte, algo *odb.Algorithm) (*Tag, error) {
+	header, message, found := bytes.Cut(data, []byte("\n\n"))
+	if !found {
+		header, message = bytes.TrimSuffix(data, []byte("\n")), nil
+	}
+	t := &Tag{Message: string(message)}
+	for _, line := range strings.Split(string(header), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		var err error
+		switch key {
+		case "object":
+			t.Object, err = algo.ParseID(value)
+		case "type":
+			t.Type, err = odb.ParseType(value)
+		case "tag":
+			t.Name = value
+		case "tagger":
+			t.Tagger = value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrCorruptObject, err)
+		}
+	}
+	if t.Object.IsZero() || t.Type == 0 || t.Name == "" {
+		return nil, fmt.Errorf("%w: tag is missing object, type or name", ErrCorruptObject)
+	}
+	return t, nil
+}
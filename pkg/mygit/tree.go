@@ -0,0 +1,191 @@
+package mygit
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// FileMode is the mode of a tree entry.
+type FileMode uint32
+
+const (
+	ModeTree       FileMode = 0040000
+	ModeFile       FileMode = 0100644
+	ModeExecutable FileMode = 0100755
+	ModeSymlink    FileMode = 0120000
+	ModeGitlink    FileMode = 0160000
+)
+
+// String formats the mode zero-padded to six digits, as ls-tree prints it.
+func (m FileMode) String() string {
+	return fmt.Sprintf("%06o", uint32(m))
+}
+
+// Type returns the type of object an entry with this mode refers to.
+func (m FileMode) Type() odb.Type {
+	switch m {
+	case ModeTree:
+		return odb.Tree
+	case ModeGitlink:
+		return odb.Commit
+	}
+	return odb.Blob
+}
+
+// TreeEntry is a single entry of a tree object.
+type TreeEntry struct {
+	Mode FileMode
+	Name string
+	ID   odb.ID
+}
+
+// ParseTree decodes the content of a tree object whose entries use object
+// names of the given algorithm.
+func ParseTree(data []byte, algo *odb.Algorithm) ([]TreeEntry, error) {
+	entries := make([]TreeEntry, 0)
+	for len(data) > 0 {
+		mode, rest, found := bytes.Cut(data, []byte{' '})
+		if !found {
+			return nil, fmt.Errorf("%w: malformed tree entry", ErrCorruptObject)
+		}
+		m, err := strconv.ParseUint(string(mode), 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad tree entry mode %q", ErrCorruptObject, mode)
+		}
+		name, rest, found := bytes.Cut(rest, []byte{0})
+		if !found || len(rest) < algo.Size() {
+			return nil, fmt.Errorf("%w: truncated tree entry", ErrCorruptObject)
+		}
+		entries = append(entries, TreeEntry{
+			FileMode(m), string(name), odb.NewID(rest[:algo.Size()]),
+		})
+		data = rest[algo.Size():]
+	}
+	return entries, nil
+}
+
+// validEntryName reports whether a tree entry name is safe to check out:
+// not empty, ".", ".." or ".git" in any case, and without slashes or NUL
+// bytes.
+func validEntryName(name string) bool {
+	switch {
+	case name == "" || name == "." || name == "..":
+		return false
+	case strings.EqualFold(name, ".git"):
+		return false
+	}
+	return !strings.ContainsAny(name, "/\x00")
+}
+
+// SortTree sorts entries in tree order: by name, comparing subtrees as if
+// their names ended with a slash.
+func SortTree(entries []TreeEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return treeKey(entries[i]) < treeKey(entries[j])
+	})
+}
+
+func treeKey(e TreeEntry) string {
+	if e.Mode == ModeTree {
+		return e.Name + "/"
+	}
+	return e.Name
+}
+
+// EncodeTree returns the content of a tree object with the given entries,
+// which must already be in tree order.
+func EncodeTree(entries []TreeEntry) []byte {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		fmt.Fprintf(&buf, "%o %s\x00", uint32(entry.Mode), entry.Name)
+		buf.Write(entry.ID.Bytes())
+	}
+	return buf.Bytes()
+}
+
+// ReadTree returns the entries of a tree object.
+func (r *Repository) ReadTree(id odb.ID) ([]TreeEntry, error) {
+	t, data, err := r.ReadObject(id)
+	if err != nil {
+		return nil, err
+	}
+	if t != odb.Tree {
+		return nil, fmt.Errorf("%w: %s is a %s", ErrNotATree, id, t)
+	}
+	entries, err := ParseTree(data, r.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", id, err)
+	}
+	return entries, nil
+}
+
+// ReadTreeFiles returns the non-tree entries below a tree, keyed by their
+// slash-separated path. The Name of each entry is its full path. Entries
+// whose names could escape the working tree, as verifyPath checks, are
+// rejected with ErrInvalidPath.
+func (r *Repository) ReadTreeFiles(id odb.ID) (map[string]TreeEntry, error) {
+	files := make(map[string]TreeEntry)
+	if id.IsZero() {
+		return files, nil
+	}
+	return files, r.readTreeFiles(id, "", files)
+}
+
+func (r *Repository) readTreeFiles(id odb.ID, dir string, files map[string]TreeEntry) error {
+	entries, err := r.ReadTree(id)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !validEntryName(e.Name) {
+			return fmt.Errorf("%w: %q in tree %s", ErrInvalidPath, dir+e.Name, id)
+		}
+		e.Name = dir + e.Name
+		if e.Mode == ModeTree {
+			if err := r.readTreeFiles(e.ID, e.Name+"/", files); err != nil {
+				return err
+			}
+			continue
+		}
+		files[e.Name] = e
+	}
+	return nil
+}
+
+// TreeChange is a path that differs between two trees. Old or New has the
+// zero ID where the path does not exist on that side.
+type TreeChange struct {
+	Path     string
+	Old, New TreeEntry
+}
+
+// DiffTrees returns the files that differ between two trees, in path
+// order. Either tree may be the zero ID, which stands for an empty tree.
+func (r *Repository) DiffTrees(a, b odb.ID) ([]TreeChange, error) {
+	oldFiles, err := r.ReadTreeFiles(a)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := r.ReadTreeFiles(b)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]TreeChange, 0)
+	for name, e := range oldFiles {
+		if n, ok := newFiles[name]; !ok || n.ID != e.ID || n.Mode != e.Mode {
+			changes = append(changes, TreeChange{Path: name, Old: e, New: n})
+		}
+	}
+	for name, n := range newFiles {
+		if _, ok := oldFiles[name]; !ok {
+			changes = append(changes, TreeChange{Path: name, New: n})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
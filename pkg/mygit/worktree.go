@@ -0,0 +1,495 @@
+package mygit
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/index"
+	"github.com/codecrafters-io/git-starter-go/pkg/odb"
+)
+
+// ErrPathIgnored is returned when paths given to Add are ignored.
+var ErrPathIgnored = errors.New("paths are ignored by one of your .gitignore files")
+
+// ErrInvalidPath is returned for paths that would be written outside the
+// working tree or into the repository.
+var ErrInvalidPath = errors.New("invalid path")
+
+// ErrLocalChanges is returned when an operation would discard changes that
+// are only in the index or the working tree.
+var ErrLocalChanges = errors.New("local changes would be lost")
+
+// Pathspec returns the slash-separated path, relative to the top of the
+// working tree, of a path relative to the directory prefix. The top level
+// itself is the empty string.
+func Pathspec(prefix, name string) (string, error) {
+	spec := path.Join(prefix, filepath.ToSlash(name))
+	if spec == ".." || strings.HasPrefix(spec, "../") || path.IsAbs(spec) {
+		return "", fmt.Errorf("%s: outside repository", name)
+	}
+	if spec == "." {
+		spec = ""
+	}
+	return spec, nil
+}
+
+// inPathspec reports whether a path is specs[i] or below it for some i,
+// and returns i, or -1.
+func inPathspec(name string, specs []string) int {
+	for i, spec := range specs {
+		if spec == "" || name == spec || strings.HasPrefix(name, spec+"/") {
+			return i
+		}
+	}
+	return -1
+}
+
+// verifyPath checks that a slash-separated path stays inside the working
+// tree and out of the repository, as git's verify_path does: every
+// component must be a valid tree entry name.
+func verifyPath(name string) error {
+	for _, c := range strings.Split(name, "/") {
+		if !validEntryName(c) {
+			return fmt.Errorf("%w: %q", ErrInvalidPath, name)
+		}
+	}
+	return nil
+}
+
+// worktreePath returns the file system path of a slash-separated path.
+func (r *Repository) worktreePath(name string) string {
+	return filepath.Join(r.WorkDir, filepath.FromSlash(name))
+}
+
+// walkWorktree calls fn with the lstat information of every file below the
+// slash-separated directory dir. Ignored files are skipped unless
+// withIgnored is set, in which case fn is called for them and for ignored
+// directories, which are not entered, with ignored set. Nested
+// repositories are reported as directories and not entered.
+func (r *Repository) walkWorktree(dir string, ig *Ignore, withIgnored bool, fn func(name string, info fs.FileInfo, ignored bool) error) error {
+	entries, err := os.ReadDir(r.worktreePath(dir))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == ".git" {
+			continue
+		}
+		name := path.Join(dir, entry.Name())
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		ignored := ig.Match(name, info.IsDir())
+		if ignored && !withIgnored {
+			continue
+		}
+		if info.IsDir() && !ignored && !isRepository(r.worktreePath(name)) {
+			err = r.walkWorktree(name, ig, withIgnored, fn)
+		} else {
+			err = fn(name, info, ignored)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isRepository reports whether dir is the working tree of a repository.
+func isRepository(dir string) bool {
+	_, err := os.Lstat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// unpopulatedSubmodule reports whether the working tree file of a gitlink
+// entry is a directory without a repository, as checkout leaves it. Like
+// git, such a submodule is not considered modified.
+func unpopulatedSubmodule(e *index.Entry, info fs.FileInfo, dir string) bool {
+	return FileMode(e.Mode) == ModeGitlink && info.IsDir() && !isRepository(dir)
+}
+
+// headTree returns the tree of the HEAD commit, or the zero ID on an
+// unborn branch.
+func (r *Repository) headTree() (odb.ID, error) {
+	head, err := r.ReadRef("HEAD")
+	if errors.Is(err, ErrRefNotFound) {
+		return odb.ID{}, nil
+	} else if err != nil {
+		return odb.ID{}, err
+	}
+	return r.Peel(head, odb.Tree)
+}
+
+// hashWorktreeFile returns the mode and blob name of a working tree file
+// with the given lstat information, storing the blob if write is set. A
+// nested repository is named by its checked out commit.
+func (r *Repository) hashWorktreeFile(name string, info fs.FileInfo, write bool) (FileMode, odb.ID, error) {
+	mode := FileMode(index.FileMode(info))
+	if mode == ModeGitlink {
+		sub, err := Open(r.worktreePath(name))
+		if err != nil {
+			return 0, odb.ID{}, err
+		}
+		defer sub.Close()
+		head, err := sub.ReadRef("HEAD")
+		if err != nil {
+			return 0, odb.ID{}, fmt.Errorf("%s: does not have a commit checked out: %w", name, err)
+		}
+		return mode, head, nil
+	}
+	data, err := r.readWorktreeFile(name, mode)
+	if err != nil {
+		return 0, odb.ID{}, err
+	}
+	if !write {
+		return mode, r.Hash.Sum(odb.Blob, data), nil
+	}
+	id, err := r.WriteObject(odb.Blob, data)
+	return mode, id, err
+}
+
+// worktreeModified reports whether the working tree file of an index
+// entry differs from the staged content. Files whose stat information is
+// unchanged are not read.
+func (r *Repository) worktreeModified(idx *index.Index, e *index.Entry, info fs.FileInfo) (bool, error) {
+	if idx.UpToDate(e, info) || unpopulatedSubmodule(e, info, r.worktreePath(e.Path)) {
+		return false, nil
+	}
+	mode, id, err := r.hashWorktreeFile(e.Path, info, false)
+	if err != nil {
+		return false, err
+	}
+	return uint32(mode) != e.Mode || id != e.ID, nil
+}
+
+// ModifiedFiles returns the tracked paths below the repository-relative
+// paths whose working tree files differ from the index or were deleted.
+// No paths means the whole working tree.
+func (r *Repository) ModifiedFiles(paths []string) ([]string, error) {
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+	var modified []string
+	for _, e := range idx.Entries {
+		if e.Stage != 0 || inPathspec(e.Path, paths) < 0 {
+			continue
+		}
+		info, err := os.Lstat(r.worktreePath(e.Path))
+		if errors.Is(err, fs.ErrNotExist) {
+			modified = append(modified, e.Path)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		changed, err := r.worktreeModified(idx, e, info)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			modified = append(modified, e.Path)
+		}
+	}
+	return modified, nil
+}
+
+// ReadWorktreeFile returns the mode and blob content of the working tree
+// file at a repository-relative path.
+func (r *Repository) ReadWorktreeFile(name string) (FileMode, []byte, error) {
+	info, err := os.Lstat(r.worktreePath(name))
+	if err != nil {
+		return 0, nil, err
+	}
+	mode := FileMode(index.FileMode(info))
+	data, err := r.readWorktreeFile(name, mode)
+	return mode, data, err
+}
+
+// AddOptions configures Add.
+type AddOptions struct {
+	// Update stages modifications and removals of tracked files only,
+	// without adding new files.
+	Update bool
+	// Force adds ignored files.
+	Force bool
+}
+
+// Add stages the current content of the working tree files below each of
+// the repository-relative paths, including the removal of tracked files
+// that were deleted. No paths means the whole working tree. Ignored paths
+// that are named explicitly are reported with ErrPathIgnored after the
+// remaining paths were staged.
+func (r *Repository) Add(paths []string, opts AddOptions) error {
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+	matched := make([]bool, len(paths))
+	stage := func(name string, info fs.FileInfo) error {
+		if e := idx.Entry(name); e != nil && idx.UpToDate(e, info) {
+			return nil
+		}
+		_, id, err := r.hashWorktreeFile(name, info, true)
+		if err != nil {
+			return err
+		}
+		idx.Add(index.NewEntry(name, info, id))
+		return nil
+	}
+	tracked := append([]*index.Entry(nil), idx.Entries...)
+	for _, e := range tracked {
+		i := inPathspec(e.Path, paths)
+		if i < 0 {
+			continue
+		}
+		matched[i] = true
+		info, err := os.Lstat(r.worktreePath(e.Path))
+		if errors.Is(err, fs.ErrNotExist) || err == nil && info.IsDir() && !isRepository(r.worktreePath(e.Path)) {
+			idx.Remove(e.Path)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := stage(e.Path, info); err != nil {
+			return err
+		}
+	}
+	var ignored []string
+	ig := r.Ignore()
+	for i, spec := range paths {
+		if opts.Update {
+			break
+		}
+		info, err := os.Lstat(r.worktreePath(spec))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		matched[i] = true
+		if spec != "" && idx.Entry(spec) == nil && !opts.Force && ig.Match(spec, info.IsDir()) {
+			ignored = append(ignored, spec)
+			continue
+		}
+		if spec != "" && (!info.IsDir() || isRepository(r.worktreePath(spec))) {
+			err = stage(spec, info)
+		} else {
+			walkIgnore := ig
+			if opts.Force {
+				walkIgnore = nil
+			}
+			err = r.walkWorktree(spec, walkIgnore, false, func(name string, info fs.FileInfo, _ bool) error {
+				return stage(name, info)
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for i, spec := range paths {
+		if !matched[i] {
+			return fmt.Errorf("%w: pathspec '%s' did not match any files", ErrPathNotFound, spec)
+		}
+	}
+	if err := r.WriteIndex(idx); err != nil {
+		return err
+	}
+	if len(ignored) > 0 {
+		return fmt.Errorf("%w: %s", ErrPathIgnored, strings.Join(ignored, ", "))
+	}
+	return nil
+}
+
+// Stage replaces the staged content of a path with a blob, as when only
+// some of the changes to a file are staged. The entry has no stat
+// information, so the working tree file is always compared by content.
+func (r *Repository) Stage(name string, mode FileMode, data []byte) error {
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return err
+	}
+	id, err := r.WriteObject(odb.Blob, data)
+	if err != nil {
+		return err
+	}
+	idx.Add(&index.Entry{Path: name, Mode: uint32(mode), ID: id})
+	return r.WriteIndex(idx)
+}
+
+// RemoveOptions configures Remove.
+type RemoveOptions struct {
+	// Cached removes paths from the index only, keeping the files.
+	Cached bool
+	// Recursive allows removing directories.
+	Recursive bool
+	// Force skips the checks that the files match the index and HEAD.
+	Force bool
+}
+
+// Remove removes the tracked files at the repository-relative paths from
+// the index and, unless opts.Cached is set, from the working tree. It
+// returns the removed paths. Unless opts.Force is set, files whose content
+// would be lost are not removed and ErrLocalChanges is returned.
+func (r *Repository) Remove(paths []string, opts RemoveOptions) ([]string, error) {
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	var entries []*index.Entry
+	for _, spec := range paths {
+		if e := idx.Entry(spec); e != nil {
+			entries = append(entries, e)
+			continue
+		}
+		var below []*index.Entry
+		for _, e := range idx.Entries {
+			if e.Stage == 0 && (spec == "" || strings.HasPrefix(e.Path, spec+"/")) {
+				below = append(below, e)
+			}
+		}
+		if len(below) == 0 {
+			return nil, fmt.Errorf("%w: pathspec '%s' did not match any files", ErrPathNotFound, spec)
+		}
+		if !opts.Recursive {
+			return nil, fmt.Errorf("not removing '%s' recursively without -r", spec)
+		}
+		entries = append(entries, below...)
+	}
+	if !opts.Force {
+		if err := r.checkRemove(idx, entries, opts.Cached); err != nil {
+			return nil, err
+		}
+	}
+	removed := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if idx.Remove(e.Path) {
+			removed = append(removed, e.Path)
+		}
+	}
+	if err := r.WriteIndex(idx); err != nil {
+		return nil, err
+	}
+	if opts.Cached {
+		return removed, nil
+	}
+	for _, name := range removed {
+		if err := os.Remove(r.worktreePath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+		r.removeEmptyDirs(path.Dir(name))
+	}
+	return removed, nil
+}
+
+// checkRemove verifies that removing the entries loses no content: staged
+// content must match HEAD, and the working tree file must match the index
+// unless only the index entry is removed.
+func (r *Repository) checkRemove(idx *index.Index, entries []*index.Entry, cached bool) error {
+	tree, err := r.headTree()
+	if err != nil {
+		return err
+	}
+	head, err := r.ReadTreeFiles(tree)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		h, ok := head[e.Path]
+		staged := !ok || h.ID != e.ID || uint32(h.Mode) != e.Mode
+		modified := false
+		if info, err := os.Lstat(r.worktreePath(e.Path)); err == nil {
+			if modified, err = r.worktreeModified(idx, e, info); err != nil {
+				return err
+			}
+		}
+		switch {
+		case staged && modified:
+			return fmt.Errorf("%w: '%s' has staged content different from both the file and the HEAD", ErrLocalChanges, e.Path)
+		case staged && !cached:
+			return fmt.Errorf("%w: '%s' has changes staged in the index", ErrLocalChanges, e.Path)
+		case modified && !cached:
+			return fmt.Errorf("%w: '%s' has local modifications", ErrLocalChanges, e.Path)
+		}
+	}
+	return nil
+}
+
+// removeEmptyDirs removes the slash-separated directory dir and its
+// parents while they are empty.
+func (r *Repository) removeEmptyDirs(dir string) {
+	for dir != "." && dir != "" {
+		if os.Remove(r.worktreePath(dir)) != nil {
+			return
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// Move renames a tracked file or directory in the working tree and the
+// index. If dst is an existing directory, src is moved into it. An existing
+// destination file is only replaced if force is set.
+func (r *Repository) Move(src, dst string, force bool) error {
+	if src == "" {
+		return fmt.Errorf("%s: cannot move the top level", src)
+	}
+	srcInfo, err := os.Lstat(r.worktreePath(src))
+	if err != nil {
+		return fmt.Errorf("bad source '%s': %w", src, err)
+	}
+	if info, err := os.Stat(r.worktreePath(dst)); err == nil && info.IsDir() {
+		dst = path.Join(dst, path.Base(src))
+	}
+	if dst == src || strings.HasPrefix(dst, src+"/") {
+		return fmt.Errorf("can not move '%s' to a subdirectory of itself", src)
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return err
+	}
+	var entries []*index.Entry
+	if e := idx.Entry(src); e != nil {
+		entries = append(entries, e)
+	} else if srcInfo.IsDir() {
+		for _, e := range idx.Entries {
+			if strings.HasPrefix(e.Path, src+"/") {
+				entries = append(entries, e)
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("%w: '%s' is not under version control", ErrPathNotFound, src)
+	}
+	if info, err := os.Lstat(r.worktreePath(dst)); err == nil {
+		if !force || info.IsDir() || srcInfo.IsDir() {
+			return fmt.Errorf("destination '%s' exists", dst)
+		}
+		idx.Remove(dst)
+	}
+	if _, err := os.Stat(r.worktreePath(path.Dir(dst))); err != nil {
+		return fmt.Errorf("destination directory '%s' does not exist", path.Dir(dst))
+	}
+	if err := os.Rename(r.worktreePath(src), r.worktreePath(dst)); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		idx.Remove(e.Path)
+		moved := *e
+		moved.Path = dst + e.Path[len(src):]
+		idx.Add(&moved)
+	}
+	return r.WriteIndex(idx)
+}
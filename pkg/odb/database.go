@@ -0,0 +1,152 @@
+package odb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Database is the object store of a repository: the loose objects in its
+// objects directory plus every pack under objects/pack. New objects are
+// written loose. It is safe for concurrent use.
+type Database struct {
+	dir   string
+	algo  *Algorithm
+	loose *LooseStore
+	// mu guards packs, which Reload replaces.
+	mu    sync.RWMutex
+	packs []*Pack
+}
+
+// Open opens the objects directory at dir.
+func Open(dir string, algo *Algorithm) (*Database, error) {
+	db := &Database{dir: dir, algo: algo, loose: NewLooseStore(dir, algo)}
+	if err := db.Reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Algorithm returns the hash algorithm of the database.
+func (db *Database) Algorithm() *Algorithm {
+	return db.algo
+}
+
+// Reload rescans objects/pack, picking up packs added since Open.
+func (db *Database) Reload() error {
+	paths, err := filepath.Glob(filepath.Join(db.dir, "pack", "*.pack"))
+	if err != nil {
+		return err
+	}
+	packs := make([]*Pack, 0, len(paths))
+	for _, path := range paths {
+		if _, err := os.Stat(strings.TrimSuffix(path, ".pack") + ".idx"); err != nil {
+			// The pack is still being indexed.
+			continue
+		}
+		pack, err := OpenPack(path, db.algo)
+		if err != nil {
+			for _, p := range packs {
+				p.Close()
+			}
+			return err
+		}
+		packs = append(packs, pack)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.closePacks()
+	db.packs = packs
+	return nil
+}
+
+// Close releases the database's pack files.
+func (db *Database) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.closePacks()
+}
+
+func (db *Database) closePacks() error {
+	var errs []error
+	for _, pack := range db.packs {
+		errs = append(errs, pack.Close())
+	}
+	db.packs = nil
+	return errors.Join(errs...)
+}
+
+func (db *Database) Read(id ID) (Type, []byte, error) {
+	t, data, err := db.loose.Read(id)
+	if !errors.Is(err, ErrNotFound) {
+		return t, data, err
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, pack := range db.packs {
+		if pack.Has(id) {
+			return pack.Read(id)
+		}
+	}
+	return 0, nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+func (db *Database) Write(t Type, data []byte) (ID, error) {
+	id := db.algo.Sum(t, data)
+	if db.Has(id) {
+		return id, nil
+	}
+	return db.loose.Write(t, data)
+}
+
+// WriteLiterally stores a loose object with a type given by name, as
+// LooseStore.WriteLiterally does.
+func (db *Database) WriteLiterally(typeName string, data []byte) (ID, error) {
+	id := db.algo.SumLiterally(typeName, data)
+	if db.Has(id) {
+		return id, nil
+	}
+	return db.loose.WriteLiterally(typeName, data)
+}
+
+func (db *Database) Has(id ID) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, pack := range db.packs {
+		if pack.Has(id) {
+			return true
+		}
+	}
+	return db.loose.Has(id)
+}
+
+// Iterate visits every object once, even if it is both loose and packed.
+func (db *Database) Iterate(fn func(id ID) error) error {
+	seen := make(map[ID]bool)
+	visit := func(id ID) error {
+		if seen[id] {
+			return nil
+		}
+		seen[id] = true
+		return fn(id)
+	}
+	if err := db.loose.Iterate(visit); err != nil {
+		return err
+	}
+	// fn may read objects, so the lock is not held while it runs. The
+	// packs are copied under it instead; a pack closed by a concurrent
+	// Reload still lists its names, which are kept in memory.
+	db.mu.RLock()
+	packs := slices.Clone(db.packs)
+	db.mu.RUnlock()
+	for _, pack := range packs {
+		if err := pack.Iterate(visit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package odb
+
+import "fmt"
+
+var errDelta = fmt.Errorf("%w: invalid delta", ErrCorrupt)
+
+// deltaSize reads a little-endian base-128 size from the start of a delta.
+func deltaSize(delta []byte) (uint64, []byte, error) {
+	var size uint64
+	for shift := uint(0); ; shift += 7 {
+		if len(delta) == 0 || shift > 63 {
+			return 0, nil, fmt.Errorf("%w: truncated size", errDelta)
+		}
+		b := delta[0]
+		delta = delta[1:]
+		size |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return size, delta, nil
+		}
+	}
+}
+
+// ApplyDelta reconstructs an object from its base and a git delta. The base
+// and result sizes recorded in the delta are verified.
+func ApplyDelta(base, delta []byte) ([]byte, error) {
+	baseSize, delta, err := deltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != uint64(len(base)) {
+		return nil, fmt.Errorf("%w: base size %d, expected %d", errDelta, len(base), baseSize)
+	}
+	resultSize, delta, err := deltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	// The result size is not trusted until the delta has been applied.
+	result := make([]byte, 0, min(resultSize, uint64(len(base)+len(delta))))
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			// Copy: bits 0-3 select offset bytes, bits 4-6 size bytes.
+			var offset, size uint64
+			for i := uint(0); i < 7; i++ {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, fmt.Errorf("%w: truncated copy", errDelta)
+				}
+				if i < 4 {
+					offset |= uint64(delta[0]) << (8 * i)
+				} else {
+					size |= uint64(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) {
+				return nil, fmt.Errorf("%w: copy out of range", errDelta)
+			}
+			result = append(result, base[offset:offset+size]...)
+		case op != 0:
+			// Insert: the opcode is the number of literal bytes.
+			if int(op) > len(delta) {
+				return nil, fmt.Errorf("%w: truncated insert", errDelta)
+			}
+			result = append(result, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, fmt.Errorf("%w: reserved opcode", errDelta)
+		}
+		if uint64(len(result)) > resultSize {
+			return nil, fmt.Errorf("%w: result exceeds %d bytes", errDelta, resultSize)
+		}
+	}
+	if uint64(len(result)) != resultSize {
+		return nil, fmt.Errorf("%w: result size %d, expected %d", errDelta, len(result), resultSize)
+	}
+	return result, nil
+}
@@ -0,0 +1,80 @@
+package odb
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// delta builds a delta from the base and result sizes and the
+// instructions.
+func delta(baseSize, resultSize uint64, ops ...byte) []byte {
+	var d []byte
+	for _, size := range []uint64{baseSize, resultSize} {
+		for size >= 0x80 {
+			d = append(d, byte(size)|0x80)
+			size >>= 7
+		}
+		d = append(d, byte(size))
+	}
+	return append(d, ops...)
+}
+
+func TestApplyDelta(t *testing.T) {
+	base := []byte("0123456789")
+	tests := []struct {
+		name  string
+		delta []byte
+		want  string
+	}{
+		{"insert", delta(10, 3, 3, 'a', 'b', 'c'), "abc"},
+		// Copy 4 bytes from offset 2.
+		{"copy", delta(10, 4, 0x91, 2, 4), "2345"},
+		// Without offset bytes the copy starts at offset 0.
+		{"copy without offset", delta(10, 3, 0x90, 3), "012"},
+		{"copy and insert", delta(10, 6, 0x91, 8, 2, 4, 'w', 'x', 'y', 'z'), "89wxyz"},
+		{"empty result", delta(10, 0), ""},
+	}
+	for _, tt := range tests {
+		got, err := ApplyDelta(base, tt.delta)
+		if err != nil || string(got) != tt.want {
+			t.Errorf("%s: ApplyDelta = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestApplyDeltaCopySizeZero(t *testing.T) {
+	// A copy without size bytes copies 0x10000 bytes.
+	base := bytes.Repeat([]byte("abcd"), 0x10000/4+1)
+	got, err := ApplyDelta(base, delta(uint64(len(base)), 0x10000, 0x81, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, base[4:4+0x10000]) {
+		t.Errorf("ApplyDelta copied %d bytes, want 0x10000 from offset 4", len(got))
+	}
+}
+
+func TestApplyDeltaErrors(t *testing.T) {
+	base := []byte("0123456789")
+	tests := []struct {
+		name  string
+		delta []byte
+	}{
+		{"base size mismatch", delta(11, 3, 3, 'a', 'b', 'c')},
+		{"result too short", delta(10, 4, 3, 'a', 'b', 'c')},
+		{"result too long", delta(10, 2, 3, 'a', 'b', 'c')},
+		{"copy past end", delta(10, 4, 0x91, 8, 4)},
+		{"copy beyond base", delta(10, 0x10000, 0x80)},
+		{"truncated copy", delta(10, 4, 0x91, 2)},
+		{"truncated insert", delta(10, 3, 3, 'a')},
+		{"reserved opcode", delta(10, 1, 0)},
+		{"truncated size", []byte{0x8a}},
+		{"huge result size", delta(10, 1<<62, 0x91, 0, 10)},
+	}
+	for _, tt := range tests {
+		if got, err := ApplyDelta(base, tt.delta); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: ApplyDelta = %q, %v, want ErrCorrupt", tt.name, got, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package odb
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// MaxSize is the size in bytes of the longest supported object name.
+const MaxSize = sha256.Size
+
+// Algorithm is the hash function used to name objects in a repository.
+type Algorithm struct {
+	name string
+	size int
+	new  func() hash.Hash
+}
+
+var (
+	SHA1   = &Algorithm{"sha1", sha1.Size, sha1.New}
+	SHA256 = &Algorithm{"sha256", sha256.Size, sha256.New}
+)
+
+// LookupAlgorithm returns the algorithm with the given extensions.objectFormat
+// name. An empty name selects SHA-1, the historical default.
+func LookupAlgorithm(name string) (*Algorithm, error) {
+	switch strings.ToLower(name) {
+	case "", "sha1":
+		return SHA1, nil
+	case "sha256":
+		return SHA256, nil
+	}
+	return nil, fmt.Errorf("unknown object format: %s", name)
+}
+
+// Name returns the name of the algorithm as used in configuration.
+func (a *Algorithm) Name() string {
+	return a.name
+}
+
+// Size returns the size of an object name in bytes.
+func (a *Algorithm) Size() int {
+	return a.size
+}
+
+// New returns a hash.Hash computing the algorithm.
+func (a *Algorithm) New() hash.Hash {
+	return a.new()
+}
+
+// Sum returns the name of an object with the given type and content.
+func (a *Algorithm) Sum(t Type, data []byte) ID {
+	return a.SumLiterally(t.String(), data)
+}
+
+// SumLiterally returns the name of an object with a type given by name,
+// known or not.
+func (a *Algorithm) SumLiterally(typeName string, data []byte) ID {
+	h := a.new()
+	h.Write(EncodeLiterally(typeName, data))
+	return NewID(h.Sum(nil))
+}
+
+// ZeroID returns the all-zero name, used for missing old or new values.
+func (a *Algorithm) ZeroID() ID {
+	return NewID(make([]byte, a.size))
+}
+
+// ParseID parses a full hex object name of the algorithm's size.
+func (a *Algorithm) ParseID(s string) (ID, error) {
+	if len(s) != a.size*2 {
+		return ID{}, fmt.Errorf("invalid object name: %q", s)
+	}
+	return ParseID(s)
+}
+
+// ID is the binary name of an object. IDs are comparable and may be used as
+// map keys. The zero value is not a valid name.
+type ID struct {
+	hash [MaxSize]byte
+	size uint8
+}
+
+// NewID returns the ID with the given binary name.
+func NewID(b []byte) ID {
+	var id ID
+	id.size = uint8(copy(id.hash[:], b))
+	return id
+}
+
+// ParseID parses a full hex object name of any supported size.
+func ParseID(s string) (ID, error) {
+	if len(s) != sha1.Size*2 && len(s) != sha256.Size*2 {
+		return ID{}, fmt.Errorf("invalid object name: %q", s)
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return ID{}, fmt.Errorf("invalid object name: %q", s)
+	}
+	return NewID(b), nil
+}
+
+// Bytes returns the binary name.
+func (id ID) Bytes() []byte {
+	return id.hash[:id.size]
+}
+
+// String returns the hex-encoded name.
+func (id ID) String() string {
+	return hex.EncodeToString(id.Bytes())
+}
+
+// IsZero reports whether id is unset or the all-zero name.
+func (id ID) IsZero() bool {
+	return id.hash == [MaxSize]byte{}
+}
+
+// HasPrefix reports whether the hex name of id starts with prefix.
+func (id ID) HasPrefix(prefix string) bool {
+	return strings.HasPrefix(id.String(), strings.ToLower(prefix))
+}
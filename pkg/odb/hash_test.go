@@ -0,0 +1,70 @@
+package odb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSum(t *testing.T) {
+	tests := []struct {
+		algo *Algorithm
+		typ  Type
+		data string
+		want string
+	}{
+		{SHA1, Blob, "hello\n", "ce013625030ba8dba906f756967f9e9ca394464a"},
+		{SHA1, Tree, "", "4b825dc642cb6eb9a060e54bf8d69288fbee4904"},
+		{SHA256, Blob, "hello\n", "2cf8d83d9ee29543b34a87727421fdecb7e3f3a183d337639025de576db9ebb4"},
+		{SHA256, Tree, "", "6ef19b41225c5369f1c104d45d8d85efa9b057b53b14b4b9b939dd74decc5321"},
+	}
+	for _, tt := range tests {
+		got := tt.algo.Sum(tt.typ, []byte(tt.data))
+		if got.String() != tt.want {
+			t.Errorf("%s.Sum(%s, %q) = %s, want %s", tt.algo.Name(), tt.typ, tt.data, got, tt.want)
+		}
+		if len(got.Bytes()) != tt.algo.Size() {
+			t.Errorf("%s.Sum returned %d bytes, want %d", tt.algo.Name(), len(got.Bytes()), tt.algo.Size())
+		}
+	}
+}
+
+func TestLookupAlgorithm(t *testing.T) {
+	for name, want := range map[string]*Algorithm{"": SHA1, "sha1": SHA1, "SHA256": SHA256} {
+		got, err := LookupAlgorithm(name)
+		if err != nil || got != want {
+			t.Errorf("LookupAlgorithm(%q) = %v, %v, want %s", name, got, err, want.Name())
+		}
+	}
+	if _, err := LookupAlgorithm("md5"); err == nil {
+		t.Error("LookupAlgorithm(\"md5\") succeeded")
+	}
+}
+
+func TestParseID(t *testing.T) {
+	const sha1Name = "ce013625030ba8dba906f756967f9e9ca394464a"
+	id, err := SHA1.ParseID(sha1Name)
+	if err != nil || id.String() != sha1Name {
+		t.Fatalf("SHA1.ParseID(%q) = %s, %v", sha1Name, id, err)
+	}
+	if _, err := SHA256.ParseID(sha1Name); err == nil {
+		t.Error("SHA256.ParseID accepted a SHA-1 name")
+	}
+	if _, err := SHA1.ParseID("xyz" + sha1Name[3:]); err == nil {
+		t.Error("SHA1.ParseID accepted a name that is not hex")
+	}
+	if !SHA256.ZeroID().IsZero() || len(SHA256.ZeroID().Bytes()) != SHA256.Size() {
+		t.Error("SHA256.ZeroID is not a zero name of the right size")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	typ, data, err := Decode(Encode(Commit, []byte("tree x\n")))
+	if err != nil || typ != Commit || string(data) != "tree x\n" {
+		t.Fatalf("Decode(Encode(...)) = %s, %q, %v", typ, data, err)
+	}
+	for _, raw := range []string{"blob 5\x00abc", "blob\x00", "blob 3"} {
+		if _, _, err := Decode([]byte(raw)); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Decode(%q) error = %v, want ErrCorrupt", raw, err)
+		}
+	}
+}
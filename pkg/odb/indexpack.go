@@ -0,0 +1,194 @@
+package odb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// indexEntry is what a pack index records about an object.
+type indexEntry struct {
+	id     ID
+	offset int64
+	crc    uint32
+	// delta is set for a delta entry whose name is not known yet.
+	delta bool
+}
+
+// WritePack stores the pack read from r in objects/pack, indexes it like
+// git index-pack and reloads the packs, so that its objects can be read.
+// The pack is written to disk as it arrives and its objects are named as
+// they are inflated, without being held in memory. Deltas are then
+// resolved from the file, so memory use is bounded by the largest delta
+// and its base, the delta base cache and the name, offset and checksum
+// of each entry. The pack's checksum, which names its files, is returned.
+func (db *Database) WritePack(r io.Reader) (ID, error) {
+	dir := filepath.Join(db.dir, "pack")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return ID{}, err
+	}
+	tmp, err := os.CreateTemp(dir, "tmp_pack_")
+	if err != nil {
+		return ID{}, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	pr, err := NewPackReader(io.TeeReader(r, tmp), db.algo)
+	if err != nil {
+		return ID{}, err
+	}
+	pr.DiscardData = true
+	entries := make([]*indexEntry, 0, pr.Count())
+	for {
+		e, err := pr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return ID{}, err
+		}
+		ie := &indexEntry{id: e.ID, offset: e.Offset, crc: e.CRC32}
+		ie.delta = e.Type == OfsDelta || e.Type == RefDelta
+		entries = append(entries, ie)
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		return ID{}, err
+	}
+	p := &Pack{algo: db.algo, file: tmp, size: info.Size(), cache: make(map[int64]memoryObject)}
+	if err := p.resolveEntries(entries); err != nil {
+		return ID{}, err
+	}
+
+	sum := pr.Checksum()
+	base := filepath.Join(dir, "pack-"+sum.String())
+	idx, err := os.CreateTemp(dir, "tmp_idx_")
+	if err != nil {
+		return ID{}, err
+	}
+	defer os.Remove(idx.Name())
+	err = writePackIndex(idx, entries, sum, db.algo)
+	if closeErr := idx.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return ID{}, err
+	}
+	// Packs without an index are ignored, so the index is moved last.
+	if err := os.Rename(tmp.Name(), base+".pack"); err != nil {
+		return ID{}, err
+	}
+	if err := os.Rename(idx.Name(), base+".idx"); err != nil {
+		return ID{}, err
+	}
+	return sum, db.Reload()
+}
+
+// resolveEntries names the delta entries by reconstructing them from the
+// pack file and leaves the entries sorted by name with the pack's index
+// set up. A REF_DELTA base may itself be a delta, so deltas are resolved
+// in rounds until no more bases become known.
+func (p *Pack) resolveEntries(entries []*indexEntry) error {
+	pending := 0
+	for _, e := range entries {
+		if e.delta {
+			pending++
+		}
+	}
+	for {
+		p.setIndex(entries)
+		if pending == 0 {
+			return nil
+		}
+		resolved := 0
+		for _, e := range entries {
+			if !e.delta {
+				continue
+			}
+			t, data, err := p.readEntry(e.offset, 0)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("entry at offset %d: %w", e.offset, err)
+			}
+			e.id, e.delta = p.algo.Sum(t, data), false
+			resolved++
+		}
+		if resolved == 0 {
+			return fmt.Errorf("%w: %d deltas with missing bases", ErrCorrupt, pending)
+		}
+		pending -= resolved
+	}
+}
+
+// setIndex sorts the named entries and makes them the pack's index.
+func (p *Pack) setIndex(entries []*indexEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].delta != entries[j].delta {
+			return !entries[i].delta
+		}
+		return bytes.Compare(entries[i].id.Bytes(), entries[j].id.Bytes()) < 0
+	})
+	p.names = p.names[:0]
+	p.offsets = p.offsets[:0]
+	p.fanout = [256]uint32{}
+	for _, e := range entries {
+		if e.delta {
+			break
+		}
+		p.names = append(p.names, e.id.Bytes()...)
+		p.offsets = append(p.offsets, e.offset)
+		p.fanout[e.id.Bytes()[0]]++
+	}
+	for i := 1; i < len(p.fanout); i++ {
+		p.fanout[i] += p.fanout[i-1]
+	}
+}
+
+// writePackIndex writes a version 2 pack index for entries sorted by
+// name: the fan-out table, the names, the CRC-32 checksums, the offsets,
+// with offsets of 2 GiB and more in a table of 64-bit values, and the
+// checksums of the pack and of the index itself.
+func writePackIndex(w io.Writer, entries []*indexEntry, packSum ID, algo *Algorithm) error {
+	h := algo.New()
+	bw := bufio.NewWriter(io.MultiWriter(w, h))
+	bw.WriteString("\377tOc")
+	binary.Write(bw, binary.BigEndian, uint32(2))
+	var fanout [256]uint32
+	for _, e := range entries {
+		fanout[e.id.Bytes()[0]]++
+	}
+	for i := 1; i < len(fanout); i++ {
+		fanout[i] += fanout[i-1]
+	}
+	binary.Write(bw, binary.BigEndian, fanout)
+	for _, e := range entries {
+		bw.Write(e.id.Bytes())
+	}
+	for _, e := range entries {
+		binary.Write(bw, binary.BigEndian, e.crc)
+	}
+	var large []uint64
+	for _, e := range entries {
+		if e.offset < 1<<31 {
+			binary.Write(bw, binary.BigEndian, uint32(e.offset))
+			continue
+		}
+		binary.Write(bw, binary.BigEndian, uint32(len(large))|1<<31)
+		large = append(large, uint64(e.offset))
+	}
+	binary.Write(bw, binary.BigEndian, large)
+	bw.Write(packSum.Bytes())
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	_, err := w.Write(h.Sum(nil))
+	return err
+}
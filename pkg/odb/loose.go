@@ -0,0 +1,133 @@
+package odb
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LooseStore keeps each object zlib-compressed in its own file, named
+// <dir>/<first two hex digits>/<remaining hex digits>.
+type LooseStore struct {
+	dir  string
+	algo *Algorithm
+}
+
+// NewLooseStore returns a store for the loose objects under dir.
+func NewLooseStore(dir string, algo *Algorithm) *LooseStore {
+	return &LooseStore{dir, algo}
+}
+
+func (s *LooseStore) path(id ID) string {
+	hash := id.String()
+	return filepath.Join(s.dir, hash[:2], hash[2:])
+}
+
+func (s *LooseStore) Read(id ID) (Type, []byte, error) {
+	file, err := os.Open(s.path(id))
+	if os.IsNotExist(err) {
+		return 0, nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	} else if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+	r, err := zlib.NewReader(file)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %s: %s", ErrCorrupt, id, err)
+	}
+	defer r.Close()
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %s: %s", ErrCorrupt, id, err)
+	}
+	t, data, err := Decode(raw)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%s: %w", id, err)
+	}
+	return t, data, nil
+}
+
+func (s *LooseStore) Write(t Type, data []byte) (ID, error) {
+	return s.WriteLiterally(t.String(), data)
+}
+
+// WriteLiterally stores an object with a type given by name, which need
+// not be one of the known types. Such objects cannot be read back.
+func (s *LooseStore) WriteLiterally(typeName string, data []byte) (ID, error) {
+	id := s.algo.SumLiterally(typeName, data)
+	path := s.path(id)
+	if _, err := os.Stat(path); err == nil {
+		return id, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return ID{}, err
+	}
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(EncodeLiterally(typeName, data))
+	if err := w.Close(); err != nil {
+		return ID{}, err
+	}
+	// Write to a temporary file first so that readers never observe a
+	// partially written object.
+	tmp, err := os.CreateTemp(filepath.Dir(path), "tmp_obj_")
+	if err != nil {
+		return ID{}, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return ID{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return ID{}, err
+	}
+	if err := os.Chmod(tmp.Name(), 0444); err != nil {
+		return ID{}, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return ID{}, err
+	}
+	return id, nil
+}
+
+func (s *LooseStore) Has(id ID) bool {
+	_, err := os.Stat(s.path(id))
+	return err == nil
+}
+
+func (s *LooseStore) Iterate(fn func(id ID) error) error {
+	dirs, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.dir, dir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name := dir.Name() + entry.Name()
+			if len(name) != s.algo.size*2 {
+				continue
+			}
+			b, err := hex.DecodeString(name)
+			if err != nil {
+				continue
+			}
+			if err := fn(NewID(b)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package odb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type memoryObject struct {
+	t    Type
+	data []byte
+}
+
+// MemoryStore keeps objects in memory. It is safe for concurrent use.
+type MemoryStore struct {
+	algo    *Algorithm
+	mu      sync.RWMutex
+	objects map[ID]memoryObject
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore(algo *Algorithm) *MemoryStore {
+	return &MemoryStore{algo: algo, objects: make(map[ID]memoryObject)}
+}
+
+func (s *MemoryStore) Read(id ID) (Type, []byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[id]
+	if !ok {
+		return 0, nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return obj.t, obj.data, nil
+}
+
+func (s *MemoryStore) Write(t Type, data []byte) (ID, error) {
+	id := s.algo.Sum(t, data)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.objects[id]; !ok {
+		s.objects[id] = memoryObject{t, bytes.Clone(data)}
+	}
+	return id, nil
+}
+
+func (s *MemoryStore) Has(id ID) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.objects[id]
+	return ok
+}
+
+func (s *MemoryStore) Iterate(fn func(id ID) error) error {
+	s.mu.RLock()
+	ids := make([]ID, 0, len(s.objects))
+	for id := range s.objects {
+		ids = append(ids, id)
+	}
+	s.mu.RUnlock()
+	sort.Slice(ids, func(i, j int) bool {
+		return bytes.Compare(ids[i].Bytes(), ids[j].Bytes()) < 0
+	})
+	for _, id := range ids {
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package odb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Type is the type of an object. Values match the type numbers used in
+// pack files.
+type Type int
+
+const (
+	Commit Type = 1
+	Tree   Type = 2
+	Blob   Type = 3
+	Tag    Type = 4
+)
+
+var typeNames = map[Type]string{
+	Commit: "commit",
+	Tree:   "tree",
+	Blob:   "blob",
+	Tag:    "tag",
+}
+
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("type(%d)", int(t))
+}
+
+// ParseType returns the type with the given name.
+func ParseType(name string) (Type, error) {
+	for t, n := range typeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid object type: %q", name)
+}
+
+var (
+	// ErrNotFound is returned when an object is not in the store.
+	ErrNotFound = errors.New("object not found")
+	// ErrCorrupt is returned when stored data cannot be decoded.
+	ErrCorrupt = errors.New("corrupt object")
+	// ErrReadOnly is returned when writing to a store that does not
+	// support it.
+	ErrReadOnly = errors.New("object store is read-only")
+)
+
+// Encode returns the canonical "<type> <size>\x00<content>" form of an
+// object, over which its name is computed.
+func Encode(t Type, data []byte) []byte {
+	return EncodeLiterally(t.String(), data)
+}
+
+// EncodeLiterally is Encode for a type given by name, which need not be
+// one of the known types.
+func EncodeLiterally(typeName string, data []byte) []byte {
+	buf := bytes.NewBufferString(fmt.Sprintf("%s %d\x00", typeName, len(data)))
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+// Decode parses the canonical encoding of an object.
+func Decode(raw []byte) (Type, []byte, error) {
+	header, data, found := bytes.Cut(raw, []byte{0})
+	if !found {
+		return 0, nil, fmt.Errorf("%w: missing header", ErrCorrupt)
+	}
+	name, size, found := bytes.Cut(header, []byte{' '})
+	if !found {
+		return 0, nil, fmt.Errorf("%w: malformed header", ErrCorrupt)
+	}
+	t, err := ParseType(string(name))
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %s", ErrCorrupt, err)
+	}
+	n, err := strconv.Atoi(string(size))
+	if err != nil || n != len(data) {
+		return 0, nil, fmt.Errorf("%w: size mismatch", ErrCorrupt)
+	}
+	return t, data, nil
+}
@@ -0,0 +1,346 @@
+package odb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Pack entry types used only inside pack files. An OFS_DELTA entry names
+// its base by its offset in the pack, a REF_DELTA entry by its object
+// name.
+const (
+	OfsDelta Type = 6
+	RefDelta Type = 7
+)
+
+// maxPrealloc bounds the memory reserved up front for an object whose
+// size was read from a pack or delta header.
+const maxPrealloc = 1 << 20
+
+// maxDeltaDepth bounds the length of a delta chain, which guards against
+// REF_DELTA entries that form a cycle. It is the largest depth git's
+// pack-objects writes.
+const maxDeltaDepth = 4095
+
+// maxCachedBytes bounds the total size of the delta bases kept in memory
+// per pack.
+const maxCachedBytes = 32 << 20
+
+// Pack is a read-only store backed by a pack file and its version 2 index.
+// It is safe for concurrent use.
+type Pack struct {
+	algo    *Algorithm
+	file    *os.File
+	size    int64
+	names   []byte
+	offsets []int64
+	fanout  [256]uint32
+	// mu guards cache, the delta bases read recently, and cacheBytes,
+	// their total size.
+	mu         sync.Mutex
+	cache      map[int64]memoryObject
+	cacheBytes int
+}
+
+// OpenPack opens the pack file at path together with the .idx file next
+// to it.
+func OpenPack(path string, algo *Algorithm) (*Pack, error) {
+	idx, err := os.ReadFile(strings.TrimSuffix(path, ".pack") + ".idx")
+	if err != nil {
+		return nil, err
+	}
+	p := &Pack{algo: algo, cache: make(map[int64]memoryObject)}
+	if err := p.parseIndex(idx); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	p.file, err = os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := p.file.Stat()
+	if err != nil {
+		p.file.Close()
+		return nil, err
+	}
+	p.size = info.Size()
+	var header [8]byte
+	if _, err := p.file.ReadAt(header[:], 0); err != nil || string(header[:4]) != "PACK" {
+		p.file.Close()
+		return nil, fmt.Errorf("%w: %s: not a pack file", ErrCorrupt, path)
+	}
+	if v := binary.BigEndian.Uint32(header[4:]); v != 2 && v != 3 {
+		p.file.Close()
+		return nil, fmt.Errorf("%w: %s: unsupported pack version %d", ErrCorrupt, path, v)
+	}
+	return p, nil
+}
+
+// parseIndex decodes a version 2 pack index.
+func (p *Pack) parseIndex(idx []byte) error {
+	size := p.algo.size
+	if len(idx) < 8+256*4 || string(idx[:4]) != "\377tOc" {
+		return fmt.Errorf("%w: bad index header", ErrCorrupt)
+	}
+	if v := binary.BigEndian.Uint32(idx[4:]); v != 2 {
+		return fmt.Errorf("%w: unsupported index version %d", ErrCorrupt, v)
+	}
+	for i := range p.fanout {
+		p.fanout[i] = binary.BigEndian.Uint32(idx[8+i*4:])
+		if i > 0 && p.fanout[i] < p.fanout[i-1] {
+			return fmt.Errorf("%w: non-monotonic index fanout", ErrCorrupt)
+		}
+	}
+	n := int(p.fanout[255])
+	names := 8 + 256*4
+	// Each object takes a name, a CRC and an offset.
+	if n > (len(idx)-names-2*size)/(size+8) {
+		return fmt.Errorf("%w: truncated index", ErrCorrupt)
+	}
+	crcs := names + n*size
+	offsets := crcs + n*4
+	large := offsets + n*4
+	if len(idx) < large+2*size {
+		return fmt.Errorf("%w: truncated index", ErrCorrupt)
+	}
+	p.names = idx[names:crcs]
+	p.offsets = make([]int64, n)
+	for i := range p.offsets {
+		off := binary.BigEndian.Uint32(idx[offsets+i*4:])
+		if off&0x80000000 == 0 {
+			p.offsets[i] = int64(off)
+			continue
+		}
+		pos := large + int(off&0x7fffffff)*8
+		if pos+8 > len(idx)-2*size {
+			return fmt.Errorf("%w: bad large offset", ErrCorrupt)
+		}
+		p.offsets[i] = int64(binary.BigEndian.Uint64(idx[pos:]))
+	}
+	return nil
+}
+
+// Close releases the pack file.
+func (p *Pack) Close() error {
+	return p.file.Close()
+}
+
+func (p *Pack) name(i int) []byte {
+	size := p.algo.size
+	return p.names[i*size : (i+1)*size]
+}
+
+// find returns the index position of id, or -1.
+func (p *Pack) find(id ID) int {
+	b := id.Bytes()
+	if len(b) != p.algo.size {
+		return -1
+	}
+	lo := 0
+	if b[0] > 0 {
+		lo = int(p.fanout[b[0]-1])
+	}
+	hi := int(p.fanout[b[0]])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.name(lo+i), b) >= 0
+	})
+	if i < hi && bytes.Equal(p.name(i), b) {
+		return i
+	}
+	return -1
+}
+
+func (p *Pack) Read(id ID) (Type, []byte, error) {
+	i := p.find(id)
+	if i < 0 {
+		return 0, nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	t, data, err := p.readEntry(p.offsets[i], 0)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%s: %w", id, err)
+	}
+	return t, data, nil
+}
+
+func (p *Pack) Write(t Type, data []byte) (ID, error) {
+	return ID{}, ErrReadOnly
+}
+
+func (p *Pack) Has(id ID) bool {
+	return p.find(id) >= 0
+}
+
+func (p *Pack) Iterate(fn func(id ID) error) error {
+	for i := range p.offsets {
+		if err := fn(NewID(p.name(i))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readEntry reads and fully resolves the object at offset, which is depth
+// deltas away from the object first asked for.
+func (p *Pack) readEntry(offset int64, depth int) (Type, []byte, error) {
+	if obj, ok := p.cached(offset); ok {
+		return obj.t, obj.data, nil
+	}
+	if depth > maxDeltaDepth {
+		return 0, nil, fmt.Errorf("%w: delta chain too deep", ErrCorrupt)
+	}
+	if offset < 12 || offset >= p.size {
+		return 0, nil, fmt.Errorf("%w: offset %d out of range", ErrCorrupt, offset)
+	}
+	r := bufio.NewReader(io.NewSectionReader(p.file, offset, p.size-offset))
+	t, size, err := readEntryHeader(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	var base memoryObject
+	switch t {
+	case Commit, Tree, Blob, Tag:
+		data, err := inflate(r, size)
+		return t, data, err
+	case OfsDelta:
+		rel, err := readOffset(r)
+		if err != nil {
+			return 0, nil, err
+		}
+		if rel <= 0 || rel > offset {
+			return 0, nil, fmt.Errorf("%w: bad delta base offset", ErrCorrupt)
+		}
+		base.t, base.data, err = p.readEntry(offset-rel, depth+1)
+		if err != nil {
+			return 0, nil, err
+		}
+		p.remember(offset-rel, base)
+	case RefDelta:
+		name := make([]byte, p.algo.size)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return 0, nil, fmt.Errorf("%w: %s", ErrCorrupt, err)
+		}
+		i := p.find(NewID(name))
+		if i < 0 {
+			return 0, nil, fmt.Errorf("%w: delta base %s", ErrNotFound, NewID(name))
+		}
+		base.t, base.data, err = p.readEntry(p.offsets[i], depth+1)
+		if err != nil {
+			return 0, nil, err
+		}
+	default:
+		return 0, nil, fmt.Errorf("%w: unknown pack entry type %d", ErrCorrupt, t)
+	}
+	delta, err := inflate(r, size)
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err := ApplyDelta(base.data, delta)
+	return base.t, data, err
+}
+
+// cached returns the delta base read from offset if it is still cached.
+func (p *Pack) cached(offset int64) (memoryObject, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	obj, ok := p.cache[offset]
+	return obj, ok
+}
+
+// remember caches the delta base read from offset, emptying the cache
+// when it would grow beyond maxCachedBytes.
+func (p *Pack) remember(offset int64, obj memoryObject) {
+	if len(obj.data) > maxCachedBytes {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.cache[offset]; ok {
+		return
+	}
+	if p.cacheBytes+len(obj.data) > maxCachedBytes {
+		clear(p.cache)
+		p.cacheBytes = 0
+	}
+	p.cache[offset] = obj
+	p.cacheBytes += len(obj.data)
+}
+
+// readEntryHeader reads a pack entry header: a 3-bit type and a size split
+// into a 4-bit low part followed by 7-bit groups, each byte's high bit
+// marking continuation.
+func readEntryHeader(r io.ByteReader) (Type, uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: truncated entry header", ErrCorrupt)
+	}
+	t := Type(b >> 4 & 7)
+	size := uint64(b & 0x0f)
+	for shift := uint(4); b&0x80 != 0; shift += 7 {
+		if shift > 57 {
+			return 0, 0, fmt.Errorf("%w: entry size overflows", ErrCorrupt)
+		}
+		if b, err = r.ReadByte(); err != nil {
+			return 0, 0, fmt.Errorf("%w: truncated entry header", ErrCorrupt)
+		}
+		size |= uint64(b&0x7f) << shift
+	}
+	return t, size, nil
+}
+
+// readOffset reads the base offset of an OFS_DELTA entry. Unlike sizes,
+// each continuation adds one before shifting so that encodings are unique.
+func readOffset(r io.ByteReader) (int64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, fmt.Errorf("%w: truncated delta offset", ErrCorrupt)
+	}
+	offset := int64(b & 0x7f)
+	for b&0x80 != 0 {
+		if offset >= 1<<56 {
+			return 0, fmt.Errorf("%w: delta offset overflows", ErrCorrupt)
+		}
+		if b, err = r.ReadByte(); err != nil {
+			return 0, fmt.Errorf("%w: truncated delta offset", ErrCorrupt)
+		}
+		offset = (offset+1)<<7 | int64(b&0x7f)
+	}
+	return offset, nil
+}
+
+// inflate decompresses one zlib stream of exactly size bytes. The size
+// comes from the pack, so memory is only reserved for data actually read.
+func inflate(r io.Reader, size uint64) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, min(size, maxPrealloc)))
+	if err := inflateTo(buf, r, size); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// inflateTo decompresses one zlib stream of exactly size bytes into w.
+func inflateTo(w io.Writer, r io.Reader, size uint64) error {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrCorrupt, err)
+	}
+	defer zr.Close()
+	n, err := io.Copy(w, io.LimitReader(zr, int64(min(size, math.MaxInt64-1))+1))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrCorrupt, err)
+	}
+	if uint64(n) > size {
+		return fmt.Errorf("%w: entry larger than %d bytes", ErrCorrupt, size)
+	}
+	if uint64(n) < size {
+		return fmt.Errorf("%w: entry has %d bytes, expected %d", ErrCorrupt, n, size)
+	}
+	return nil
+}
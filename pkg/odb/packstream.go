@@ -0,0 +1,189 @@
+package odb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// PackEntry is an entry of a pack stream. Delta entries hold the delta
+// instead of the object; their base is found at BaseOffset for OfsDelta
+// or named by BaseID for RefDelta.
+type PackEntry struct {
+	// Offset is the position of the entry header in the pack.
+	Offset int64
+	// Type is an object type, OfsDelta or RefDelta.
+	Type Type
+	// ID is the name of an object entry, computed while it is inflated.
+	ID ID
+	// Data is the object or the delta, unless the reader discards it.
+	Data       []byte
+	BaseOffset int64
+	BaseID     ID
+	// CRC32 is the checksum of the entry's raw bytes, as pack indexes
+	// record it.
+	CRC32 uint32
+}
+
+// PackReader reads the entries of a pack from a stream, such as a fetch
+// response, in order. It checks the header, the inflated size of every
+// entry, the number of entries and the trailing checksum, so that a
+// corrupt or truncated pack fails instead of producing wrong objects.
+type PackReader struct {
+	// DiscardData leaves the Data of entries empty, so that large objects
+	// are never held in memory. Entries are still inflated to check their
+	// sizes, and objects are still named.
+	DiscardData bool
+
+	algo  *Algorithm
+	s     *packStream
+	count uint32
+	read  uint32
+	sum   ID
+}
+
+// packStream reads pack data, hashing it and tracking the offset. As an
+// io.ByteReader it lets decompression stop exactly at the end of each
+// entry.
+type packStream struct {
+	r    *bufio.Reader
+	hash hash.Hash
+	// crc is the checksum of the current entry.
+	crc hash.Hash32
+	pos int64
+}
+
+// NewPackReader reads the header of a pack stream.
+func NewPackReader(r io.Reader, algo *Algorithm) (*PackReader, error) {
+	p := &PackReader{algo: algo, s: &packStream{r: bufio.NewReader(r), hash: algo.New(), crc: crc32.NewIEEE()}}
+	var header [12]byte
+	if _, err := io.ReadFull(p.s, header[:]); err != nil {
+		return nil, fmt.Errorf("%w: truncated pack header", ErrCorrupt)
+	}
+	if string(header[:4]) != "PACK" {
+		return nil, fmt.Errorf("%w: not a pack file", ErrCorrupt)
+	}
+	if v := binary.BigEndian.Uint32(header[4:]); v != 2 && v != 3 {
+		return nil, fmt.Errorf("%w: unsupported pack version %d", ErrCorrupt, v)
+	}
+	p.count = binary.BigEndian.Uint32(header[8:])
+	return p, nil
+}
+
+// Count returns the number of entries the pack header announces.
+func (p *PackReader) Count() uint32 {
+	return p.count
+}
+
+// Checksum returns the trailing checksum of the pack once Next has
+// returned io.EOF.
+func (p *PackReader) Checksum() ID {
+	return p.sum
+}
+
+// Next returns the next entry. After the last entry it verifies the
+// trailing checksum and returns io.EOF.
+func (p *PackReader) Next() (*PackEntry, error) {
+	if p.read == p.count {
+		return nil, p.verifyTrailer()
+	}
+	e := &PackEntry{Offset: p.s.pos}
+	p.s.crc.Reset()
+	t, size, err := readEntryHeader(p.s)
+	if err != nil {
+		return nil, p.truncated(err)
+	}
+	e.Type = t
+	switch t {
+	case Commit, Tree, Blob, Tag:
+	case OfsDelta:
+		rel, err := readOffset(p.s)
+		if err != nil {
+			return nil, p.truncated(err)
+		}
+		if rel <= 0 || rel > e.Offset-12 {
+			return nil, fmt.Errorf("%w: entry at offset %d: delta base offset out of range", ErrCorrupt, e.Offset)
+		}
+		e.BaseOffset = e.Offset - rel
+	case RefDelta:
+		name := make([]byte, p.algo.size)
+		if _, err := io.ReadFull(p.s, name); err != nil {
+			return nil, p.truncated(fmt.Errorf("%w: truncated delta base name", ErrCorrupt))
+		}
+		e.BaseID = NewID(name)
+	default:
+		return nil, fmt.Errorf("%w: entry at offset %d: unknown pack entry type %d", ErrCorrupt, e.Offset, t)
+	}
+	var w io.Writer = io.Discard
+	var data *bytes.Buffer
+	if !p.DiscardData {
+		data = bytes.NewBuffer(make([]byte, 0, min(size, maxPrealloc)))
+		w = data
+	}
+	var h hash.Hash
+	if t != OfsDelta && t != RefDelta {
+		h = p.algo.New()
+		fmt.Fprintf(h, "%s %d\x00", t, size)
+		w = io.MultiWriter(w, h)
+	}
+	if err := inflateTo(w, p.s, size); err != nil {
+		return nil, p.truncated(fmt.Errorf("entry at offset %d: %w", e.Offset, err))
+	}
+	if data != nil {
+		e.Data = data.Bytes()
+	}
+	if h != nil {
+		e.ID = NewID(h.Sum(nil))
+	}
+	e.CRC32 = p.s.crc.Sum32()
+	p.read++
+	return e, nil
+}
+
+// truncated describes an error in the middle of the pack, mentioning how
+// many entries were read.
+func (p *PackReader) truncated(err error) error {
+	return fmt.Errorf("%w (%d of %d objects read)", err, p.read, p.count)
+}
+
+// verifyTrailer compares the checksum after the last entry with the hash
+// of the pack and makes sure nothing follows it.
+func (p *PackReader) verifyTrailer() error {
+	sum := p.s.hash.Sum(nil)
+	trailer := make([]byte, len(sum))
+	if _, err := io.ReadFull(p.s.r, trailer); err != nil {
+		return fmt.Errorf("%w: truncated pack checksum", ErrCorrupt)
+	}
+	if !bytes.Equal(trailer, sum) {
+		return fmt.Errorf("%w: pack checksum mismatch", ErrCorrupt)
+	}
+	if _, err := p.s.r.ReadByte(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: data after pack checksum", ErrCorrupt)
+	}
+	p.sum = NewID(sum)
+	return io.EOF
+}
+
+func (s *packStream) Read(b []byte) (int, error) {
+	n, err := s.r.Read(b)
+	s.hash.Write(b[:n])
+	s.crc.Write(b[:n])
+	s.pos += int64(n)
+	return n, err
+}
+
+func (s *packStream) ReadByte() (byte, error) {
+	b, err := s.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	s.hash.Write([]byte{b})
+	s.crc.Write([]byte{b})
+	s.pos++
+	return b, nil
+}
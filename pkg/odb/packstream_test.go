@@ -0,0 +1,425 @@
+package odb
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// packBuilder assembles a pack in memory.
+type packBuilder struct {
+	algo  *Algorithm
+	buf   bytes.Buffer
+	count uint32
+}
+
+func newPackBuilder(algo *Algorithm) *packBuilder {
+	b := &packBuilder{algo: algo}
+	b.buf.WriteString("PACK\x00\x00\x00\x02\x00\x00\x00\x00")
+	return b
+}
+
+// entry appends an entry with the given header fields and inflated data
+// and returns its offset.
+func (b *packBuilder) entry(t Type, data []byte, base []byte) int64 {
+	offset := int64(b.buf.Len())
+	size := uint64(len(data))
+	c := byte(t)<<4 | byte(size&0x0f)
+	for size >>= 4; size > 0; size >>= 7 {
+		b.buf.WriteByte(c | 0x80)
+		c = byte(size & 0x7f)
+	}
+	b.buf.WriteByte(c)
+	b.buf.Write(base)
+	w := zlib.NewWriter(&b.buf)
+	w.Write(data)
+	w.Close()
+	b.count++
+	return offset
+}
+
+func (b *packBuilder) object(t Type, data []byte) int64 {
+	return b.entry(t, data, nil)
+}
+
+// ofsDelta appends a delta against the entry at base.
+func (b *packBuilder) ofsDelta(base int64, delta []byte) int64 {
+	rel := uint64(int64(b.buf.Len()) - base)
+	enc := []byte{byte(rel & 0x7f)}
+	for rel >>= 7; rel > 0; rel >>= 7 {
+		rel--
+		enc = append([]byte{byte(rel&0x7f) | 0x80}, enc...)
+	}
+	return b.entry(OfsDelta, delta, enc)
+}
+
+func (b *packBuilder) refDelta(base ID, delta []byte) int64 {
+	return b.entry(RefDelta, delta, base.Bytes())
+}
+
+// bytes returns the pack with its object count and trailing checksum.
+func (b *packBuilder) bytes() []byte {
+	pack := bytes.Clone(b.buf.Bytes())
+	binary.BigEndian.PutUint32(pack[8:], b.count)
+	h := b.algo.New()
+	h.Write(pack)
+	return h.Sum(pack)
+}
+
+// testPack is a pack holding a blob, a chain of two deltas against it and
+// a tree, together with the objects it contains.
+type testPack struct {
+	data    []byte
+	objects map[ID]string
+	types   map[ID]Type
+}
+
+func newTestPack(algo *Algorithm) testPack {
+	const v1, v2, v3 = "line 1\nline 2\n", "line 1\nline 2\nline 3\n", "line 0\nline 1\nline 2\nline 3\n"
+	b := newPackBuilder(algo)
+	blob := b.object(Blob, []byte(v1))
+	// v2 copies v1 and appends a line.
+	b.ofsDelta(blob, delta(uint64(len(v1)), uint64(len(v2)), 0x90, byte(len(v1)), 7, 'l', 'i', 'n', 'e', ' ', '3', '\n'))
+	// v3 prepends a line to v2, which is itself a delta.
+	id2 := algo.Sum(Blob, []byte(v2))
+	b.refDelta(id2, delta(uint64(len(v2)), uint64(len(v3)), 7, 'l', 'i', 'n', 'e', ' ', '0', '\n', 0x90, byte(len(v2))))
+	b.object(Tree, nil)
+	p := testPack{data: b.bytes(), objects: make(map[ID]string), types: make(map[ID]Type)}
+	for _, v := range []string{v1, v2, v3} {
+		id := algo.Sum(Blob, []byte(v))
+		p.objects[id], p.types[id] = v, Blob
+	}
+	tree := algo.Sum(Tree, nil)
+	p.objects[tree], p.types[tree] = "", Tree
+	return p
+}
+
+// readPack reads every entry of a pack.
+func readPack(pack []byte, algo *Algorithm) ([]*PackEntry, error) {
+	r, err := NewPackReader(bytes.NewReader(pack), algo)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*PackEntry
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+func TestPackReader(t *testing.T) {
+	for _, algo := range []*Algorithm{SHA1, SHA256} {
+		t.Run(algo.Name(), func(t *testing.T) {
+			pack := newTestPack(algo).data
+			r, err := NewPackReader(bytes.NewReader(pack), algo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Count() != 4 {
+				t.Errorf("Count = %d, want 4", r.Count())
+			}
+			var entries []*PackEntry
+			for {
+				e, err := r.Next()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				entries = append(entries, e)
+			}
+			if len(entries) != 4 {
+				t.Fatalf("read %d entries, want 4", len(entries))
+			}
+			if want := pack[len(pack)-algo.Size():]; !bytes.Equal(r.Checksum().Bytes(), want) {
+				t.Errorf("Checksum = %s, want %x", r.Checksum(), want)
+			}
+
+			blob, ofs, ref, tree := entries[0], entries[1], entries[2], entries[3]
+			if blob.Type != Blob || blob.Offset != 12 || string(blob.Data) != "line 1\nline 2\n" {
+				t.Errorf("first entry = %s at %d with %q", blob.Type, blob.Offset, blob.Data)
+			}
+			if want := algo.Sum(Blob, blob.Data); blob.ID != want {
+				t.Errorf("blob ID = %s, want %s", blob.ID, want)
+			}
+			if ofs.Type != OfsDelta || ofs.BaseOffset != blob.Offset || !ofs.ID.IsZero() {
+				t.Errorf("second entry = %s with base offset %d and ID %s", ofs.Type, ofs.BaseOffset, ofs.ID)
+			}
+			if want := algo.Sum(Blob, []byte("line 1\nline 2\nline 3\n")); ref.Type != RefDelta || ref.BaseID != want {
+				t.Errorf("third entry = %s with base %s, want REF_DELTA with base %s", ref.Type, ref.BaseID, want)
+			}
+			if tree.Type != Tree || tree.ID != algo.Sum(Tree, nil) {
+				t.Errorf("fourth entry = %s %s", tree.Type, tree.ID)
+			}
+			for i, e := range entries {
+				if e.CRC32 == 0 {
+					t.Errorf("entry %d has no CRC-32", i)
+				}
+			}
+		})
+	}
+}
+
+func TestPackReaderDiscardData(t *testing.T) {
+	pack := newTestPack(SHA1).data
+	r, err := NewPackReader(bytes.NewReader(pack), SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.DiscardData = true
+	e, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Data != nil || e.ID != SHA1.Sum(Blob, []byte("line 1\nline 2\n")) {
+		t.Errorf("entry with discarded data = %q, %s", e.Data, e.ID)
+	}
+}
+
+func TestPackReaderErrors(t *testing.T) {
+	valid := newTestPack(SHA1).data
+	modify := func(f func(p []byte) []byte) []byte {
+		return f(bytes.Clone(valid))
+	}
+	// rehash replaces the trailing checksum to match the modified pack.
+	rehash := func(p []byte) []byte {
+		p = p[:len(p)-SHA1.Size()]
+		h := SHA1.New()
+		h.Write(p)
+		return h.Sum(p)
+	}
+	single := func(header ...byte) []byte {
+		p := append([]byte("PACK\x00\x00\x00\x02\x00\x00\x00\x01"), header...)
+		var z bytes.Buffer
+		w := zlib.NewWriter(&z)
+		w.Write([]byte("abc"))
+		w.Close()
+		h := SHA1.New()
+		h.Write(append(p, z.Bytes()...))
+		return h.Sum(append(p, z.Bytes()...))
+	}
+	tests := []struct {
+		name string
+		pack []byte
+	}{
+		{"empty", nil},
+		{"bad signature", modify(func(p []byte) []byte { p[0] = 'X'; return p })},
+		{"bad version", modify(func(p []byte) []byte { p[7] = 4; return rehash(p) })},
+		{"count too high", modify(func(p []byte) []byte { p[11]++; return rehash(p) })},
+		{"count too low", modify(func(p []byte) []byte { p[11]--; return rehash(p) })},
+		{"bad checksum", modify(func(p []byte) []byte { p[len(p)-1] ^= 1; return p })},
+		{"flipped data bit", modify(func(p []byte) []byte { p[len(p)-SHA1.Size()-3] ^= 0x10; return rehash(p) })},
+		{"data after checksum", append(bytes.Clone(valid), 0)},
+		{"unknown type", single(5<<4 | 3)},
+		{"size too small", single(3<<4 | 2)},
+		{"size too large", single(3<<4 | 4)},
+		{"oversized header", single(0xbf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f)},
+		{"overflowing header", single(0xbf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01)},
+		{"delta base before pack", single(byte(OfsDelta)<<4|3, 20)},
+		{"delta base at entry", single(byte(OfsDelta)<<4|3, 0)},
+	}
+	for _, tt := range tests {
+		if _, err := readPack(tt.pack, SHA1); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: error = %v, want ErrCorrupt", tt.name, err)
+		}
+	}
+	for n := 0; n < len(valid); n++ {
+		if _, err := readPack(valid[:n], SHA1); !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("pack truncated to %d bytes: error = %v, want ErrCorrupt", n, err)
+		}
+	}
+}
+
+func TestWritePack(t *testing.T) {
+	for _, algo := range []*Algorithm{SHA1, SHA256} {
+		t.Run(algo.Name(), func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "objects")
+			db, err := Open(dir, algo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			p := newTestPack(algo)
+			sum, err := db.WritePack(bytes.NewReader(p.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := p.data[len(p.data)-algo.Size():]; !bytes.Equal(sum.Bytes(), want) {
+				t.Errorf("WritePack = %s, want %x", sum, want)
+			}
+			for id, want := range p.objects {
+				typ, data, err := db.Read(id)
+				if err != nil || typ != p.types[id] || string(data) != want {
+					t.Errorf("Database.Read(%s) = %s, %q, %v", id, typ, data, err)
+				}
+			}
+
+			pack, err := OpenPack(filepath.Join(dir, "pack", "pack-"+sum.String()+".pack"), algo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pack.Close()
+			n := 0
+			err = pack.Iterate(func(id ID) error {
+				n++
+				typ, data, err := pack.Read(id)
+				if err != nil || typ != p.types[id] || string(data) != p.objects[id] {
+					t.Errorf("Pack.Read(%s) = %s, %q, %v", id, typ, data, err)
+				}
+				return nil
+			})
+			if err != nil || n != len(p.objects) {
+				t.Errorf("Iterate visited %d objects, %v; want %d", n, err, len(p.objects))
+			}
+		})
+	}
+}
+
+func TestWritePackCorrupt(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "objects")
+	db, err := Open(dir, SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	pack := newTestPack(SHA1).data
+	if _, err := db.WritePack(bytes.NewReader(pack[:len(pack)-1])); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("WritePack of a truncated pack: %v, want ErrCorrupt", err)
+	}
+	// A REF_DELTA whose base is in neither the pack nor the database.
+	b := newPackBuilder(SHA1)
+	b.refDelta(SHA1.Sum(Blob, []byte("missing")), delta(7, 0))
+	if _, err := db.WritePack(bytes.NewReader(b.bytes())); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("WritePack with a missing delta base: %v, want ErrCorrupt", err)
+	}
+	if files, _ := os.ReadDir(filepath.Join(dir, "pack")); len(files) != 0 {
+		t.Errorf("failed WritePack left %d files in objects/pack", len(files))
+	}
+}
+
+func TestPackConcurrentReads(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "objects")
+	db, err := Open(dir, SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	p := newTestPack(SHA1)
+	if _, err := db.WritePack(bytes.NewReader(p.data)); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				for id, want := range p.objects {
+					if _, data, err := db.Read(id); err != nil || string(data) != want {
+						t.Errorf("Read(%s) = %q, %v", id, data, err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// writeTestPack writes pack and an index of entries, sorted by name, to
+// dir and returns the path of the pack.
+func writeTestPack(t *testing.T, dir string, pack []byte, entries []*indexEntry, algo *Algorithm) string {
+	t.Helper()
+	path := filepath.Join(dir, "test.pack")
+	if err := os.WriteFile(path, pack, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var idx bytes.Buffer
+	if err := writePackIndex(&idx, entries, NewID(pack[len(pack)-algo.Size():]), algo); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "test.idx"), idx.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenPackCorruptIndex(t *testing.T) {
+	b := newPackBuilder(SHA1)
+	id := SHA1.Sum(Blob, []byte("blob\n"))
+	offset := b.object(Blob, []byte("blob\n"))
+	pack := b.bytes()
+	tests := []struct {
+		name   string
+		modify func(idx []byte) []byte
+	}{
+		{"truncated header", func(idx []byte) []byte { return idx[:100] }},
+		{"version 3", func(idx []byte) []byte { idx[7] = 3; return idx }},
+		{"non-monotonic fanout", func(idx []byte) []byte {
+			binary.BigEndian.PutUint32(idx[8+4*200:], 0)
+			return idx
+		}},
+		{"object count past the end", func(idx []byte) []byte {
+			binary.BigEndian.PutUint32(idx[8+4*255:], 2)
+			return idx
+		}},
+		{"huge object count", func(idx []byte) []byte {
+			binary.BigEndian.PutUint32(idx[8+4*255:], 0xffffffff)
+			return idx
+		}},
+		{"bad large offset", func(idx []byte) []byte {
+			// The only offset entry follows the name and the CRC.
+			binary.BigEndian.PutUint32(idx[8+256*4+SHA1.Size()+4:], 1<<31|5)
+			return idx
+		}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		path := writeTestPack(t, dir, pack, []*indexEntry{{id: id, offset: offset}}, SHA1)
+		idxPath := filepath.Join(dir, "test.idx")
+		idx, err := os.ReadFile(idxPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(idxPath, tt.modify(idx), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if p, err := OpenPack(path, SHA1); !errors.Is(err, ErrCorrupt) {
+			if err == nil {
+				p.Close()
+			}
+			t.Errorf("%s: OpenPack = %v, want ErrCorrupt", tt.name, err)
+		}
+	}
+}
+
+func TestPackDeltaCycle(t *testing.T) {
+	// Two REF_DELTA entries, each naming the other as its base.
+	b := newPackBuilder(SHA1)
+	x, y := SHA1.Sum(Blob, []byte("x")), SHA1.Sum(Blob, []byte("y"))
+	entries := []*indexEntry{
+		{id: x, offset: b.refDelta(y, delta(1, 1, 0x90, 1))},
+		{id: y, offset: b.refDelta(x, delta(1, 1, 0x90, 1))},
+	}
+	if bytes.Compare(x.Bytes(), y.Bytes()) > 0 {
+		entries[0], entries[1] = entries[1], entries[0]
+	}
+	p, err := OpenPack(writeTestPack(t, t.TempDir(), b.bytes(), entries, SHA1), SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if _, _, err := p.Read(x); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Read of a delta cycle = %v, want ErrCorrupt", err)
+	}
+}
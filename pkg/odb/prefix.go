@@ -0,0 +1,109 @@
+package odb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MinPrefix is the shortest abbreviated object name that is resolved.
+const MinPrefix = 4
+
+// prefixFinder is implemented by stores that can look up abbreviated names
+// without visiting every object.
+type prefixFinder interface {
+	findPrefix(prefix string, fn func(id ID))
+}
+
+// FindPrefix returns the names of all objects in s whose hex name starts
+// with prefix. The prefix must be at least MinPrefix hex digits.
+func FindPrefix(s Store, prefix string) ([]ID, error) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < MinPrefix || !isHex(prefix) {
+		return nil, fmt.Errorf("invalid object name prefix: %q", prefix)
+	}
+	seen := make(map[ID]bool)
+	matches := make([]ID, 0)
+	add := func(id ID) {
+		if !seen[id] {
+			seen[id] = true
+			matches = append(matches, id)
+		}
+	}
+	if f, ok := s.(prefixFinder); ok {
+		f.findPrefix(prefix, add)
+	} else {
+		err := s.Iterate(func(id ID) error {
+			if id.HasPrefix(prefix) {
+				add(id)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return bytes.Compare(matches[i].Bytes(), matches[j].Bytes()) < 0
+	})
+	return matches, nil
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *LooseStore) findPrefix(prefix string, fn func(id ID)) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, prefix[:2]))
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := prefix[:2] + entry.Name()
+		if len(name) != s.algo.size*2 || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if b, err := hex.DecodeString(name); err == nil {
+			fn(NewID(b))
+		}
+	}
+}
+
+func (p *Pack) findPrefix(prefix string, fn func(id ID)) {
+	if len(prefix) > p.algo.size*2 {
+		return
+	}
+	// Pad the prefix to a full name to find the first candidate.
+	b, err := hex.DecodeString(prefix + strings.Repeat("0", p.algo.size*2-len(prefix)))
+	if err != nil {
+		return
+	}
+	i := sort.Search(len(p.offsets), func(i int) bool {
+		return bytes.Compare(p.name(i), b) >= 0
+	})
+	for ; i < len(p.offsets); i++ {
+		id := NewID(p.name(i))
+		if !id.HasPrefix(prefix) {
+			break
+		}
+		fn(id)
+	}
+}
+
+func (db *Database) findPrefix(prefix string, fn func(id ID)) {
+	db.loose.findPrefix(prefix, fn)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, pack := range db.packs {
+		pack.findPrefix(prefix, fn)
+	}
+}
@@ -0,0 +1,22 @@
+// Package odb implements git object databases.
+//
+// A Store maps object IDs to typed content. Stores are provided for loose
+// objects, pack files and memory, and a Database combines the loose and
+// packed objects of a repository's objects directory.
+package odb
+
+// Store is a content-addressed object database.
+type Store interface {
+	// Read returns the type and content of an object. It returns an
+	// error wrapping ErrNotFound if the object does not exist. The
+	// returned data may be shared and must not be modified.
+	Read(id ID) (Type, []byte, error)
+	// Write stores an object and returns its name. Writing an object
+	// that already exists is not an error.
+	Write(t Type, data []byte) (ID, error)
+	// Has reports whether the object exists.
+	Has(id ID) bool
+	// Iterate calls fn for every object in the store, stopping at the
+	// first error.
+	Iterate(fn func(id ID) error) error
+}
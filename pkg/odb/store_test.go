@@ -0,0 +1,111 @@
+package odb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// testStore checks the behavior every Store shares.
+func testStore(t *testing.T, s Store, algo *Algorithm) {
+	t.Helper()
+	id, err := s.Write(Blob, []byte("hello\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := algo.Sum(Blob, []byte("hello\n")); id != want {
+		t.Errorf("Write = %s, want %s", id, want)
+	}
+	if again, err := s.Write(Blob, []byte("hello\n")); err != nil || again != id {
+		t.Errorf("writing an existing object = %s, %v", again, err)
+	}
+	typ, data, err := s.Read(id)
+	if err != nil || typ != Blob || string(data) != "hello\n" {
+		t.Errorf("Read(%s) = %s, %q, %v", id, typ, data, err)
+	}
+	if !s.Has(id) {
+		t.Errorf("Has(%s) = false", id)
+	}
+	missing := algo.Sum(Blob, []byte("missing"))
+	if s.Has(missing) {
+		t.Errorf("Has(%s) = true for a missing object", missing)
+	}
+	if _, _, err := s.Read(missing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read of a missing object: %v, want ErrNotFound", err)
+	}
+
+	tree, err := s.Write(Tree, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[ID]int)
+	if err := s.Iterate(func(id ID) error { seen[id]++; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || seen[id] != 1 || seen[tree] != 1 {
+		t.Errorf("Iterate visited %v, want %s and %s once each", seen, id, tree)
+	}
+	stop := errors.New("stop")
+	if err := s.Iterate(func(ID) error { return stop }); err != stop {
+		t.Errorf("Iterate returned %v, want the callback's error", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	for _, algo := range []*Algorithm{SHA1, SHA256} {
+		t.Run(algo.Name(), func(t *testing.T) {
+			testStore(t, NewMemoryStore(algo), algo)
+		})
+	}
+}
+
+func TestLooseStore(t *testing.T) {
+	for _, algo := range []*Algorithm{SHA1, SHA256} {
+		t.Run(algo.Name(), func(t *testing.T) {
+			testStore(t, NewLooseStore(t.TempDir(), algo), algo)
+		})
+	}
+}
+
+func TestDatabase(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "objects"), SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	testStore(t, db, SHA1)
+}
+
+func TestConcurrentReads(t *testing.T) {
+	stores := map[string]Store{
+		"memory": NewMemoryStore(SHA1),
+		"loose":  NewLooseStore(t.TempDir(), SHA1),
+	}
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			var ids []ID
+			for i := 0; i < 50; i++ {
+				id, err := s.Write(Blob, []byte(fmt.Sprintf("blob %d\n", i)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, id)
+			}
+			var wg sync.WaitGroup
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i, id := range ids {
+						if _, data, err := s.Read(id); err != nil || string(data) != fmt.Sprintf("blob %d\n", i) {
+							t.Errorf("Read(%s) = %q, %v", id, data, err)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}